@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/ab"
+	"github.com/fireproofpenguin/loadship/internal/comparison"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var (
+	abConfig              ab.Config
+	abBaseline            string
+	abCandidate           string
+	abBaselineContainers  []string
+	abCandidateContainers []string
+)
+
+var abCmd = &cobra.Command{
+	Use:   "ab",
+	Short: "Compare a candidate against a baseline under identical load",
+	Long: `Run identical load against a baseline and a candidate, repeated to reduce noise, and compare them.
+
+Each side is an http(s) URL or an image, prefixed with image: when it could be read as a host and port. Images are started fresh for every run with the same --port, --env, --memory and --cpus,
+then stopped and removed. Runs are interleaved by default so drift on the host affects both sides alike.
+
+Example usage:
+	loadship ab --baseline myapp:1.4.2 --candidate myapp:1.5.0 --port 8080 --memory 512m --repeat 5
+	loadship ab --baseline http://blue.internal:8080 --candidate http://green.internal:8080 -d 1m`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		abConfig.Baseline, err = ab.ParseTarget(abBaseline)
+		if err != nil {
+			return fmt.Errorf("invalid --baseline: %w", err)
+		}
+		abConfig.Baseline.Containers = abBaselineContainers
+
+		abConfig.Candidate, err = ab.ParseTarget(abCandidate)
+		if err != nil {
+			return fmt.Errorf("invalid --candidate: %w", err)
+		}
+		abConfig.Candidate.Containers = abCandidateContainers
+
+		if abConfig.SampleInterval < docker.MinSampleInterval {
+			return fmt.Errorf("--sample-interval must be at least %s", docker.MinSampleInterval)
+		}
+
+		return abConfig.Validate()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if abConfig.Directory == "" {
+			abConfig.Directory = fmt.Sprintf("ab_%s", time.Now().Format("20060102_150405"))
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+
+		result, err := ab.Start(ctx, abConfig)
+
+		if err != nil {
+			return fmt.Errorf("error running A/B test: %w", err)
+		}
+
+		fmt.Println("\n=== Comparing Test Results ===")
+		fmt.Printf("Baseline: %s (%d runs)\n", abConfig.Baseline, result.Baselines)
+		fmt.Printf("Test 1: %s (%d runs)\n", abConfig.Candidate, result.Candidates)
+		if len(result.Failed) > 0 {
+			fmt.Printf("Skipped %d failed runs\n", len(result.Failed))
+		}
+
+		comparison.PrintComparisonReports(nil, []*comparison.ComparisonReport{result.Report})
+		result.Report.PrintVerdict("Candidate")
+
+		fmt.Printf("\n✓ Results saved to %s/\n", abConfig.Directory)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(abCmd)
+
+	abCmd.Flags().StringVar(&abBaseline, "baseline", "", "Baseline URL or image")
+	abCmd.Flags().StringVar(&abCandidate, "candidate", "", "Candidate URL or image")
+	abCmd.MarkFlagRequired("baseline")
+	abCmd.MarkFlagRequired("candidate")
+	abCmd.Flags().DurationVarP(&abConfig.Duration, "duration", "d", time.Second*30, "Duration of each run (e.g., 10s, 1m)")
+	abCmd.Flags().IntVarP(&abConfig.Connections, "connections", "c", 10, "Number of concurrent connections to use during each run")
+	abCmd.Flags().IntVar(&abConfig.Repeat, "repeat", 3, "How many times to run each side, more runs make the significance of a change more reliable")
+	abCmd.Flags().StringVar(&abConfig.Order, "order", ab.OrderInterleaved, "Run the sides interleaved or sequential (every baseline run first)")
+	abCmd.Flags().DurationVar(&abConfig.Cooldown, "cooldown", 10*time.Second, "Time to wait between runs")
+	abCmd.Flags().StringVar(&abConfig.Directory, "dir", "", "Directory to save the results of every run to (default ab_<timestamp>)")
+	abCmd.Flags().StringArrayVar(&abBaselineContainers, "baseline-container", nil, "Docker container to monitor during baseline runs, can be repeated")
+	abCmd.Flags().StringArrayVar(&abCandidateContainers, "candidate-container", nil, "Docker container to monitor during candidate runs, can be repeated")
+	abCmd.Flags().StringVar(&abConfig.Managed.Port, "port", "", "Container port to publish for image targets, or host:container (e.g. 8080 or 9000:8080)")
+	abCmd.Flags().StringArrayVar(&abConfig.Managed.Env, "env", nil, "KEY=VALUE environment variable for image targets, can be repeated")
+	abCmd.Flags().StringVar(&abConfig.Managed.Memory, "memory", "", "Memory limit of image targets (e.g. 512m)")
+	abCmd.Flags().Float64Var(&abConfig.Managed.CPUs, "cpus", 0, "CPU limit of image targets (e.g. 1.5)")
+	abCmd.Flags().DurationVar(&abConfig.Managed.ReadyTimeout, "ready-timeout", docker.DefaultReadyTimeout, "How long image targets have to pass their healthcheck and answer HTTP requests")
+	abCmd.Flags().StringVar(&abConfig.Docker.Host, "docker-host", "", "Docker daemon to start and monitor containers through (defaults to DOCKER_HOST or the current docker context)")
+	abCmd.Flags().StringVar(&abConfig.Docker.Context, "docker-context", "", "Docker context to take the daemon from, ignored when --docker-host is set")
+	abCmd.Flags().BoolVar(&abConfig.Docker.TLSVerify, "docker-tls-verify", false, "Connect to the docker daemon over TLS and verify its certificate against ca.pem")
+	abCmd.Flags().StringVar(&abConfig.Docker.CertPath, "docker-cert-path", "", "Directory holding ca.pem, cert.pem and key.pem for connecting to the docker daemon over TLS (default ~/.docker)")
+	abCmd.Flags().DurationVar(&abConfig.SampleInterval, "sample-interval", docker.DefaultSampleInterval, "How often to sample container resource usage")
+	abCmd.Flags().BoolVar(&abConfig.TUI, "tui", false, "Show a live dashboard during each run instead of a progress bar")
+	abCmd.Flags().StringToStringVar(&abConfig.Tags, "tag", nil, "Tag the results with a key=value label, can be repeated. Each result is also tagged ab=baseline or ab=candidate")
+}
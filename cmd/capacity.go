@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/capacity"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var (
+	capacityConfig  capacity.Config
+	capacityManaged docker.ContainerSpec
+)
+
+var capacityCmd = &cobra.Command{
+	Use:   "capacity [url]",
+	Short: "Find the highest load the target sustains within an SLO",
+	Long: `Find the highest load the target sustains within an SLO, e.g. p99 below 200ms and less than 0.1% of requests failing.
+
+Short trials step the load up by --factor until one misses the SLO or throughput stops keeping up with the load (the knee),
+then a binary search narrows down the load in between. The load is the number of connections, or with --mode rate the
+requests sent per second across --connections connections.
+
+Example usage:
+	loadship capacity http://localhost:8080 --p99 200ms --max-error-rate 0.1
+	loadship capacity http://localhost:8080 --mode rate --start 100 --max 5000 --p99 200ms --report`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			capacityConfig.URL = args[0]
+		}
+
+		if capacityManaged.Image != "" {
+			if err := capacityManaged.Validate(); err != nil {
+				return err
+			}
+			if capacityConfig.URL == "" && capacityManaged.Port == "" {
+				return fmt.Errorf("--image needs a --port to publish when no URL is given")
+			}
+			capacityConfig.Managed = &capacityManaged
+		} else if capacityConfig.URL == "" {
+			return fmt.Errorf("must provide a URL or an --image")
+		}
+
+		if capacityConfig.SampleInterval < docker.MinSampleInterval {
+			return fmt.Errorf("--sample-interval must be at least %s", docker.MinSampleInterval)
+		}
+
+		return capacityConfig.Validate()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if capacityConfig.Directory == "" {
+			capacityConfig.Directory = fmt.Sprintf("capacity_%s", time.Now().Format("20060102_150405"))
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+
+		result, err := capacity.Start(ctx, capacityConfig)
+
+		if err != nil {
+			return fmt.Errorf("error running capacity search: %w", err)
+		}
+
+		result.Print()
+
+		fmt.Printf("\n✓ Results saved to %s/\n", capacityConfig.Directory)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(capacityCmd)
+
+	capacityCmd.Flags().StringVar(&capacityConfig.Mode, "mode", capacity.ModeConnections, "What to vary between trials: connections, or rate for the requests sent per second")
+	capacityCmd.Flags().IntVar(&capacityConfig.Start, "start", capacity.DefaultStart, "Load of the first trial, in connections or requests per second")
+	capacityCmd.Flags().IntVar(&capacityConfig.Max, "max", 0, "Highest load to try (default unbounded)")
+	capacityCmd.Flags().Float64Var(&capacityConfig.Factor, "factor", capacity.DefaultFactor, "Multiply the load by this much at every step up")
+	capacityCmd.Flags().Float64Var(&capacityConfig.Precision, "precision", capacity.DefaultPrecision, "Stop searching once the gap between the sustainable and unsustainable load is within this fraction of the sustainable load")
+	capacityCmd.Flags().Float64Var(&capacityConfig.Knee, "knee", capacity.DefaultKnee, "Share of extra connections that has to turn into extra throughput before the target counts as saturated")
+	capacityCmd.Flags().DurationVarP(&capacityConfig.Duration, "duration", "d", capacity.DefaultDuration, "Duration of each trial (e.g., 10s, 1m)")
+	capacityCmd.Flags().DurationVar(&capacityConfig.Cooldown, "cooldown", 5*time.Second, "Time to wait between trials")
+	capacityCmd.Flags().IntVarP(&capacityConfig.Connections, "connections", "c", capacity.DefaultRateConnections, "Connections sending requests with --mode rate, limiting how many are in flight at once")
+	capacityCmd.Flags().DurationVar(&capacityConfig.SLO.P99, "p99", 0, "Highest p99 latency a sustainable load can have (e.g. 200ms, default unlimited)")
+	capacityCmd.Flags().Float64Var(&capacityConfig.SLO.ErrorRate, "max-error-rate", capacity.DefaultErrorRate, "Highest percentage of failed requests a sustainable load can have (e.g. 0.1)")
+	capacityCmd.Flags().StringVar(&capacityConfig.Directory, "dir", "", "Directory to save the results of every trial to (default capacity_<timestamp>)")
+	capacityCmd.Flags().BoolVar(&capacityConfig.Report, "report", false, "Generate an HTML report of the sustainable trial with the throughput and latency of every trial")
+	capacityCmd.Flags().StringArrayVar(&capacityConfig.Containers, "container", nil, "Docker container name or id to monitor during every trial, can be repeated")
+	capacityCmd.Flags().StringVar(&capacityManaged.Image, "image", "", "Start the target from this image for every trial, then stop and remove it afterwards")
+	capacityCmd.Flags().StringVar(&capacityManaged.Port, "port", "", "Container port to publish with --image, or host:container (e.g. 8080 or 9000:8080)")
+	capacityCmd.Flags().StringArrayVar(&capacityManaged.Env, "env", nil, "KEY=VALUE environment variable for the --image container, can be repeated")
+	capacityCmd.Flags().StringVar(&capacityManaged.Memory, "memory", "", "Memory limit of the --image container (e.g. 512m)")
+	capacityCmd.Flags().Float64Var(&capacityManaged.CPUs, "cpus", 0, "CPU limit of the --image container (e.g. 1.5)")
+	capacityCmd.Flags().DurationVar(&capacityManaged.ReadyTimeout, "ready-timeout", docker.DefaultReadyTimeout, "How long the --image container has to pass its healthcheck and answer HTTP requests")
+	capacityCmd.Flags().StringVar(&capacityConfig.Docker.Host, "docker-host", "", "Docker daemon to start and monitor containers through (defaults to DOCKER_HOST or the current docker context)")
+	capacityCmd.Flags().StringVar(&capacityConfig.Docker.Context, "docker-context", "", "Docker context to take the daemon from, ignored when --docker-host is set")
+	capacityCmd.Flags().BoolVar(&capacityConfig.Docker.TLSVerify, "docker-tls-verify", false, "Connect to the docker daemon over TLS and verify its certificate against ca.pem")
+	capacityCmd.Flags().StringVar(&capacityConfig.Docker.CertPath, "docker-cert-path", "", "Directory holding ca.pem, cert.pem and key.pem for connecting to the docker daemon over TLS (default ~/.docker)")
+	capacityCmd.Flags().DurationVar(&capacityConfig.SampleInterval, "sample-interval", docker.DefaultSampleInterval, "How often to sample container resource usage")
+	capacityCmd.Flags().BoolVar(&capacityConfig.TUI, "tui", false, "Show a live dashboard during each trial instead of a progress bar")
+	capacityCmd.Flags().StringToStringVar(&capacityConfig.Tags, "tag", nil, "Tag the results of every trial with a key=value label, can be repeated")
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var cleanupDocker docker.Connection
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Remove containers left behind by --image runs",
+	Long: `Remove every container started by loadship that is still around, running or not.
+
+Containers started with --image are removed when the test ends, including on Ctrl+C. They are only left behind when
+loadship is killed outright, e.g. by a second Ctrl+C or kill -9.
+
+Example usage: loadship cleanup`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		removed, err := docker.RemoveLeftovers(ctx, cleanupDocker)
+
+		for _, name := range removed {
+			fmt.Printf("✓ Removed %s\n", name)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(removed) == 0 {
+			fmt.Println("No containers to remove")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cleanupCmd)
+
+	cleanupCmd.Flags().StringVar(&cleanupDocker.Host, "docker-host", "", "Docker daemon to remove containers from (defaults to DOCKER_HOST or the current docker context)")
+	cleanupCmd.Flags().StringVar(&cleanupDocker.Context, "docker-context", "", "Docker context to take the daemon from, ignored when --docker-host is set")
+	cleanupCmd.Flags().BoolVar(&cleanupDocker.TLSVerify, "docker-tls-verify", false, "Connect to the docker daemon over TLS and verify its certificate against ca.pem")
+	cleanupCmd.Flags().StringVar(&cleanupDocker.CertPath, "docker-cert-path", "", "Directory holding ca.pem, cert.pem and key.pem for connecting to the docker daemon over TLS (default ~/.docker)")
+}
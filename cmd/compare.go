@@ -2,29 +2,49 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
+	"github.com/fireproofpenguin/loadship/internal/baseline"
 	"github.com/fireproofpenguin/loadship/internal/collector"
 	"github.com/fireproofpenguin/loadship/internal/comparison"
+	"github.com/fireproofpenguin/loadship/internal/profile"
 	"github.com/spf13/cobra"
 )
 
+var (
+	baselineSpec string
+	resultsDir   string
+)
+
 var compareCmd = &cobra.Command{
 	Use:   "compare",
 	Short: "Compare test results",
 	Long: `Compare multiple test results and show the differences.
 
-Example usage: loadship compare baseline.json test1.json`,
+Example usage: loadship compare baseline.json test1.json
+
+Aggregates of repeated runs (.aggregate.json) compare the mean of every metric, and report whether each change is
+bigger than the variance between runs:
+	loadship compare baseline.aggregate.json test1.aggregate.json
+
+The baseline can also be selected automatically from previous results using --baseline:
+	loadship compare --baseline latest:env=staging test1.json
+	loadship compare --baseline tag:version=1.4.1 --results-dir ./results test1.json`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 2 {
+		if baselineSpec != "" {
+			if len(args) < 1 {
+				return fmt.Errorf("Please provide at least one test result file to compare against the baseline")
+			}
+		} else if len(args) < 2 {
 			return fmt.Errorf("Please provide at least two test result files to compare")
 		}
 
 		filenames := make(map[string]bool)
 		for _, arg := range args {
-			if filepath.Ext(arg) != ".json" {
-				return fmt.Errorf("All files must be JSON files with .json extension: %s", arg)
+			if !collector.IsResultFile(arg) {
+				return fmt.Errorf("All files must be results in one of the supported formats (%s): %s", strings.Join(collector.ResultExtensions, ", "), arg)
 			}
 
 			if filenames[arg] {
@@ -37,27 +57,64 @@ Example usage: loadship compare baseline.json test1.json`,
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if baselineSpec != "" {
+			baselineFile, err := resolveBaseline(args)
+			if err != nil {
+				return err
+			}
+			args = append([]string{baselineFile}, args...)
+		}
 
+		// outputs holds the first run of an aggregate, runs every run of each file
 		var outputs []*collector.JSONOutput
+		var runs [][]*collector.JSONOutput
+		var repeated bool
 		for _, arg := range args {
-			b, err := os.ReadFile(arg)
-			if err != nil {
-				return fmt.Errorf("Error reading file: %v\n", err)
+			if collector.IsAggregateFile(arg) {
+				aggregate, err := comparison.ReadAggregate(arg)
+				if err != nil {
+					return fmt.Errorf("Error reading aggregate %s: %v\n", arg, err)
+				}
+				aggregateRuns, err := aggregate.ReadRuns(arg)
+				if err != nil {
+					return fmt.Errorf("Error reading aggregate %s: %v\n", arg, err)
+				}
+				if len(aggregateRuns) == 0 {
+					return fmt.Errorf("Aggregate %s has no runs to compare", arg)
+				}
+				outputs = append(outputs, aggregateRuns[0])
+				runs = append(runs, aggregateRuns)
+				repeated = true
+				continue
 			}
-			jsonOutput, err := collector.ReadFromJSON(b)
+
+			jsonOutput, err := collector.ReadFromFile(arg)
 			if err != nil {
-				return fmt.Errorf("Error parsing JSON from file: %v\n", err)
+				return fmt.Errorf("Error reading results from %s: %v\n", arg, err)
 			}
 			outputs = append(outputs, jsonOutput)
+			runs = append(runs, []*collector.JSONOutput{jsonOutput})
+		}
+
+		var comparisons []*comparison.ComparisonReport
+		if repeated {
+			for _, test := range runs[1:] {
+				comparisons = append(comparisons, comparison.CompareRepeated(runs[0], test))
+			}
+		} else {
+			comparisons = comparison.Compare(outputs)
 		}
 
-		comparisons := comparison.Compare(outputs)
 		fmt.Println("=== Comparing Test Results ===")
 		for i, file := range args {
-			if i == 0 {
-				fmt.Printf("Baseline: %s (%v)\n", file, outputs[i].Metadata.Timestamp)
+			name := "Baseline"
+			if i > 0 {
+				name = fmt.Sprintf("Test %d", i)
+			}
+			if len(runs[i]) > 1 {
+				fmt.Printf("%s: %s (%d runs from %v)\n", name, file, len(runs[i]), outputs[i].Metadata.Timestamp)
 			} else {
-				fmt.Printf("Test %d: %s (%v)\n", i, file, outputs[i].Metadata.Timestamp)
+				fmt.Printf("%s: %s (%v)\n", name, file, outputs[i].Metadata.Timestamp)
 			}
 		}
 
@@ -74,10 +131,95 @@ Example usage: loadship compare baseline.json test1.json`,
 		}
 
 		comparison.PrintComparisonReports(outputs[0], comparisons)
+		if repeated {
+			for i, report := range comparisons {
+				report.PrintVerdict(fmt.Sprintf("Test %d", i+1))
+			}
+		}
+		printProfiles(args, outputs)
 		return nil
 	},
 }
 
+// printProfiles lists the profiles captured during each run, with the command to diff a test's against the
+// baseline's when both captured the same profile at the same moment
+func printProfiles(files []string, outputs []*collector.JSONOutput) {
+	if !slices.ContainsFunc(outputs, func(o *collector.JSONOutput) bool { return len(o.Profiles) > 0 }) {
+		return
+	}
+
+	path := func(i int, capture profile.Capture) string {
+		return filepath.Join(filepath.Dir(files[i]), filepath.FromSlash(capture.File))
+	}
+
+	fmt.Println("\n=== Profiles ===")
+	for i, output := range outputs {
+		for _, capture := range output.Profiles {
+			name := "Baseline"
+			if i > 0 {
+				name = fmt.Sprintf("Test %d", i)
+			}
+			fmt.Printf("%s: %s at %s: %s\n", name, capture.Type, capture.At, path(i, capture))
+
+			if i == 0 {
+				continue
+			}
+			for _, base := range outputs[0].Profiles {
+				if base.Type == capture.Type && base.At == capture.At {
+					fmt.Printf("\tgo tool pprof -http=: -diff_base %s %s\n", path(0, base), path(i, capture))
+				}
+			}
+		}
+	}
+}
+
+// resolveBaseline finds the baseline result matching --baseline for the first test file
+func resolveBaseline(tests []string) (string, error) {
+	selector, err := baseline.ParseSelector(baselineSpec)
+	if err != nil {
+		return "", fmt.Errorf("Invalid baseline: %v", err)
+	}
+
+	if selector.IsFile() {
+		if !collector.IsResultFile(selector.Path) {
+			return "", fmt.Errorf("All files must be results in one of the supported formats (%s): %s", strings.Join(collector.ResultExtensions, ", "), selector.Path)
+		}
+		if slices.Contains(tests, selector.Path) {
+			return "", fmt.Errorf("Duplicate file provided: %s. Please provide different test result files to compare", selector.Path)
+		}
+		return selector.Path, nil
+	}
+
+	target, err := collector.ReadMetadataFromFile(tests[0])
+	if err != nil {
+		return "", fmt.Errorf("Error reading results from %s: %v\n", tests[0], err)
+	}
+
+	// The runs of an aggregate are as much the test as the aggregate itself
+	exclude := slices.Clone(tests)
+	for _, test := range tests {
+		if !collector.IsAggregateFile(test) {
+			continue
+		}
+		aggregate, err := comparison.ReadAggregate(test)
+		if err != nil {
+			return "", fmt.Errorf("Error reading aggregate %s: %v\n", test, err)
+		}
+		exclude = append(exclude, aggregate.RunFiles(test)...)
+	}
+
+	baselineFile, err := baseline.Resolve(resultsDir, selector, *target, exclude...)
+	if err != nil {
+		return "", fmt.Errorf("Unable to resolve baseline %q: %v", baselineSpec, err)
+	}
+
+	fmt.Printf("Resolved baseline %q to %s\n", baselineSpec, baselineFile)
+	return baselineFile, nil
+}
+
 func init() {
 	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringVarP(&baselineSpec, "baseline", "b", "", "Baseline to compare against: a file, latest[:key=value,...] or tag:key=value[,...]")
+	compareCmd.Flags().StringVar(&resultsDir, "results-dir", ".", "Directory searched for previous results when resolving --baseline")
 }
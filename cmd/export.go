@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/export"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat string
+	exportOutput string
+	exportFrom   time.Duration
+	exportTo     time.Duration
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export <result-file>",
+	Short: "Export raw samples to CSV or Parquet",
+	Long: `Export the raw samples from a result file as separate tables for analysis in tools like pandas or DuckDB.
+
+HTTP requests are written to <output>_http.<format> and docker samples, when present, to <output>_docker.<format>.
+Container events such as OOM kills and restarts are written to <output>_events.<format>.
+
+Example usage:
+	loadship export baseline.json --format parquet
+	loadship export baseline.json --format csv --from 10s --to 40s -o steady_state`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("must provide a result file to export")
+		}
+
+		if !collector.IsResultFile(args[0]) {
+			return fmt.Errorf("must provide results in one of the supported formats: %s", strings.Join(collector.ResultExtensions, ", "))
+		}
+
+		if !slices.Contains(export.Formats, exportFormat) {
+			return fmt.Errorf("--format must be one of %s", strings.Join(export.Formats, ", "))
+		}
+
+		if exportFrom < 0 || exportTo < 0 {
+			return fmt.Errorf("--from and --to cannot be negative")
+		}
+
+		if exportTo > 0 && exportTo <= exportFrom {
+			return fmt.Errorf("--to must be after --from")
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := args[0]
+
+		output, err := collector.ReadFromFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading results from %s: %w", file, err)
+		}
+
+		prefix := exportOutput
+		if prefix == "" {
+			prefix = collector.TrimResultExt(file)
+		}
+
+		window := export.Window{From: exportFrom, To: exportTo}
+
+		files, err := export.Write(output, exportFormat, prefix, window)
+
+		for _, f := range files {
+			fmt.Printf("✓ Exported %s\n", f)
+		}
+
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "csv", "Export format: csv or parquet")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Prefix for the exported files (defaults to the result file name without its extension)")
+	exportCmd.Flags().DurationVar(&exportFrom, "from", 0, "Only export samples taken at least this long after the test started (e.g. 10s)")
+	exportCmd.Flags().DurationVar(&exportTo, "to", 0, "Only export samples taken up to this long after the test started (e.g. 50s)")
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate <result-file>...",
+	Short: "Upgrade result files to the current format",
+	Long: `Rewrite result files from older versions of loadship in place using the current result format.
+
+Older files can still be read by report and compare without migrating, but migrating avoids upgrading them on every read.
+
+Example usage: loadship migrate baseline.json results/*.json`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("must provide at least one result file to migrate")
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var failed int
+
+		for _, file := range args {
+			err := migrateFile(file)
+
+			if err != nil {
+				fmt.Printf("✗ %s: %v\n", file, err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d/%d files could not be migrated", failed, len(args))
+		}
+
+		return nil
+	},
+}
+
+func migrateFile(file string) error {
+	if !collector.IsResultFile(file) {
+		return fmt.Errorf("unsupported result file extension, must be one of %s", strings.Join(collector.ResultExtensions, ", "))
+	}
+
+	output, err := collector.ReadFromFile(file)
+	if err != nil {
+		return err
+	}
+
+	version := output.OriginalSchemaVersion()
+
+	if version == collector.SchemaVersion {
+		fmt.Printf("✓ %s: already at schema version %d\n", file, version)
+		return nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted migration never leaves a truncated result behind.
+	// It keeps the original extension so the same format and compression are used.
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".migrate-*"+collector.ResultExt(file))
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := output.SaveToFile(tmp.Name()); err != nil {
+		return fmt.Errorf("error writing migrated file: %w", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("error replacing file: %w", err)
+	}
+
+	fmt.Printf("✓ %s: migrated from schema version %d to %d\n", file, version, collector.SchemaVersion)
+	return nil
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema for result files",
+	Long: `Print the JSON Schema describing the result files written by --json, so other tools can validate them.
+
+Example usage: loadship schema > loadship.schema.json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Stdout.Write(collector.Schema())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(schemaCmd)
+}
@@ -3,8 +3,8 @@ package cmd
 import (
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fireproofpenguin/loadship/internal/collector"
 	"github.com/fireproofpenguin/loadship/internal/report"
@@ -34,20 +34,14 @@ var reportCmd = &cobra.Command{
 			return
 		}
 
-		if filepath.Ext(filePath) != ".json" {
-			log.Fatalf("Must provide results in JSON format only")
+		if !collector.IsResultFile(filePath) {
+			log.Fatalf("Must provide results in one of the supported formats: %s", strings.Join(collector.ResultExtensions, ", "))
 		}
 
-		b, err := os.ReadFile(filePath)
+		output, err := collector.ReadFromFile(filePath)
 
 		if err != nil {
-			log.Fatalf("Error reading file: %v\n", err)
-		}
-
-		output, err := collector.ReadFromJSON(b)
-
-		if err != nil {
-			log.Fatalf("Error parsing JSON from file: %v\n", err)
+			log.Fatalf("Error reading results from file: %v\n", err)
 		}
 
 		report.Write(output, reportName)
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -32,6 +35,14 @@ loadship run http://localhost:8080`,
 	},
 }
 
+// interruptContext is cancelled on Ctrl+C or SIGTERM, so a test stops and removes the containers it started instead of
+// the process being killed with them still running. A second signal kills it as usual.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	return ctx, stop
+}
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
@@ -1,31 +1,78 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 
+	"github.com/fireproofpenguin/loadship/internal/abort"
+	"github.com/fireproofpenguin/loadship/internal/baseline"
 	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/comparison"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/metrics"
+	"github.com/fireproofpenguin/loadship/internal/notify"
 	"github.com/fireproofpenguin/loadship/internal/orchestrator"
+	"github.com/fireproofpenguin/loadship/internal/process"
+	"github.com/fireproofpenguin/loadship/internal/profile"
 	"github.com/fireproofpenguin/loadship/internal/report"
+	"github.com/fireproofpenguin/loadship/internal/scrape"
+	"github.com/fireproofpenguin/loadship/internal/sink"
+	"github.com/fireproofpenguin/loadship/internal/telemetry"
 	"github.com/spf13/cobra"
 )
 
 var (
 	duration       time.Duration
 	connections    int
-	containerName  string
+	containerNames []string
+	composeProject string
+	labels         map[string]string
+	pids           []int
+	processNames   []string
+	cgroups        []string
+	sampleInterval time.Duration
+	dockerConn     docker.Connection
+	managedSpec    docker.ContainerSpec
 	jsonFile       string
 	generateReport bool
+	captureLogs    bool
+	logPatterns    []string
+	scrapeConfig   scrape.Config
+	profileConfig  profile.Config
+	tags           map[string]string
+	showTUI        bool
+	metricsAddr    string
+	otelEnabled    bool
+	otelConfig     telemetry.Config
+	sinkSpecs      []string
+	webhookSpecs   []string
+	runBaseline    string
+	runResultsDir  string
+	repeat         int
+	repeatCooldown time.Duration
+	abortConfig    abort.Config
 )
 
 var runCmd = &cobra.Command{
-	Use:   "run <target-url>",
+	Use:   "run [target-url]",
 	Short: "Run load tests against a target service",
-	Long:  `Run a load test against a service, with or without docker.`,
+	Long: `Run a load test against a service, with or without docker.
+
+With --image the target is started from an image for the run, monitored, then stopped and removed. The target URL
+defaults to the root of the published --port.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 1 {
+		if managedSpec.Image != "" {
+			if err := managedSpec.Validate(); err != nil {
+				return err
+			}
+			if len(args) < 1 && managedSpec.Port == "" {
+				return fmt.Errorf("must provide target URL or --port")
+			}
+		} else if len(args) < 1 {
 			return fmt.Errorf("must provide target URL")
 		}
 
@@ -33,62 +80,318 @@ var runCmd = &cobra.Command{
 			return fmt.Errorf("must have at least one connection")
 		}
 
+		if sampleInterval < docker.MinSampleInterval {
+			return fmt.Errorf("--sample-interval must be at least %s", docker.MinSampleInterval)
+		}
+
 		if generateReport && jsonFile == "" {
 			return fmt.Errorf("--report requires --json to be specified")
 		}
 
-		return nil
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-		url := args[0]
-		testStart := time.Now()
+		if err := otelConfig.Validate(); err != nil {
+			return err
+		}
 
-		config := collector.TestConfig{
-			URL:           url,
-			Timestamp:     testStart,
-			Duration:      duration,
-			Connections:   connections,
-			ContainerName: containerName,
+		for _, spec := range sinkSpecs {
+			if err := sink.Validate(spec); err != nil {
+				return err
+			}
 		}
 
-		httpResults, dockerResults, err := orchestrator.Orchestrate(config)
+		if _, err := notify.ParseWebhooks(webhookSpecs); err != nil {
+			return err
+		}
 
-		if err != nil {
-			log.Fatalf("Error during test orchestration: %v", err)
+		if runBaseline != "" {
+			if _, err := baseline.ParseSelector(runBaseline); err != nil {
+				return fmt.Errorf("invalid baseline: %w", err)
+			}
 		}
 
-		fmt.Printf("\nLoad test complete. Processing results...\n")
+		if len(logPatterns) > 0 {
+			captureLogs = true
+			if _, err := collector.CompileLogPatterns(logPatterns); err != nil {
+				return err
+			}
+		}
+
+		if len(scrapeConfig.URLs) > 0 || len(scrapeConfig.Metrics) > 0 {
+			if err := scrapeConfig.Validate(); err != nil {
+				return err
+			}
+		}
+
+		if profileConfig.URL != "" {
+			if err := profileConfig.Validate(); err != nil {
+				return err
+			}
+			if jsonFile == "" {
+				return fmt.Errorf("--pprof-url requires --json to be specified, the profiles are saved alongside the results")
+			}
+		}
 
-		metrics := collector.Calculate(httpResults, dockerResults, duration)
-		metrics.PrettyPrint()
+		if abortConfig.Enabled() {
+			if err := abortConfig.Validate(); err != nil {
+				return err
+			}
+		}
 
-		if jsonFile != "" {
-			metricsOutput := collector.ToJSONOutput(httpResults, dockerResults, config, *metrics)
+		if captureLogs && jsonFile == "" {
+			return fmt.Errorf("--logs requires --json to be specified, the logs are saved alongside the results")
+		}
 
-			err := metricsOutput.SaveToFile(jsonFile)
+		if repeat < 1 {
+			return fmt.Errorf("--repeat must be at least 1")
+		}
+
+		if repeat > 1 && jsonFile == "" {
+			return fmt.Errorf("--repeat requires --json to be specified, each run is saved with its number appended along with an aggregate of them all")
+		}
+
+		if jsonFile != "" && collector.IsAggregateFile(jsonFile) {
+			return fmt.Errorf("--json cannot end in %s, it is reserved for aggregates of repeated runs", collector.AggregateExt)
+		}
+
+		if jsonFile != "" && !collector.IsResultFile(jsonFile) {
+			return fmt.Errorf("--json must end in one of %s", strings.Join(collector.ResultExtensions, ", "))
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var url string
+		if len(args) > 0 {
+			url = args[0]
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+
+		if repeat <= 1 {
+			output, err := runLoadTest(ctx, url, jsonFile)
 
 			if err != nil {
-				fmt.Println("Error saving JSON file:", err)
-				return
+				log.Fatalf("Load test failed: %v", err)
 			}
+			if output.Abort != nil {
+				log.Fatalf("Load test %s", output.Abort)
+			}
+			return
+		}
 
-			fmt.Printf("\n✓ Results saved to %s\n", jsonFile)
+		var files []string
+		var outputs []*collector.JSONOutput
+		for i := range repeat {
+			fmt.Printf("Run (%d/%d)\n", i+1, repeat)
 
-			if generateReport {
-				reportName := strings.TrimSuffix(jsonFile, ".json")
+			// A failed run is skipped rather than losing the runs before it. Aborted runs only cover part of the
+			// duration, so they would skew the aggregate.
+			file := collector.RepeatFile(jsonFile, i+1)
+			output, err := runLoadTest(ctx, url, file)
 
-				report.Write(&metricsOutput, reportName)
+			if errors.Is(err, orchestrator.ErrInterrupted) {
+				log.Fatalf("Load test failed: %v", err)
+			} else if err != nil {
+				fmt.Printf("Run %d failed: %v\n", i+1, err)
+			} else if output.Abort != nil {
+				fmt.Printf("Run %d %s\n", i+1, output.Abort)
+			} else {
+				files = append(files, file)
+				outputs = append(outputs, output)
 			}
+
+			if i < repeat-1 {
+				orchestrator.Cooldown(ctx, repeatCooldown)
+			}
+		}
+
+		if len(outputs) < 2 {
+			log.Fatalf("Only %d of %d runs completed, not enough for an aggregate", len(outputs), repeat)
 		}
+
+		aggregate := comparison.NewAggregate(files, outputs)
+		aggregate.Print()
+
+		aggregateFile := collector.TrimResultExt(jsonFile) + collector.AggregateExt
+		if err := aggregate.SaveToFile(aggregateFile); err != nil {
+			log.Fatalf("Error saving aggregate: %v", err)
+		}
+		fmt.Printf("\n✓ Aggregate of %d runs saved to %s\n", len(outputs), aggregateFile)
 	},
 }
 
+// runLoadTest runs a single load test, saving its results to resultFile when set, and returns them. A container
+// started from --image is removed however the test ends.
+func runLoadTest(ctx context.Context, url, resultFile string) (*collector.JSONOutput, error) {
+	containers, err := docker.ResolveContainers(ctx, dockerConn, docker.Selector{
+		Names:          containerNames,
+		ComposeProject: composeProject,
+		Labels:         labels,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error finding containers to monitor: %w", err)
+	}
+
+	test := orchestrator.Test{
+		Config: collector.TestConfig{
+			URL:            url,
+			Duration:       duration,
+			Connections:    connections,
+			Containers:     containers,
+			Processes:      process.Targets(pids, processNames, cgroups),
+			SampleInterval: sampleInterval,
+			Logs:           captureLogs,
+			LogPatterns:    logPatterns,
+			Tags:           tags,
+		},
+		ResultFile: resultFile,
+		Run:        1,
+		Options:    orchestrator.Options{TUI: showTUI, Docker: dockerConn},
+	}
+
+	if managedSpec.Image != "" {
+		test.Managed = &managedSpec
+	}
+
+	if len(scrapeConfig.URLs) > 0 {
+		test.Scrape = &scrapeConfig
+	}
+
+	if profileConfig.URL != "" {
+		test.Profile = &profileConfig
+	}
+
+	if abortConfig.Enabled() {
+		test.Config.Abort = &abortConfig
+	}
+
+	if metricsAddr != "" {
+		test.Exporter = metrics.New()
+
+		if err := test.Exporter.Serve(metricsAddr); err != nil {
+			return nil, fmt.Errorf("error starting metrics endpoint: %w", err)
+		}
+		defer test.Exporter.Shutdown(context.Background())
+	}
+
+	if otelEnabled || otelConfig.Endpoint != "" || otelConfig.Traces {
+		test.Telemetry, err = telemetry.New(context.Background(), otelConfig)
+
+		if err != nil {
+			return nil, fmt.Errorf("error setting up OpenTelemetry export: %w", err)
+		}
+		defer shutdownTelemetry(test.Telemetry)
+	}
+
+	if len(sinkSpecs) > 0 {
+		test.Sinks, err = sink.OpenAll(sinkSpecs)
+
+		if err != nil {
+			return nil, fmt.Errorf("error opening results sink: %w", err)
+		}
+		defer sink.CloseAll(test.Sinks)
+	}
+
+	// Already validated in PreRunE
+	webhooks, _ := notify.ParseWebhooks(webhookSpecs)
+
+	config, output, err := orchestrator.RunTest(ctx, test)
+
+	if err != nil {
+		notify.Send(webhooks, notify.NewRunEvent(notify.RunResult{Config: config, Error: err.Error()}))
+		return nil, err
+	}
+
+	if output.Abort != nil {
+		fmt.Printf("\nLoad test %s. Processing partial results...\n", output.Abort)
+	} else {
+		fmt.Printf("\nLoad test complete. Processing results...\n")
+	}
+
+	output.Summary.PrettyPrint()
+
+	result := notify.RunResult{Config: config, Metrics: &output.Summary, Aborted: output.Abort}
+
+	if resultFile != "" {
+		fmt.Printf("\n✓ Results saved to %s\n", resultFile)
+		result.ResultFile = resultFile
+
+		if generateReport {
+			reportName := collector.TrimResultExt(resultFile)
+
+			result.ReportFile = report.Write(output, reportName)
+		}
+	}
+
+	if runBaseline != "" {
+		result.Comparison = notify.CompareToBaseline(runBaseline, runResultsDir, output, resultFile)
+	}
+
+	notify.Send(webhooks, notify.NewRunEvent(result))
+	return output, nil
+}
+
+// shutdownTelemetry flushes anything still buffered, without holding up the exit for an unreachable collector
+func shutdownTelemetry(t *telemetry.Telemetry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := t.Shutdown(ctx); err != nil {
+		fmt.Println("Error flushing OpenTelemetry data:", err)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
 
 	runCmd.Flags().DurationVarP(&duration, "duration", "d", time.Second*30, "Duration of the load test (e.g., 10s, 1m)")
-	runCmd.Flags().StringVar(&containerName, "container", "", "Docker container name or id to monitor")
+	runCmd.Flags().StringArrayVar(&containerNames, "container", nil, "Docker container name or id to monitor, can be repeated")
+	runCmd.Flags().StringVar(&composeProject, "compose-project", "", "Monitor every running container of this docker compose project")
+	runCmd.Flags().StringToStringVar(&labels, "label", nil, "Monitor every running container with this key=value label, can be repeated to require several labels")
+	runCmd.Flags().IntSliceVar(&pids, "pid", nil, "Monitor a host process by pid without docker (Linux only), can be repeated")
+	runCmd.Flags().StringArrayVar(&processNames, "process-name", nil, "Monitor every host process with this name without docker (Linux only), can be repeated")
+	runCmd.Flags().StringArrayVar(&cgroups, "cgroup", nil, "Monitor a cgroup v2 group, absolute or relative to /sys/fs/cgroup (Linux only), can be repeated")
+	runCmd.Flags().StringVar(&dockerConn.Host, "docker-host", "", "Docker daemon to monitor containers through, e.g. ssh://user@host, tcp://host:2376 or unix:///run/podman/podman.sock (defaults to DOCKER_HOST or the current docker context)")
+	runCmd.Flags().StringVar(&dockerConn.Context, "docker-context", "", "Docker context to take the daemon from, ignored when --docker-host is set")
+	runCmd.Flags().BoolVar(&dockerConn.TLSVerify, "docker-tls-verify", false, "Connect to the docker daemon over TLS and verify its certificate against ca.pem")
+	runCmd.Flags().StringVar(&dockerConn.CertPath, "docker-cert-path", "", "Directory holding ca.pem, cert.pem and key.pem for connecting to the docker daemon over TLS (default ~/.docker)")
+	runCmd.Flags().StringVar(&managedSpec.Image, "image", "", "Start the target from this image for the run, then stop and remove it afterwards")
+	runCmd.Flags().StringVar(&managedSpec.Port, "port", "", "Container port to publish with --image, or host:container (e.g. 8080 or 9000:8080)")
+	runCmd.Flags().StringArrayVar(&managedSpec.Env, "env", nil, "KEY=VALUE environment variable for the --image container, can be repeated")
+	runCmd.Flags().StringVar(&managedSpec.Memory, "memory", "", "Memory limit of the --image container (e.g. 512m)")
+	runCmd.Flags().Float64Var(&managedSpec.CPUs, "cpus", 0, "CPU limit of the --image container (e.g. 1.5)")
+	runCmd.Flags().DurationVar(&managedSpec.ReadyTimeout, "ready-timeout", docker.DefaultReadyTimeout, "How long the --image container has to pass its healthcheck and answer HTTP requests")
+	runCmd.Flags().StringArrayVar(&scrapeConfig.URLs, "scrape", nil, "Scrape a Prometheus metrics endpoint during the test, a URL or a path on the target such as /metrics, can be repeated")
+	runCmd.Flags().StringArrayVar(&scrapeConfig.Metrics, "scrape-metric", nil, "Metric to record from the scraped endpoints, e.g. go_gc_duration_seconds or db_pool_in_use, can be repeated")
+	runCmd.Flags().DurationVar(&scrapeConfig.Interval, "scrape-interval", 0, "How often to scrape the metrics endpoints (defaults to --sample-interval)")
+	runCmd.Flags().StringVar(&profileConfig.URL, "pprof-url", "", "Capture profiles from the target's net/http/pprof, a URL such as http://localhost:6060/debug/pprof or a path on the target such as /debug/pprof")
+	runCmd.Flags().StringSliceVar(&profileConfig.Profiles, "pprof-profile", nil, "Profiles to capture: cpu, heap, allocs, goroutine, mutex or block (default cpu,heap,goroutine,mutex)")
+	runCmd.Flags().StringSliceVar(&profileConfig.At, "pprof-at", nil, "When to capture the profiles: start, middle, end, an offset such as 30s or a percentage such as 75% (default end)")
+	runCmd.Flags().DurationVar(&profileConfig.CPUDuration, "pprof-cpu-duration", profile.DefaultCPUDuration, "How long to profile the CPU for at each moment")
+	runCmd.Flags().DurationVar(&sampleInterval, "sample-interval", docker.DefaultSampleInterval, "How often to sample container and process resource usage (e.g. 250ms for short spiky tests, 10s for soak tests)")
 	runCmd.Flags().IntVarP(&connections, "connections", "c", 10, "Number of concurrent connections to use during the load test")
-	runCmd.Flags().StringVarP(&jsonFile, "json", "j", "", "Output results to a JSON file")
+	runCmd.Flags().IntVar(&repeat, "repeat", 1, "Run the test this many times, saving each run and an aggregate with the mean, standard deviation and confidence interval of every metric")
+	runCmd.Flags().DurationVar(&repeatCooldown, "cooldown", 10*time.Second, "Time to wait between repeated runs")
+	runCmd.Flags().StringVarP(&jsonFile, "json", "j", "", "Output results to a file: .json, .json.gz, .json.zst or an .ndjson stream (optionally .gz/.zst) written during the test")
 	runCmd.Flags().BoolVar(&generateReport, "report", false, "Generate an HTML report")
+	runCmd.Flags().BoolVar(&captureLogs, "logs", false, "Save the monitored containers' stdout and stderr during the test to a .log file next to --json, and chart the lines logged per second")
+	runCmd.Flags().StringArrayVar(&logPatterns, "log-pattern", nil, "Count the log lines matching this regular expression (e.g. ERROR or (?i)panic), can be repeated. Implies --logs")
+	runCmd.Flags().BoolVar(&showTUI, "tui", false, "Show a live dashboard of the running test instead of a progress bar")
+	runCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "Serve live test metrics for Prometheus on this address during the test (e.g. :9100)")
+	runCmd.Flags().BoolVar(&otelEnabled, "otel", false, "Export metrics over OTLP, configured by the standard OTEL_EXPORTER_OTLP_* environment variables unless --otel-endpoint is set")
+	runCmd.Flags().StringVar(&otelConfig.Endpoint, "otel-endpoint", "", "host:port of the OTLP collector to export metrics to (implies --otel)")
+	runCmd.Flags().StringVar(&otelConfig.Protocol, "otel-protocol", "grpc", "OTLP protocol: grpc or http")
+	runCmd.Flags().BoolVar(&otelConfig.Insecure, "otel-insecure", false, "Connect to the OTLP collector without TLS")
+	runCmd.Flags().BoolVar(&otelConfig.Traces, "otel-traces", false, "Emit a client span for every request and propagate it to the target with a traceparent header (implies --otel)")
+	runCmd.Flags().StringArrayVar(&sinkSpecs, "sink", nil, "Stream per-second aggregates and docker samples to a sink during the test, can be repeated: influx=<file or write url>, statsd=<host:port> or dogstatsd=<host:port>")
+	runCmd.Flags().StringArrayVar(&webhookSpecs, "webhook", nil, "POST a summary to this URL when the test finishes, can be repeated. Prefix with slack= for a Slack incoming webhook")
+	runCmd.Flags().StringVar(&runBaseline, "baseline", "", "Compare the results against a baseline, included in webhook notifications: a file, latest[:key=value,...] or tag:key=value[,...]")
+	runCmd.Flags().StringVar(&runResultsDir, "results-dir", ".", "Directory searched for previous results when resolving --baseline")
+	runCmd.Flags().Float64Var(&abortConfig.ErrorRate, "abort-error-rate", 0, "Stop the test early once more than this percentage of requests fail within --abort-window (e.g. 50)")
+	runCmd.Flags().DurationVar(&abortConfig.Window, "abort-window", abort.DefaultWindow, "How far back --abort-error-rate looks")
+	runCmd.Flags().DurationVar(&abortConfig.P99, "abort-p99", 0, "Stop the test early once the p99 latency has been above this for --abort-p99-for (e.g. 2s)")
+	runCmd.Flags().DurationVar(&abortConfig.P99For, "abort-p99-for", abort.DefaultP99For, "How long the p99 latency has to stay above --abort-p99")
+	runCmd.Flags().StringVar(&abortConfig.Memory, "abort-memory", "", "Stop the test early once a container uses more than this memory, a size such as 900m or a percentage of its limit such as 95%")
+	runCmd.Flags().StringToStringVar(&tags, "tag", nil, "Tag the results with a key=value label, can be repeated (e.g. --tag version=1.4.2 --tag env=staging)")
 }
@@ -9,6 +9,12 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	suiteTUI         bool
+	suiteMetricsAddr string
+	suiteWebhooks    []string
+)
+
 var suiteCmd = &cobra.Command{
 	Use:   "suite",
 	Short: "Run a suite of load tests",
@@ -37,13 +43,26 @@ var suiteCmd = &cobra.Command{
 			return fmt.Errorf("error parsing config file: %w", err)
 		}
 
+		if suiteTUI {
+			config.TUI = true
+		}
+
+		if suiteMetricsAddr != "" {
+			config.MetricsAddr = suiteMetricsAddr
+		}
+
+		config.Webhooks = append(config.Webhooks, suiteWebhooks...)
+
 		err = config.Validate()
 
 		if err != nil {
 			return fmt.Errorf("suite config contains 1 or more errors: %w", err)
 		}
 
-		err = suite.Start(config)
+		ctx, stop := interruptContext()
+		defer stop()
+
+		err = suite.Start(ctx, config)
 
 		if err != nil {
 			return fmt.Errorf("error running test suite: %w", err)
@@ -55,4 +74,8 @@ var suiteCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(suiteCmd)
+
+	suiteCmd.Flags().StringVar(&suiteMetricsAddr, "metrics-addr", "", "Serve live test metrics for Prometheus on this address for the whole suite (e.g. :9100)")
+	suiteCmd.Flags().StringArrayVar(&suiteWebhooks, "webhook", nil, "POST a summary of every run to this URL when the suite finishes, in addition to any in the config. Prefix with slack= for a Slack incoming webhook")
+	suiteCmd.Flags().BoolVar(&suiteTUI, "tui", false, "Show a live dashboard during each run instead of a progress bar")
 }
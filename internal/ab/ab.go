@@ -0,0 +1,257 @@
+package ab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/comparison"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/orchestrator"
+)
+
+// Orders the baseline and candidate runs can be scheduled in
+const (
+	// OrderInterleaved alternates baseline and candidate runs, so drift on the host affects both alike
+	OrderInterleaved = "interleaved"
+	// OrderSequential runs every baseline run before the candidate's
+	OrderSequential = "sequential"
+)
+
+// Target is one side of an A/B test: a URL, or an image started for every run
+type Target struct {
+	URL   string
+	Image string
+	// Containers are monitored during the side's runs, alongside the container started from Image
+	Containers []string
+}
+
+// imagePrefix marks a target as an image when it could also be read as a URL without a scheme
+const imagePrefix = "image:"
+
+// ParseTarget reads an http(s) URL as a URL and anything else as an image. A host and port without a scheme, e.g.
+// localhost:8080 or api.internal:80/health, is rejected rather than guessed, as it reads as an image from a registry
+// too; image: forces an image.
+func ParseTarget(s string) (Target, error) {
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return Target{URL: s}, nil
+	}
+	if image, ok := strings.CutPrefix(s, imagePrefix); ok {
+		return Target{Image: image}, nil
+	}
+	if looksLikeHost(s) {
+		return Target{}, fmt.Errorf("%q could be a URL or an image: write http://%s for a URL, or %s%s for an image", s, s, imagePrefix, s)
+	}
+	return Target{Image: s}, nil
+}
+
+// looksLikeHost reports whether s starts with a host and port, e.g. localhost:8080 or 10.0.0.5:80/health, rather than
+// an image name and tag like myapp:1.4.2
+func looksLikeHost(s string) bool {
+	first, _, _ := strings.Cut(s, "/")
+	host, port, found := strings.Cut(first, ":")
+	if !found {
+		return false
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return false
+	}
+	return host == "localhost" || net.ParseIP(host) != nil || strings.Contains(host, ".")
+}
+
+func (t Target) String() string {
+	if t.Image != "" {
+		return t.Image
+	}
+	return t.URL
+}
+
+type Config struct {
+	Baseline  Target
+	Candidate Target
+	// Duration and Connections are the same for every run of both sides
+	Duration    time.Duration
+	Connections int
+	// Repeat is how many times each side is run
+	Repeat   int
+	Order    string
+	Cooldown time.Duration
+	// Managed is how image targets are started, its Image is replaced by each side's
+	Managed        docker.ContainerSpec
+	Docker         docker.Connection
+	SampleInterval time.Duration
+	Tags           map[string]string
+	TUI            bool
+	// Directory the results of every run are saved to
+	Directory string
+}
+
+func (c *Config) Validate() error {
+	if c.Baseline.String() == "" || c.Candidate.String() == "" {
+		return fmt.Errorf("must provide both a baseline and a candidate")
+	}
+	if c.Connections <= 0 {
+		return fmt.Errorf("must have at least one connection")
+	}
+	if c.Duration <= 0 {
+		return fmt.Errorf("duration must be greater than 0")
+	}
+	if c.Repeat <= 0 {
+		return fmt.Errorf("repeat must be at least 1")
+	}
+	if c.Order != OrderInterleaved && c.Order != OrderSequential {
+		return fmt.Errorf("order must be %s or %s", OrderInterleaved, OrderSequential)
+	}
+	if c.Cooldown < 0 {
+		return fmt.Errorf("cooldown duration cannot be negative")
+	}
+	for _, target := range []Target{c.Baseline, c.Candidate} {
+		if target.Image == "" {
+			continue
+		}
+		spec := c.Managed
+		spec.Image = target.Image
+		if err := spec.Validate(); err != nil {
+			return err
+		}
+		if spec.Port == "" {
+			return fmt.Errorf("image %s needs a port to publish", target.Image)
+		}
+	}
+	return nil
+}
+
+// side is a single run in the schedule
+type side struct {
+	name   string
+	target Target
+	repeat int
+}
+
+// schedule returns the runs in the order they should happen
+func (c *Config) schedule() []side {
+	var baseline, candidate []side
+	for i := range c.Repeat {
+		baseline = append(baseline, side{name: "baseline", target: c.Baseline, repeat: i + 1})
+		candidate = append(candidate, side{name: "candidate", target: c.Candidate, repeat: i + 1})
+	}
+
+	if c.Order == OrderSequential {
+		return append(baseline, candidate...)
+	}
+
+	var runs []side
+	for i := range c.Repeat {
+		runs = append(runs, baseline[i], candidate[i])
+	}
+	return runs
+}
+
+// Result is the comparison of the candidate against the baseline, made from the runs of each side that completed
+type Result struct {
+	Report *comparison.ComparisonReport
+	// Baselines and Candidates are how many runs of each side were compared
+	Baselines  int
+	Candidates int
+	// Failed are the runs that failed or were aborted, left out of the comparison
+	Failed []string
+}
+
+// Start runs identical load against the baseline and the candidate, saving each run's results, and compares the
+// candidate against the baseline. A failed run is skipped, the test only fails when a side is left with too few runs
+// to compare.
+func Start(ctx context.Context, config Config) (*Result, error) {
+	if err := os.MkdirAll(config.Directory, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating results directory: %w", err)
+	}
+
+	runs := config.schedule()
+	var baselines, candidates []*collector.JSONOutput
+	var failed []string
+
+	for i, run := range runs {
+		fmt.Printf("Run (%d/%d): %s %d/%d against %s\n", i+1, len(runs), run.name, run.repeat, config.Repeat, run.target)
+
+		filename := fmt.Sprintf("%s/%s_%d.json", config.Directory, run.name, run.repeat)
+		output, err := runOnce(ctx, config, run, filename)
+
+		if errors.Is(err, orchestrator.ErrInterrupted) {
+			return nil, err
+		}
+
+		// Aborted runs only cover part of the duration, so they would skew the comparison
+		if err == nil && output.Abort != nil {
+			err = fmt.Errorf("%s", output.Abort)
+		}
+
+		if err != nil {
+			fmt.Printf("%s run %d failed: %v\n", run.name, run.repeat, err)
+			failed = append(failed, fmt.Sprintf("%s run %d: %v", run.name, run.repeat, err))
+		} else {
+			requests := output.Summary.HTTPMetrics
+			fmt.Printf("✓ %.2f RPS, p95 %d ms, %d failed. Results saved to %s\n", requests.Requests.Rps, requests.Latency.P95, requests.Requests.Failed, filename)
+
+			if run.name == "baseline" {
+				baselines = append(baselines, output)
+			} else {
+				candidates = append(candidates, output)
+			}
+		}
+
+		if i < len(runs)-1 {
+			orchestrator.Cooldown(ctx, config.Cooldown)
+		}
+	}
+
+	// Repeated sides need at least two runs for the spread between them
+	need := min(config.Repeat, 2)
+	if len(baselines) < need || len(candidates) < need {
+		return nil, fmt.Errorf("only %d baseline and %d candidate runs completed, not enough to compare", len(baselines), len(candidates))
+	}
+
+	return &Result{
+		Report:     comparison.CompareRepeated(baselines, candidates),
+		Baselines:  len(baselines),
+		Candidates: len(candidates),
+		Failed:     failed,
+	}, nil
+}
+
+// runOnce runs one side and saves its results to filename
+func runOnce(ctx context.Context, config Config, run side, filename string) (*collector.JSONOutput, error) {
+	tags := maps.Clone(config.Tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	tags["ab"] = run.name
+
+	test := orchestrator.Test{
+		Config: collector.TestConfig{
+			URL:            run.target.URL,
+			Duration:       config.Duration,
+			Connections:    config.Connections,
+			Containers:     run.target.Containers,
+			SampleInterval: config.SampleInterval,
+			Tags:           tags,
+		},
+		ResultFile: filename,
+		Options:    orchestrator.Options{TUI: config.TUI, Docker: config.Docker},
+	}
+
+	// Image targets get a fresh container for every run, removed once the run is over
+	if run.target.Image != "" {
+		spec := config.Managed
+		spec.Image = run.target.Image
+		test.Managed = &spec
+	}
+
+	_, output, err := orchestrator.RunTest(ctx, test)
+	return output, err
+}
@@ -0,0 +1,40 @@
+package ab
+
+import "testing"
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    Target
+		wantErr bool
+	}{
+		{name: "URL", target: "http://localhost:8080/health", want: Target{URL: "http://localhost:8080/health"}},
+		{name: "image with a tag", target: "myapp:1.4.2", want: Target{Image: "myapp:1.4.2"}},
+		{name: "image with a numeric tag", target: "redis:7", want: Target{Image: "redis:7"}},
+		{name: "image from a registry", target: "ghcr.io/org/app:1.0", want: Target{Image: "ghcr.io/org/app:1.0"}},
+		{name: "image prefix", target: "image:localhost:5000/myapp:1.5.0", want: Target{Image: "localhost:5000/myapp:1.5.0"}},
+		{name: "localhost without a scheme", target: "localhost:8080", wantErr: true},
+		{name: "host and path without a scheme", target: "api.internal:80/health", wantErr: true},
+		{name: "IP without a scheme", target: "10.0.0.5:8080", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseTarget(test.target)
+
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ParseTarget(%q) = %+v, want an error asking for a scheme or image:", test.target, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTarget(%q) error = %v", test.target, err)
+			}
+			if got.URL != test.want.URL || got.Image != test.want.Image {
+				t.Errorf("ParseTarget(%q) = %+v, want %+v", test.target, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package abort
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+)
+
+// Conditions a run can be aborted by
+const (
+	ConditionErrorRate = "error_rate"
+	ConditionP99       = "p99"
+	ConditionMemory    = "memory"
+)
+
+// Defaults of the windows the conditions are measured over
+const (
+	DefaultWindow = 10 * time.Second
+	DefaultP99For = 10 * time.Second
+)
+
+// minRequests is how many requests a window needs before its error rate counts, so a single failure at the start of
+// a run doesn't abort it
+const minRequests = 10
+
+// Config is when a run is stopped early because the target has fallen over, rather than wasting the rest of it.
+// Every condition is optional.
+type Config struct {
+	// ErrorRate aborts once more than this percentage of the requests completed within Window failed
+	ErrorRate float64       `json:"error_rate,omitempty" yaml:"error_rate"`
+	Window    time.Duration `json:"window,omitempty"`
+	// P99 aborts once the p99 latency of every second has been above it for P99For
+	P99    time.Duration `json:"p99,omitempty"`
+	P99For time.Duration `json:"p99_for,omitempty" yaml:"p99_for"`
+	// Memory aborts once a container uses more than this, a size such as 900m or a percentage of its limit such as 95%
+	Memory string `json:"memory,omitempty"`
+}
+
+func (c Config) Validate() error {
+	if c.ErrorRate < 0 || c.ErrorRate > 100 {
+		return fmt.Errorf("abort error rate must be a percentage between 0 and 100")
+	}
+	if c.Window < 0 || c.P99 < 0 || c.P99For < 0 {
+		return fmt.Errorf("abort durations cannot be negative")
+	}
+	if c.Window != 0 && c.Window < time.Second || c.P99For != 0 && c.P99For < time.Second {
+		return fmt.Errorf("abort windows must be at least 1s, conditions are checked every second")
+	}
+	if c.Memory != "" {
+		if _, _, err := c.memoryLimit(); err != nil {
+			return err
+		}
+	}
+	if !c.Enabled() {
+		return fmt.Errorf("must set at least one abort condition: error rate, p99 or memory")
+	}
+	return nil
+}
+
+// Enabled reports whether any condition is set
+func (c Config) Enabled() bool {
+	return c.ErrorRate > 0 || c.P99 > 0 || c.Memory != ""
+}
+
+// memoryLimit is the memory a container can use in MB, or as a percentage of its limit when percent is set
+func (c Config) memoryLimit() (limit float64, percent bool, err error) {
+	if value, ok := strings.CutSuffix(c.Memory, "%"); ok {
+		limit, err = strconv.ParseFloat(value, 64)
+		if err != nil || limit <= 0 || limit > 100 {
+			return 0, false, fmt.Errorf("invalid abort memory %q: must be a size such as 900m or a percentage such as 95%%", c.Memory)
+		}
+		return limit, true, nil
+	}
+
+	bytes, err := units.RAMInBytes(c.Memory)
+	if err != nil || bytes <= 0 {
+		return 0, false, fmt.Errorf("invalid abort memory %q: must be a size such as 900m or a percentage such as 95%%", c.Memory)
+	}
+	return float64(bytes) / 1024 / 1024, false, nil
+}
+
+// Reason is why a run was aborted, saved with its partial results
+type Reason struct {
+	// Condition is error_rate, p99 or memory
+	Condition string    `json:"condition"`
+	Message   string    `json:"message"`
+	At        time.Time `json:"at"`
+	// Elapsed is how far into the run it was aborted
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+func (r *Reason) String() string {
+	return fmt.Sprintf("aborted after %s: %s", r.Elapsed.Round(time.Second), r.Message)
+}
+
+// Duration is how long the run lasted, the planned duration unless it was aborted
+func (r *Reason) Duration(planned time.Duration) time.Duration {
+	if r == nil {
+		return planned
+	}
+	return r.Elapsed
+}
+
+// second counts the requests that completed within a second of the run
+type second struct {
+	requests int
+	failed   int
+	// latency of the requests that got a response, in milliseconds
+	latency []int64
+}
+
+// Watcher checks the conditions every second while the run is going, and closes Aborted once one is met
+type Watcher struct {
+	config        Config
+	memory        float64
+	memoryPercent bool
+
+	mu      sync.Mutex
+	start   time.Time
+	seconds map[int64]*second
+	reason  *Reason
+	aborted chan struct{}
+	// checked is the last second the p99 was checked for, and breached the first of the seconds since then that
+	// were all above it, or -1
+	checked  int64
+	breached int64
+}
+
+// New creates a watcher for a validated config
+func New(config Config) *Watcher {
+	if config.Window == 0 {
+		config.Window = DefaultWindow
+	}
+	if config.P99For == 0 {
+		config.P99For = DefaultP99For
+	}
+
+	w := &Watcher{
+		config:   config,
+		start:    time.Now(),
+		seconds:  make(map[int64]*second),
+		aborted:  make(chan struct{}),
+		checked:  -1,
+		breached: -1,
+	}
+	if config.Memory != "" {
+		// Already validated
+		w.memory, w.memoryPercent, _ = config.memoryLimit()
+	}
+	return w
+}
+
+// Aborted is closed once a condition is met
+func (w *Watcher) Aborted() <-chan struct{} {
+	return w.aborted
+}
+
+// Reason is why the run was aborted, or nil if it wasn't. A nil watcher never aborts.
+func (w *Watcher) Reason() *Reason {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.reason
+}
+
+// abort records the first condition met, the caller must hold mu
+func (w *Watcher) abort(condition, message string) {
+	if w.reason != nil {
+		return
+	}
+
+	now := time.Now()
+	w.reason = &Reason{Condition: condition, Message: message, At: now, Elapsed: now.Sub(w.start).Round(time.Millisecond)}
+	fmt.Printf("\nAborting the run: %s\n", message)
+	close(w.aborted)
+}
+
+func (w *Watcher) ObserveHTTP(stat load.HTTPStats) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Requests are counted in the second they completed in, so slow requests count as soon as they are known about
+	index := int64(stat.Timestamp.Add(stat.Latency).Sub(w.start).Seconds())
+
+	s := w.seconds[index]
+	if s == nil {
+		s = &second{}
+		w.seconds[index] = s
+	}
+
+	s.requests++
+	if stat.ErrorType != "" || stat.StatusCode < 200 || stat.StatusCode > 299 {
+		s.failed++
+	}
+	if stat.ErrorType == "" {
+		s.latency = append(s.latency, stat.Latency.Milliseconds())
+	}
+}
+
+func (w *Watcher) ObserveDocker(stat docker.DockerStats) {
+	if w.config.Memory == "" {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.memoryPercent && stat.MemoryPercent > w.memory {
+		w.abort(ConditionMemory, fmt.Sprintf("%s is using %.1f%% of its memory limit, above %s", stat.Container, stat.MemoryPercent, w.config.Memory))
+	}
+	if !w.memoryPercent && stat.MemoryUsageMB > w.memory {
+		w.abort(ConditionMemory, fmt.Sprintf("%s is using %.2f MB of memory, above %s", stat.Container, stat.MemoryUsageMB, w.config.Memory))
+	}
+}
+
+// Run checks the request conditions at the end of every second of the run
+func (w *Watcher) Run(ctx context.Context) {
+	w.mu.Lock()
+	w.start = time.Now()
+	w.mu.Unlock()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+func (w *Watcher) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.reason != nil {
+		return
+	}
+
+	// The current second is still filling up, so only the ones before it are checked
+	current := int64(time.Since(w.start).Seconds())
+	window := int64(w.config.Window / time.Second)
+
+	if w.config.ErrorRate > 0 {
+		var requests, failed int
+		from := max(current-window, 0)
+		for i := from; i < current; i++ {
+			if s := w.seconds[i]; s != nil {
+				requests += s.requests
+				failed += s.failed
+			}
+		}
+
+		rate := float64(failed) / float64(max(requests, 1)) * 100
+		if requests >= minRequests && rate > w.config.ErrorRate {
+			w.abort(ConditionErrorRate, fmt.Sprintf("%.2f%% of requests failed over the last %s, above %.2f%%", rate, time.Duration(current-from)*time.Second, w.config.ErrorRate))
+			return
+		}
+	}
+
+	if w.config.P99 > 0 {
+		limit := w.config.P99.Milliseconds()
+		for i := w.checked + 1; i < current; i++ {
+			w.checked = i
+
+			// A second without any responses, e.g. because the target hung, carries on the streak it is part of
+			s := w.seconds[i]
+			if s == nil || len(s.latency) == 0 {
+				continue
+			}
+
+			if p99(s.latency) <= limit {
+				w.breached = -1
+				continue
+			}
+			if w.breached < 0 {
+				w.breached = i
+			}
+		}
+
+		if w.breached >= 0 && time.Duration(current-w.breached)*time.Second >= w.config.P99For {
+			w.abort(ConditionP99, fmt.Sprintf("p99 latency has been above %s for %s", w.config.P99, w.config.P99For))
+			return
+		}
+	}
+
+	// Seconds that can no longer be part of a window are dropped, so long runs don't hold on to every request
+	keep := max(window, int64(w.config.P99For/time.Second)) + 1
+	for i := range w.seconds {
+		if i < current-keep {
+			delete(w.seconds, i)
+		}
+	}
+}
+
+func p99(latency []int64) int64 {
+	sorted := slices.Sorted(slices.Values(latency))
+	return sorted[(len(sorted)*99-1)/100]
+}
@@ -0,0 +1,149 @@
+package baseline
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+)
+
+// Selector describes which previous result should be used as a baseline
+type Selector struct {
+	// Path is set when the baseline was given as a plain file
+	Path string
+	// Tags that a candidate result must carry to be selected
+	Tags map[string]string
+}
+
+// IsFile reports whether the selector refers directly to a result file
+func (s Selector) IsFile() bool {
+	return s.Path != ""
+}
+
+// ParseSelector parses a baseline spec. Supported forms are:
+//
+//	baseline.json            a result file
+//	latest                   the most recent result
+//	latest:env=staging       the most recent result with all of the given tags
+//	tag:version=1.4.1        the most recent result with all of the given tags
+func ParseSelector(spec string) (Selector, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Selector{}, fmt.Errorf("baseline cannot be empty")
+	}
+
+	kind, rest, hasRest := strings.Cut(spec, ":")
+
+	switch kind {
+	case "latest":
+		tags, err := parseTags(rest)
+		if err != nil {
+			return Selector{}, err
+		}
+		return Selector{Tags: tags}, nil
+	case "tag":
+		if !hasRest || rest == "" {
+			return Selector{}, fmt.Errorf("baseline %q must specify at least one tag, e.g. tag:version=1.4.1", spec)
+		}
+		tags, err := parseTags(rest)
+		if err != nil {
+			return Selector{}, err
+		}
+		return Selector{Tags: tags}, nil
+	}
+
+	return Selector{Path: spec}, nil
+}
+
+func parseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	if s == "" {
+		return tags, nil
+	}
+
+	for pair := range strings.SplitSeq(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q: must be in key=value format", pair)
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+
+	return tags, nil
+}
+
+type candidate struct {
+	path      string
+	timestamp time.Time
+}
+
+// Resolve finds the most recent result in dir matching the selector whose config is similar to target.
+// Any paths in exclude are never selected, so a result cannot be compared against itself.
+func Resolve(dir string, selector Selector, target collector.TestConfig, exclude ...string) (string, error) {
+	if selector.IsFile() {
+		return selector.Path, nil
+	}
+
+	excluded := make(map[string]bool)
+	for _, path := range exclude {
+		abs, err := filepath.Abs(path)
+		if err == nil {
+			excluded[abs] = true
+		}
+	}
+
+	var best *candidate
+	var matchedTags int
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !collector.IsResultFile(path) || collector.IsAggregateFile(path) {
+			return nil
+		}
+
+		abs, err := filepath.Abs(path)
+		if err != nil || excluded[abs] {
+			return nil
+		}
+
+		metadata, err := collector.ReadMetadataFromFile(path)
+		if err != nil {
+			// Not every JSON file in the directory will be a loadship result
+			return nil
+		}
+
+		if !metadata.HasTags(selector.Tags) {
+			return nil
+		}
+		matchedTags++
+
+		if !target.IsSimilar(*metadata) {
+			return nil
+		}
+
+		if best == nil || metadata.Timestamp.After(best.timestamp) {
+			best = &candidate{path: path, timestamp: metadata.Timestamp}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("error searching %s for results: %w", dir, err)
+	}
+
+	if best == nil {
+		if matchedTags > 0 {
+			return "", fmt.Errorf("found %d result(s) in %s matching the baseline tags, but none have a similar config (url, connections, duration)", matchedTags, dir)
+		}
+		return "", fmt.Errorf("no results in %s match the baseline tags", dir)
+	}
+
+	return best.path, nil
+}
@@ -0,0 +1,426 @@
+package capacity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/orchestrator"
+	"github.com/fireproofpenguin/loadship/internal/process"
+	"github.com/fireproofpenguin/loadship/internal/report"
+)
+
+// What a search varies between trials
+const (
+	// ModeConnections varies the number of connections, each sending requests as fast as the target answers
+	ModeConnections = "connections"
+	// ModeRate varies the requests sent per second, spread over a fixed number of connections
+	ModeRate = "rate"
+)
+
+// Defaults of a search
+const (
+	DefaultStart     = 10
+	DefaultFactor    = 2
+	DefaultPrecision = 0.1
+	DefaultKnee      = 0.5
+	DefaultDuration  = 20 * time.Second
+	DefaultErrorRate = 1.0
+	// DefaultRateConnections is how many requests can be in flight at once in rate mode
+	DefaultRateConnections = 100
+)
+
+// minAchievedRate is the share of its target rate a trial has to send to keep up with it
+const minAchievedRate = 0.95
+
+// SLO is what a trial has to meet for its load to be sustainable
+type SLO struct {
+	// P99 is the highest p99 latency allowed, unlimited when zero
+	P99 time.Duration `json:"p99,omitempty"`
+	// ErrorRate is the highest percentage of failed requests allowed, e.g. 0.1 for 0.1%
+	ErrorRate float64 `json:"error_rate" yaml:"error_rate"`
+}
+
+// Search steps the load up by Factor until a trial misses the SLO or passes the knee, then binary searches between
+// the last trial that met it and the first that didn't
+type Search struct {
+	// Mode is connections or rate
+	Mode string
+	// Start is the load of the first trial and Max the highest load tried, unbounded when zero
+	Start int
+	Max   int
+	// Factor multiplies the load of every step up
+	Factor float64
+	// Precision stops the binary search once the gap between the sustainable and unsustainable load is within this
+	// fraction of the sustainable load
+	Precision float64
+	// Knee is the share of the extra load that has to turn into extra throughput in connections mode, e.g. 0.5 when
+	// doubling the connections has to raise the throughput by at least half
+	Knee float64
+	// Duration of each trial
+	Duration time.Duration
+	Cooldown time.Duration
+	// Connections limits the requests in flight at once in rate mode
+	Connections int
+	SLO         SLO
+}
+
+// DefaultSearch is the search the flags default to, and a suite's capacity search starts from
+func DefaultSearch() Search {
+	return Search{
+		Mode:        ModeConnections,
+		Start:       DefaultStart,
+		Factor:      DefaultFactor,
+		Precision:   DefaultPrecision,
+		Knee:        DefaultKnee,
+		Duration:    DefaultDuration,
+		Connections: DefaultRateConnections,
+		SLO:         SLO{ErrorRate: DefaultErrorRate},
+	}
+}
+
+// UnmarshalYAML fills in the defaults of the settings a suite leaves out, so a setting written as zero stays zero
+func (s *Search) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain Search
+	search := plain(DefaultSearch())
+	if err := unmarshal(&search); err != nil {
+		return err
+	}
+
+	*s = Search(search)
+	return nil
+}
+
+func (s *Search) Validate() error {
+	if s.Mode != ModeConnections && s.Mode != ModeRate {
+		return fmt.Errorf("capacity mode must be %s or %s", ModeConnections, ModeRate)
+	}
+
+	if s.Start < 1 {
+		return fmt.Errorf("capacity start must be at least 1")
+	}
+	if s.Max != 0 && s.Max < s.Start {
+		return fmt.Errorf("capacity max cannot be less than start")
+	}
+	if s.Factor <= 1 {
+		return fmt.Errorf("capacity factor must be greater than 1")
+	}
+	if s.Precision < 0 || s.Precision >= 1 {
+		return fmt.Errorf("capacity precision must be between 0 and 1")
+	}
+	if s.Knee < 0 || s.Knee > 1 {
+		return fmt.Errorf("capacity knee must be between 0 and 1")
+	}
+	if s.Duration <= 0 {
+		return fmt.Errorf("capacity trial duration must be greater than 0")
+	}
+	if s.Cooldown < 0 {
+		return fmt.Errorf("cooldown duration cannot be negative")
+	}
+	if s.Mode == ModeRate && s.Connections < 1 {
+		return fmt.Errorf("capacity connections must be at least 1 in %s mode", ModeRate)
+	}
+	if s.SLO.P99 < 0 {
+		return fmt.Errorf("SLO p99 cannot be negative")
+	}
+	if s.SLO.ErrorRate < 0 || s.SLO.ErrorRate > 100 {
+		return fmt.Errorf("SLO error rate must be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+// unit names the load of a trial
+func (s *Search) unit() string {
+	if s.Mode == ModeRate {
+		return "RPS"
+	}
+	return "connections"
+}
+
+type Config struct {
+	Search
+	// URL is the target, or a path on a managed container's published port
+	URL string
+	// Managed starts the target from an image for every trial, so each trial gets a fresh container
+	Managed        *docker.ContainerSpec
+	Containers     []string
+	Processes      []process.Target
+	Docker         docker.Connection
+	SampleInterval time.Duration
+	Tags           map[string]string
+	TUI            bool
+	// Report generates an HTML report of the sustainable trial with the curve of every trial
+	Report bool
+	// Directory the results of every trial and the search are saved to
+	Directory string
+}
+
+// Trial is a short run at a single load
+type Trial struct {
+	// Phase is step while stepping the load up, search while binary searching
+	Phase string  `json:"phase"`
+	Load  int     `json:"load"`
+	RPS   float64 `json:"rps"`
+	P50   int64   `json:"p50"`
+	P95   int64   `json:"p95"`
+	P99   int64   `json:"p99"`
+	// ErrorRate is the percentage of requests that failed
+	ErrorRate float64 `json:"error_rate"`
+	Passed    bool    `json:"passed"`
+	// Reason is why the load isn't sustainable when the trial didn't pass
+	Reason     string `json:"reason,omitempty"`
+	ResultFile string `json:"result_file,omitempty"`
+}
+
+// Result of a capacity search, saved as capacity.json in the search's directory
+type Result struct {
+	Mode string `json:"mode"`
+	SLO  SLO    `json:"slo"`
+	// Sustainable is the highest load that met the SLO, zero when none did, and RPS the throughput it reached
+	Sustainable int     `json:"sustainable"`
+	RPS         float64 `json:"rps"`
+	Trials      []Trial `json:"trials"`
+	ReportFile  string  `json:"report_file,omitempty"`
+}
+
+// Start runs trials until the highest sustainable load is found, or ctx is cancelled, saving the results of every
+// trial
+func Start(ctx context.Context, config Config) (*Result, error) {
+	if err := os.MkdirAll(config.Directory, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating results directory: %w", err)
+	}
+
+	result := &Result{Mode: config.Mode, SLO: config.SLO}
+
+	// Only the output of the sustainable trial is kept for the report, or the first when none is sustainable
+	var sustainable *Trial
+	var sustainableOutput, firstOutput *collector.JSONOutput
+
+	run := func(phase string, load int) (*Trial, error) {
+		if len(result.Trials) > 0 {
+			orchestrator.Cooldown(ctx, config.Cooldown)
+		}
+
+		fmt.Printf("Trial %d (%s): %d %s for %s\n", len(result.Trials)+1, phase, load, config.unit(), config.Duration)
+
+		trial, output, err := runTrial(ctx, config, phase, load, len(result.Trials)+1)
+		if err != nil {
+			// The target failing once the search is underway is as unsustainable as missing the SLO
+			if len(result.Trials) == 0 || errors.Is(err, orchestrator.ErrInterrupted) {
+				return nil, err
+			}
+			trial = &Trial{Phase: phase, Load: load, ErrorRate: 100, Reason: err.Error()}
+		} else {
+			evaluate(config.Search, trial, sustainable)
+		}
+
+		if trial.Passed {
+			fmt.Printf("✓ %.2f RPS, p99 %d ms, %.2f%% failed\n", trial.RPS, trial.P99, trial.ErrorRate)
+			sustainable, sustainableOutput = trial, output
+		} else {
+			fmt.Printf("✗ %d %s isn't sustainable: %s\n", load, config.unit(), trial.Reason)
+		}
+		if firstOutput == nil {
+			firstOutput = output
+		}
+
+		result.Trials = append(result.Trials, *trial)
+		return trial, nil
+	}
+
+	// Step the load up until a trial isn't sustainable, or the maximum is sustained
+	var unsustainable int
+	for load := config.Start; ; {
+		trial, err := run("step", load)
+		if err != nil {
+			return nil, err
+		}
+		if !trial.Passed {
+			unsustainable = load
+			break
+		}
+		if config.Max != 0 && load >= config.Max {
+			break
+		}
+
+		load = max(load+1, int(math.Round(float64(load)*config.Factor)))
+		if config.Max != 0 {
+			load = min(load, config.Max)
+		}
+	}
+
+	// Narrow the gap between the sustainable and unsustainable load
+	for sustainable != nil && unsustainable > 0 {
+		gap := unsustainable - sustainable.Load
+		if gap <= max(1, int(float64(sustainable.Load)*config.Precision)) {
+			break
+		}
+
+		trial, err := run("search", sustainable.Load+gap/2)
+		if err != nil {
+			return nil, err
+		}
+		if !trial.Passed {
+			unsustainable = trial.Load
+		}
+	}
+
+	if sustainable != nil {
+		result.Sustainable, result.RPS = sustainable.Load, sustainable.RPS
+	}
+
+	if config.Report {
+		output := sustainableOutput
+		if output == nil {
+			output = firstOutput
+		}
+		if output != nil {
+			result.ReportFile = report.WriteCapacity(output, result.curve(), filepath.Join(config.Directory, "capacity"))
+		}
+	}
+
+	if err := result.SaveToFile(filepath.Join(config.Directory, "capacity.json")); err != nil {
+		return nil, fmt.Errorf("error saving capacity search: %w", err)
+	}
+
+	return result, nil
+}
+
+// runTrial load tests the target at a single load and saves its results
+func runTrial(ctx context.Context, config Config, phase string, load, number int) (*Trial, *collector.JSONOutput, error) {
+	test := orchestrator.Test{
+		Config: collector.TestConfig{
+			URL:            config.URL,
+			Duration:       config.Duration,
+			Connections:    load,
+			Containers:     config.Containers,
+			Processes:      config.Processes,
+			SampleInterval: config.SampleInterval,
+			Tags:           config.Tags,
+		},
+		Managed:    config.Managed,
+		ResultFile: filepath.Join(config.Directory, fmt.Sprintf("trial_%d_%dc.json", number, load)),
+		Options:    orchestrator.Options{TUI: config.TUI, Docker: config.Docker},
+	}
+	if config.Mode == ModeRate {
+		test.Config.Connections, test.Config.Rate = config.Connections, load
+		test.ResultFile = filepath.Join(config.Directory, fmt.Sprintf("trial_%d_%drps.json", number, load))
+	}
+
+	_, output, err := orchestrator.RunTest(ctx, test)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requests, latency := output.Summary.HTTPMetrics.Requests, output.Summary.HTTPMetrics.Latency
+	trial := &Trial{
+		Phase:      phase,
+		Load:       load,
+		RPS:        requests.Rps,
+		P50:        latency.P50,
+		P95:        latency.P95,
+		P99:        latency.P99,
+		ErrorRate:  100,
+		ResultFile: test.ResultFile,
+	}
+	if requests.Total > 0 {
+		trial.ErrorRate = float64(requests.Failed) / float64(requests.Total) * 100
+	}
+
+	return trial, output, nil
+}
+
+// evaluate decides whether the trial's load is sustainable, compared with the highest sustainable trial so far
+func evaluate(search Search, trial, sustainable *Trial) {
+	switch {
+	case trial.ErrorRate > search.SLO.ErrorRate:
+		trial.Reason = fmt.Sprintf("%.2f%% of requests failed, above the SLO of %.2f%%", trial.ErrorRate, search.SLO.ErrorRate)
+	case search.SLO.P99 > 0 && trial.P99 > search.SLO.P99.Milliseconds():
+		trial.Reason = fmt.Sprintf("p99 latency of %d ms is above the SLO of %d ms", trial.P99, search.SLO.P99.Milliseconds())
+	case search.Mode == ModeRate && trial.RPS < float64(trial.Load)*minAchievedRate:
+		trial.Reason = fmt.Sprintf("only reached %.2f RPS, the target can't keep up", trial.RPS)
+	case search.Mode == ModeConnections && sustainable != nil && sustainable.RPS > 0 &&
+		trial.RPS/sustainable.RPS-1 < search.Knee*(float64(trial.Load)/float64(sustainable.Load)-1):
+		trial.Reason = fmt.Sprintf("past the knee, %.2f RPS is barely more than %.2f RPS at %d connections", trial.RPS, sustainable.RPS, sustainable.Load)
+	default:
+		trial.Passed = true
+	}
+}
+
+// curve is the capacity curve of the report, with the trials in order of their load
+func (r *Result) curve() report.CapacityCurve {
+	curve := report.CapacityCurve{
+		Mode:           r.Mode,
+		Sustainable:    r.Sustainable,
+		RPS:            r.RPS,
+		P99Limit:       r.SLO.P99.Milliseconds(),
+		ErrorRateLimit: r.SLO.ErrorRate,
+	}
+
+	trials := slices.SortedStableFunc(slices.Values(r.Trials), func(a, b Trial) int {
+		return a.Load - b.Load
+	})
+	for _, trial := range trials {
+		curve.Trials = append(curve.Trials, report.CapacityTrial{
+			Load:      trial.Load,
+			RPS:       trial.RPS,
+			P50:       trial.P50,
+			P95:       trial.P95,
+			P99:       trial.P99,
+			ErrorRate: trial.ErrorRate,
+			Passed:    trial.Passed,
+		})
+	}
+	return curve
+}
+
+func (r *Result) SaveToFile(filename string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// Print prints every trial in the order they ran and the sustainable capacity
+func (r *Result) Print() {
+	unit := "Connections"
+	if r.Mode == ModeRate {
+		unit = "Rate"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Println("\n=== Capacity Search ===")
+	fmt.Fprintf(w, "Trial\tPhase\t%s\tRPS\tp50\tp95\tp99\tFailed\t\n", unit)
+	fmt.Fprintln(w, "-----\t-----\t------\t---\t---\t---\t---\t------\t")
+
+	for i, trial := range r.Trials {
+		mark := "✓"
+		if !trial.Passed {
+			mark = "✗"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%.2f\t%d\t%d\t%d\t%.2f%%\t%s\n", i+1, trial.Phase, trial.Load, trial.RPS, trial.P50, trial.P95, trial.P99, trial.ErrorRate, mark)
+	}
+	w.Flush()
+
+	if r.Sustainable == 0 {
+		fmt.Println("\nNo trial met the SLO, the lowest load tried isn't sustainable")
+		return
+	}
+
+	if r.Mode == ModeRate {
+		fmt.Printf("\nSustainable capacity: %.2f RPS at a target rate of %d RPS\n", r.RPS, r.Sustainable)
+	} else {
+		fmt.Printf("\nSustainable capacity: %.2f RPS with %d connections\n", r.RPS, r.Sustainable)
+	}
+}
@@ -3,13 +3,19 @@ package collector
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"maps"
+	"math"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/fireproofpenguin/loadship/internal/abort"
 	"github.com/fireproofpenguin/loadship/internal/docker"
 	"github.com/fireproofpenguin/loadship/internal/load"
+	"github.com/fireproofpenguin/loadship/internal/process"
+	"github.com/fireproofpenguin/loadship/internal/profile"
+	"github.com/fireproofpenguin/loadship/internal/scrape"
 )
 
 type RequestMetrics struct {
@@ -38,11 +44,22 @@ type MemoryMetrics struct {
 	Average float64 `json:"average"`
 	Min     float64 `json:"min"`
 	Max     float64 `json:"max"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	LimitMB float64 `json:"limit_mb,omitempty"`
+	// PeakPercent is the highest usage as a percentage of the limit
+	PeakPercent float64 `json:"peak_percent,omitempty"`
 }
 
 type CPUMetrics struct {
 	Average float64 `json:"average"`
 	Peak    float64 `json:"peak"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	// Throttling during the test, only seen when the container has a CPU limit
+	ThrottledPeriods uint64  `json:"throttled_periods,omitempty"`
+	ThrottledPercent float64 `json:"throttled_percent,omitempty"`
+	ThrottledSeconds float64 `json:"throttled_seconds,omitempty"`
 }
 
 type DiskIOMetrics struct {
@@ -55,17 +72,58 @@ type PIDMetrics struct {
 	Peak    float64 `json:"peak"`
 }
 
+// NetworkMetrics covers traffic across every interface of the container during the test
+type NetworkMetrics struct {
+	RxMB float64 `json:"rx_mb"`
+	TxMB float64 `json:"tx_mb"`
+	// Average and peak throughput in MB/s
+	RxRate     float64 `json:"rx_mb_per_sec"`
+	TxRate     float64 `json:"tx_mb_per_sec"`
+	PeakRxRate float64 `json:"peak_rx_mb_per_sec"`
+	PeakTxRate float64 `json:"peak_tx_mb_per_sec"`
+	RxPackets  uint64  `json:"rx_packets"`
+	TxPackets  uint64  `json:"tx_packets"`
+	Errors     uint64  `json:"errors"`
+	Dropped    uint64  `json:"dropped"`
+}
+
+// EventMetrics counts the lifecycle events of the container during the test
+type EventMetrics struct {
+	OOMKills  int `json:"oom_kills"`
+	Exits     int `json:"exits"`
+	Restarts  int `json:"restarts"`
+	Unhealthy int `json:"unhealthy"`
+}
+
+// DockerMetrics summarises the resource usage of a single container
 type DockerMetrics struct {
-	collected bool
-	Memory    MemoryMetrics `json:"memory,omitempty"`
-	CPU       CPUMetrics    `json:"cpu,omitempty"`
-	DiskIO    DiskIOMetrics `json:"disk_io,omitempty"`
-	PIDs      PIDMetrics    `json:"pids,omitempty"`
+	Container string         `json:"container"`
+	Memory    MemoryMetrics  `json:"memory,omitempty"`
+	CPU       CPUMetrics     `json:"cpu,omitempty"`
+	DiskIO    DiskIOMetrics  `json:"disk_io,omitempty"`
+	PIDs      PIDMetrics     `json:"pids,omitempty"`
+	Network   NetworkMetrics `json:"network,omitempty"`
+	Events    EventMetrics   `json:"events"`
+	// Logs is only set when the container's logs were captured
+	Logs *LogMetrics `json:"logs,omitempty"`
 }
 
 type Metrics struct {
-	HTTPMetrics   HTTPMetrics   `json:"http_metrics"`
-	DockerMetrics DockerMetrics `json:"docker_metrics,omitempty"`
+	HTTPMetrics HTTPMetrics `json:"http_metrics"`
+	// Containers has one entry per monitored container, sorted by name
+	Containers []DockerMetrics `json:"containers,omitempty"`
+	// Scraped summarises each series scraped from the target's metrics endpoints
+	Scraped []SeriesMetrics `json:"scraped,omitempty"`
+}
+
+// Container returns the metrics of the named container, or nil if it wasn't monitored
+func (m *Metrics) Container(name string) *DockerMetrics {
+	for i := range m.Containers {
+		if m.Containers[i].Container == name {
+			return &m.Containers[i]
+		}
+	}
+	return nil
 }
 
 func (m *Metrics) PrettyPrint() {
@@ -80,18 +138,51 @@ func (m *Metrics) PrettyPrint() {
 	}
 	fmt.Printf("Latency Min/Avg/Max: %d / %.2f / %d ms\n", m.HTTPMetrics.Latency.Min, m.HTTPMetrics.Latency.Average, m.HTTPMetrics.Latency.Max)
 	fmt.Printf("Latency p50/p90/p95/p99: %d / %d / %d / %d ms\n", m.HTTPMetrics.Latency.P50, m.HTTPMetrics.Latency.P90, m.HTTPMetrics.Latency.P95, m.HTTPMetrics.Latency.P99)
-	if m.DockerMetrics.collected {
-		fmt.Println("=== Docker Metrics ===")
-		fmt.Printf("Average memory: %.2f MB\n", m.DockerMetrics.Memory.Average)
-		fmt.Printf("Min memory: %.2f MB\n", m.DockerMetrics.Memory.Min)
-		fmt.Printf("Max memory: %.2f MB\n", m.DockerMetrics.Memory.Max)
-		fmt.Printf("CPU:\tAverage: %.2f %%\tPeak: %.2f %%\n", m.DockerMetrics.CPU.Average, m.DockerMetrics.CPU.Peak)
-		fmt.Printf("DiskIO:\tRead: %.2f MB\tWrite: %.2f MB\n", m.DockerMetrics.DiskIO.ReadMB, m.DockerMetrics.DiskIO.WriteMB)
-		fmt.Printf("PIDs:\tAverage: %.0f\tPeak: %.0f\n", m.DockerMetrics.PIDs.Average, m.DockerMetrics.PIDs.Peak)
+	for _, container := range m.Containers {
+		fmt.Printf("=== Docker Metrics: %s ===\n", container.Container)
+		fmt.Printf("Average memory: %.2f MB\n", container.Memory.Average)
+		fmt.Printf("Min memory: %.2f MB\n", container.Memory.Min)
+		fmt.Printf("Max memory: %.2f MB\n", container.Memory.Max)
+		fmt.Printf("Memory p50/p95: %.2f / %.2f MB\n", container.Memory.P50, container.Memory.P95)
+		if container.Memory.LimitMB > 0 {
+			fmt.Printf("Memory limit: %.2f MB (peak %.2f %%)\n", container.Memory.LimitMB, container.Memory.PeakPercent)
+		}
+		fmt.Printf("CPU:\tAverage: %.2f %%\tp50: %.2f %%\tp95: %.2f %%\tPeak: %.2f %%\n", container.CPU.Average, container.CPU.P50, container.CPU.P95, container.CPU.Peak)
+		fmt.Printf("DiskIO:\tRead: %.2f MB\tWrite: %.2f MB\n", container.DiskIO.ReadMB, container.DiskIO.WriteMB)
+		fmt.Printf("PIDs:\tAverage: %.0f\tPeak: %.0f\n", container.PIDs.Average, container.PIDs.Peak)
+		network := container.Network
+		fmt.Printf("Network:\tRx: %.2f MB (%.2f MB/s, peak %.2f MB/s)\tTx: %.2f MB (%.2f MB/s, peak %.2f MB/s)\n",
+			network.RxMB, network.RxRate, network.PeakRxRate, network.TxMB, network.TxRate, network.PeakTxRate)
+		if network.Errors > 0 || network.Dropped > 0 {
+			fmt.Printf("Network:\tErrors: %d\tDropped: %d\n", network.Errors, network.Dropped)
+		}
+		if container.CPU.ThrottledPeriods > 0 {
+			fmt.Printf("Throttling:\tPeriods: %d (%.2f %%)\tTime: %.2f s\n", container.CPU.ThrottledPeriods, container.CPU.ThrottledPercent, container.CPU.ThrottledSeconds)
+		}
+		events := container.Events
+		if events != (EventMetrics{}) {
+			fmt.Printf("Events:\tOOM kills: %d\tExits: %d\tRestarts: %d\tUnhealthy: %d\n", events.OOMKills, events.Exits, events.Restarts, events.Unhealthy)
+		}
+		if logs := container.Logs; logs != nil {
+			fmt.Printf("Logs:\tLines: %d\tPeak: %d lines/s\n", logs.Lines, logs.PeakLinesPerSecond)
+			for _, pattern := range slices.Sorted(maps.Keys(logs.Matches)) {
+				fmt.Printf("Logs:\t%q: %d lines\n", pattern, logs.Matches[pattern])
+			}
+		}
+	}
+	if len(m.Scraped) > 0 {
+		fmt.Println("=== Application Metrics ===")
+	}
+	for _, series := range m.Scraped {
+		if series.Type == scrape.TypeCounter {
+			fmt.Printf("%s:\tIncrease: %.4g\tRate: %.4g/s\n", series.Series, series.Increase, series.Rate)
+		} else {
+			fmt.Printf("%s:\tAverage: %.4g\tMin: %.4g\tMax: %.4g\tLast: %.4g\n", series.Series, series.Average, series.Min, series.Max, series.Last)
+		}
 	}
 }
 
-func Calculate(httpStats []load.HTTPStats, dockerStats []docker.DockerStats, duration time.Duration) *Metrics {
+func Calculate(httpStats []load.HTTPStats, dockerStats []docker.DockerStats, events []docker.Event, duration time.Duration) *Metrics {
 	var metrics = &Metrics{}
 
 	// HTTP metrics
@@ -158,99 +249,242 @@ func Calculate(httpStats []load.HTTPStats, dockerStats []docker.DockerStats, dur
 		},
 	}
 
-	// Docker metrics
+	// Docker metrics, summarised separately for each container
 	if len(dockerStats) > 0 {
 		if runtime.GOOS == "windows" {
 			fmt.Println("Windows detected, cannot calculate CPU / DiskIO usage reliably - at this time!")
 		}
 
-		var (
-			totalMemory float64
-			minMemory   float64
-			maxMemory   float64
-			totalCPU    float64
-			peakCPU     float64
-			totalPids   float64
-			peakPids    float64
-		)
-
-		minMemory = dockerStats[0].MemoryUsageMB
-		maxMemory = dockerStats[0].MemoryUsageMB
-
-		baselineRead := dockerStats[0].DiskReadMB
-		baselineWrite := dockerStats[0].DiskWriteMB
-
-		totalWrite := dockerStats[len(dockerStats)-1].DiskWriteMB - baselineWrite
-		totalRead := dockerStats[len(dockerStats)-1].DiskReadMB - baselineRead
-
-		for _, result := range dockerStats {
-			totalMemory += result.MemoryUsageMB
-			if result.MemoryUsageMB < minMemory {
-				minMemory = result.MemoryUsageMB
-			}
-			if result.MemoryUsageMB > maxMemory {
-				maxMemory = result.MemoryUsageMB
-			}
-			totalCPU += result.CPUPercent
-			if result.CPUPercent > peakCPU {
-				peakCPU = result.CPUPercent
-			}
-			totalPids += float64(result.PIDs)
-			if float64(result.PIDs) > peakPids {
-				peakPids = float64(result.PIDs)
-			}
+		byContainer := make(map[string][]docker.DockerStats)
+		for _, stat := range dockerStats {
+			byContainer[stat.Container] = append(byContainer[stat.Container], stat)
 		}
 
-		averageMemory := float64(totalMemory) / float64(len(dockerStats))
-		averageCPU := float64(totalCPU) / float64(len(dockerStats))
-		averagePids := totalPids / float64(len(dockerStats))
-
-		metrics.DockerMetrics = DockerMetrics{
-			collected: true,
-			Memory: MemoryMetrics{
-				Average: averageMemory,
-				Min:     minMemory,
-				Max:     maxMemory,
-			},
-			CPU: CPUMetrics{
-				Average: averageCPU,
-				Peak:    peakCPU,
-			},
-			DiskIO: DiskIOMetrics{
-				ReadMB:  totalRead,
-				WriteMB: totalWrite,
-			},
-			PIDs: PIDMetrics{
-				Average: averagePids,
-				Peak:    peakPids,
-			},
+		for _, container := range slices.Sorted(maps.Keys(byContainer)) {
+			containerMetrics := calculateDocker(container, byContainer[container])
+			containerMetrics.Events = calculateEvents(container, events)
+			metrics.Containers = append(metrics.Containers, containerMetrics)
 		}
 	}
+	return metrics
+}
+
+func calculateDocker(container string, dockerStats []docker.DockerStats) DockerMetrics {
+	var (
+		totalMemory float64
+		minMemory   float64
+		maxMemory   float64
+		totalCPU    float64
+		peakCPU     float64
+		totalPids   float64
+		peakPids    float64
+		peakPercent float64
+		memory      = make([]float64, 0, len(dockerStats))
+		cpuSamples  = make([]float64, 0, len(dockerStats))
+	)
+
+	minMemory = dockerStats[0].MemoryUsageMB
+	maxMemory = dockerStats[0].MemoryUsageMB
+
+	baselineRead := dockerStats[0].DiskReadMB
+	baselineWrite := dockerStats[0].DiskWriteMB
+
+	totalWrite := dockerStats[len(dockerStats)-1].DiskWriteMB - baselineWrite
+	totalRead := dockerStats[len(dockerStats)-1].DiskReadMB - baselineRead
+
+	for _, result := range dockerStats {
+		totalMemory += result.MemoryUsageMB
+		if result.MemoryUsageMB < minMemory {
+			minMemory = result.MemoryUsageMB
+		}
+		if result.MemoryUsageMB > maxMemory {
+			maxMemory = result.MemoryUsageMB
+		}
+		peakPercent = max(peakPercent, result.MemoryPercent)
+		memory = append(memory, result.MemoryUsageMB)
+		cpuSamples = append(cpuSamples, result.CPUPercent)
+		totalCPU += result.CPUPercent
+		if result.CPUPercent > peakCPU {
+			peakCPU = result.CPUPercent
+		}
+		totalPids += float64(result.PIDs)
+		if float64(result.PIDs) > peakPids {
+			peakPids = float64(result.PIDs)
+		}
+	}
+
+	averageMemory := float64(totalMemory) / float64(len(dockerStats))
+	averageCPU := float64(totalCPU) / float64(len(dockerStats))
+	averagePids := totalPids / float64(len(dockerStats))
+
+	first := dockerStats[0].CPUThrottling
+	last := dockerStats[len(dockerStats)-1].CPUThrottling
+
+	slices.Sort(memory)
+	slices.Sort(cpuSamples)
+
+	cpu := CPUMetrics{
+		Average:          averageCPU,
+		Peak:             peakCPU,
+		P50:              percentile(cpuSamples, 50),
+		P95:              percentile(cpuSamples, 95),
+		ThrottledPeriods: counterDelta(first.ThrottledPeriods, last.ThrottledPeriods),
+		ThrottledSeconds: time.Duration(counterDelta(uint64(first.ThrottledTime), uint64(last.ThrottledTime))).Seconds(),
+	}
+	if periods := counterDelta(first.Periods, last.Periods); periods > 0 {
+		cpu.ThrottledPercent = float64(cpu.ThrottledPeriods) / float64(periods) * 100
+	}
 
+	return DockerMetrics{
+		Container: container,
+		Memory: MemoryMetrics{
+			Average:     averageMemory,
+			Min:         minMemory,
+			Max:         maxMemory,
+			P50:         percentile(memory, 50),
+			P95:         percentile(memory, 95),
+			LimitMB:     dockerStats[len(dockerStats)-1].MemoryLimitMB,
+			PeakPercent: peakPercent,
+		},
+		CPU: cpu,
+		DiskIO: DiskIOMetrics{
+			ReadMB:  totalRead,
+			WriteMB: totalWrite,
+		},
+		PIDs: PIDMetrics{
+			Average: averagePids,
+			Peak:    peakPids,
+		},
+		Network: calculateNetwork(dockerStats),
+	}
+}
+
+func calculateNetwork(dockerStats []docker.DockerStats) NetworkMetrics {
+	const mb = 1024 * 1024
+
+	first := dockerStats[0].Network
+	last := dockerStats[len(dockerStats)-1].Network
+
+	network := NetworkMetrics{
+		RxMB:      float64(counterDelta(first.RxBytes, last.RxBytes)) / mb,
+		TxMB:      float64(counterDelta(first.TxBytes, last.TxBytes)) / mb,
+		RxPackets: counterDelta(first.RxPackets, last.RxPackets),
+		TxPackets: counterDelta(first.TxPackets, last.TxPackets),
+		Errors:    counterDelta(first.RxErrors+first.TxErrors, last.RxErrors+last.TxErrors),
+		Dropped:   counterDelta(first.RxDropped+first.TxDropped, last.RxDropped+last.TxDropped),
+	}
+
+	elapsed := dockerStats[len(dockerStats)-1].Timestamp.Sub(dockerStats[0].Timestamp).Seconds()
+	if elapsed > 0 {
+		network.RxRate = network.RxMB / elapsed
+		network.TxRate = network.TxMB / elapsed
+	}
+
+	for i := 1; i < len(dockerStats); i++ {
+		interval := dockerStats[i].Timestamp.Sub(dockerStats[i-1].Timestamp).Seconds()
+		if interval <= 0 {
+			continue
+		}
+
+		previous, current := dockerStats[i-1].Network, dockerStats[i].Network
+		network.PeakRxRate = max(network.PeakRxRate, float64(counterDelta(previous.RxBytes, current.RxBytes))/mb/interval)
+		network.PeakTxRate = max(network.PeakTxRate, float64(counterDelta(previous.TxBytes, current.TxBytes))/mb/interval)
+	}
+
+	return network
+}
+
+// percentile returns the nearest-rank percentile p of the sorted samples
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func calculateEvents(container string, events []docker.Event) EventMetrics {
+	var metrics EventMetrics
+	for _, event := range events {
+		if event.Container != container {
+			continue
+		}
+		switch event.Type {
+		case docker.EventOOM:
+			metrics.OOMKills++
+		case docker.EventExit:
+			metrics.Exits++
+		case docker.EventRestart:
+			metrics.Restarts++
+		case docker.EventHealth:
+			if event.Detail == "unhealthy" {
+				metrics.Unhealthy++
+			}
+		}
+	}
 	return metrics
 }
 
+// counterDelta is how much a cumulative counter grew, treating a counter that went backwards
+// (e.g. the container restarted) as no growth rather than wrapping around
+func counterDelta(from, to uint64) uint64 {
+	if to < from {
+		return 0
+	}
+	return to - from
+}
+
 type JSONOutput struct {
-	Metadata    TestConfig           `json:"metadata"`
-	HTTPStats   []load.HTTPStats     `json:"http_stats"`
-	DockerStats []docker.DockerStats `json:"docker_stats,omitempty"`
-	Summary     Metrics              `json:"summary"`
+	SchemaVersion int                  `json:"schema_version"`
+	Metadata      TestConfig           `json:"metadata"`
+	HTTPStats     []load.HTTPStats     `json:"http_stats"`
+	DockerStats   []docker.DockerStats `json:"docker_stats,omitempty"`
+	// Events is the timeline of container lifecycle events during the test
+	Events []docker.Event `json:"events,omitempty"`
+	// Logs counts the lines the containers logged each second, when their logs were captured
+	Logs []LogBucket `json:"logs,omitempty"`
+	// Scraped are the series scraped from the target's metrics endpoints during the test
+	Scraped []scrape.Sample `json:"scraped,omitempty"`
+	// Profiles are the pprof profiles captured from the target during the test
+	Profiles []profile.Capture `json:"profiles,omitempty"`
+	// Abort is why the test was stopped early, its samples and summary only cover the time until then
+	Abort   *abort.Reason `json:"abort,omitempty"`
+	Summary Metrics       `json:"summary"`
+
+	// originalVersion is the schema version the output was read with before any migrations
+	originalVersion int
 }
 
-func (jo *JSONOutput) SaveToFile(filename string) error {
-	data, err := json.Marshal(jo)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(filename, data, 0644)
+// OriginalSchemaVersion returns the schema version the output was written with, before it was migrated on read
+func (jo *JSONOutput) OriginalSchemaVersion() int {
+	return jo.originalVersion
 }
 
 type TestConfig struct {
-	Timestamp     time.Time     `json:"timestamp"`
-	URL           string        `json:"url"`
-	Duration      time.Duration `json:"duration"`
-	Connections   int           `json:"connections"`
-	ContainerName string        `json:"container_name,omitempty"`
+	Timestamp   time.Time     `json:"timestamp"`
+	URL         string        `json:"url"`
+	Duration    time.Duration `json:"duration"`
+	Connections int           `json:"connections"`
+	// Rate caps the requests sent per second across all connections, unlimited when zero
+	Rate       int      `json:"rate,omitempty"`
+	Containers []string `json:"containers,omitempty"`
+	// Image is the image the target was started from when loadship managed its container
+	Image string `json:"image,omitempty"`
+	// Processes are host processes and cgroups monitored without docker. Their samples are recorded alongside
+	// the containers' under the target's name, e.g. pid:1234.
+	Processes []process.Target `json:"processes,omitempty"`
+	// SampleInterval is how often containers and processes were sampled, docker.DefaultSampleInterval when zero
+	SampleInterval time.Duration `json:"sample_interval,omitempty"`
+	// Logs is set when the containers' logs were captured, LogPatterns are the patterns their lines were matched against
+	Logs        bool     `json:"logs,omitempty"`
+	LogPatterns []string `json:"log_patterns,omitempty"`
+	// Scrape is what was scraped from the target's metrics endpoints, with paths resolved against the URL
+	Scrape *scrape.Config `json:"scrape,omitempty"`
+	// Profile is when profiles were captured from the target's pprof endpoint, with a path resolved against the URL
+	Profile *profile.Config `json:"profile,omitempty"`
+	// Abort is when the test would be stopped early
+	Abort *abort.Config     `json:"abort,omitempty"`
+	Tags  map[string]string `json:"tags,omitempty"`
 }
 
 func (tc *TestConfig) IsSimilar(other TestConfig) bool {
@@ -263,23 +497,46 @@ func (tc *TestConfig) IsSimilar(other TestConfig) bool {
 	if tc.Duration != other.Duration {
 		return false
 	}
+	if tc.Rate != other.Rate {
+		return false
+	}
+	return true
+}
+
+// HasTags reports whether the config carries every one of the given tags
+func (tc *TestConfig) HasTags(tags map[string]string) bool {
+	for key, value := range tags {
+		if tc.Tags[key] != value {
+			return false
+		}
+	}
 	return true
 }
 
-func ToJSONOutput(httpStats []load.HTTPStats, dockerStats []docker.DockerStats, config TestConfig, metrics Metrics) JSONOutput {
+func ToJSONOutput(httpStats []load.HTTPStats, dockerStats []docker.DockerStats, events []docker.Event, config TestConfig, metrics Metrics) JSONOutput {
 	return JSONOutput{
-		Metadata:    config,
-		HTTPStats:   httpStats,
-		DockerStats: dockerStats,
-		Summary:     metrics,
+		SchemaVersion:   SchemaVersion,
+		Metadata:        config,
+		HTTPStats:       httpStats,
+		DockerStats:     dockerStats,
+		Events:          events,
+		Summary:         metrics,
+		originalVersion: SchemaVersion,
 	}
 }
 
+// ReadFromJSON parses a result file, upgrading it to the current schema version if it was written by an older version of loadship
 func ReadFromJSON(data []byte) (*JSONOutput, error) {
+	data, version, err := Migrate(data)
+	if err != nil {
+		return nil, err
+	}
+
 	var output JSONOutput
-	err := json.Unmarshal(data, &output)
+	err = json.Unmarshal(data, &output)
 	if err != nil {
 		return nil, err
 	}
+	output.originalVersion = version
 	return &output, nil
 }
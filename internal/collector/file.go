@@ -0,0 +1,547 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fireproofpenguin/loadship/internal/abort"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+	"github.com/fireproofpenguin/loadship/internal/profile"
+	"github.com/fireproofpenguin/loadship/internal/scrape"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ResultExtensions are the file extensions results can be saved to and read from
+var ResultExtensions = []string{".json", ".json.gz", ".json.zst", ".ndjson", ".ndjson.gz", ".ndjson.zst"}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ResultExt returns the result extension of filename, or an empty string if it is not a supported result file
+func ResultExt(filename string) string {
+	lower := strings.ToLower(filename)
+
+	// Check the longest extensions first so .json.gz is not mistaken for .json
+	var match string
+	for _, ext := range ResultExtensions {
+		if strings.HasSuffix(lower, ext) && len(ext) > len(match) {
+			match = ext
+		}
+	}
+
+	return match
+}
+
+// IsResultFile reports whether filename has one of the supported result extensions
+func IsResultFile(filename string) bool {
+	return ResultExt(filename) != ""
+}
+
+// TrimResultExt removes the result extension from filename, e.g. for naming a report after its results
+func TrimResultExt(filename string) string {
+	return filename[:len(filename)-len(ResultExt(filename))]
+}
+
+// AggregateExt is the extension of the summary of repeated runs, saved next to the results of each run
+const AggregateExt = ".aggregate.json"
+
+// IsAggregateFile reports whether filename is the summary of repeated runs rather than the results of a single run
+func IsAggregateFile(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(filename), AggregateExt)
+}
+
+// RepeatFile names the results of one of several repeated runs, e.g. results.json becomes results_2.json
+func RepeatFile(filename string, repeat int) string {
+	return fmt.Sprintf("%s_%d%s", TrimResultExt(filename), repeat, ResultExt(filename))
+}
+
+// IsStreamFile reports whether filename uses the NDJSON sample stream format
+func IsStreamFile(filename string) bool {
+	return strings.HasPrefix(ResultExt(filename), ".ndjson")
+}
+
+func (jo *JSONOutput) SaveToFile(filename string) error {
+	if !IsResultFile(filename) {
+		return fmt.Errorf("unsupported result file extension for %s, must be one of %s", filename, strings.Join(ResultExtensions, ", "))
+	}
+
+	if IsStreamFile(filename) {
+		return jo.saveToStream(filename)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	w, err := compressWriter(f, filename)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = json.NewEncoder(w).Encode(jo)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (jo *JSONOutput) saveToStream(filename string) error {
+	sw, err := NewStreamWriter(filename, jo.Metadata)
+	if err != nil {
+		return err
+	}
+
+	for _, stat := range jo.HTTPStats {
+		sw.ObserveHTTP(stat)
+	}
+	for _, stat := range jo.DockerStats {
+		sw.ObserveDocker(stat)
+	}
+	for _, event := range jo.Events {
+		sw.ObserveEvent(event)
+	}
+	sw.WriteLogs(jo.Logs)
+	sw.WriteScraped(jo.Scraped)
+	sw.WriteProfiles(jo.Profiles)
+	sw.WriteAbort(jo.Abort)
+
+	return sw.Close(jo.Summary)
+}
+
+// ReadFromFile reads a result file in any of the supported formats. Compression is detected from the file contents.
+func ReadFromFile(filename string) (*JSONOutput, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := decompressReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if IsStreamFile(filename) {
+		return readStream(r)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadFromJSON(data)
+}
+
+// ReadMetadataFromFile reads only the test config from a result file, avoiding holding every sample in memory
+func ReadMetadataFromFile(filename string) (*TestConfig, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := decompressReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var partial struct {
+		SchemaVersion int             `json:"schema_version"`
+		Metadata      json.RawMessage `json:"metadata"`
+	}
+
+	// The first line of a stream holds the metadata, so only that needs decoding
+	if err := json.NewDecoder(r).Decode(&partial); err != nil {
+		return nil, err
+	}
+
+	if partial.Metadata == nil {
+		return nil, fmt.Errorf("%s is not a loadship result", filename)
+	}
+
+	// Upgrade just the metadata of older results so it reads the same as a full ReadFromFile
+	data, err := json.Marshal(partial)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err = Migrate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrated struct {
+		Metadata *TestConfig `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &migrated); err != nil {
+		return nil, err
+	}
+
+	if migrated.Metadata == nil || migrated.Metadata.Timestamp.IsZero() {
+		return nil, fmt.Errorf("%s is not a loadship result", filename)
+	}
+
+	return migrated.Metadata, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func compressWriter(w io.Writer, filename string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(strings.ToLower(filename), ".gz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(strings.ToLower(filename), ".zst"):
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
+
+func decompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReadCloser{decoder}, nil
+	}
+
+	return io.NopCloser(br), nil
+}
+
+// streamRecord is a single line of an NDJSON result stream.
+// The first line holds the schema version and metadata, followed by one line per sample or container event, the per-second log counts, scraped samples, captured profiles, why the run was aborted if it was and finally the summary.
+type streamRecord struct {
+	SchemaVersion int                 `json:"schema_version,omitempty"`
+	Metadata      *TestConfig         `json:"metadata,omitempty"`
+	HTTP          *load.HTTPStats     `json:"http,omitempty"`
+	Docker        *docker.DockerStats `json:"docker,omitempty"`
+	Event         *docker.Event       `json:"event,omitempty"`
+	Logs          *LogBucket          `json:"logs,omitempty"`
+	Scraped       *scrape.Sample      `json:"scraped,omitempty"`
+	Profile       *profile.Capture    `json:"profile,omitempty"`
+	Abort         *abort.Reason       `json:"abort,omitempty"`
+	Summary       *Metrics            `json:"summary,omitempty"`
+}
+
+func readStream(r io.Reader) (*JSONOutput, error) {
+	decoder := json.NewDecoder(r)
+
+	var rawHeader json.RawMessage
+	if err := decoder.Decode(&rawHeader); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+
+	var header streamRecord
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+
+	if header.Metadata == nil {
+		return nil, fmt.Errorf("stream does not start with metadata")
+	}
+
+	if header.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("result uses schema version %d which is newer than the supported version %d, please upgrade loadship", header.SchemaVersion, SchemaVersion)
+	}
+
+	if header.SchemaVersion < SchemaVersion {
+		return readLegacyStream(header.SchemaVersion, rawHeader, decoder)
+	}
+
+	output := &JSONOutput{
+		SchemaVersion:   header.SchemaVersion,
+		Metadata:        *header.Metadata,
+		originalVersion: header.SchemaVersion,
+	}
+
+	var summary *Metrics
+
+	for {
+		var record streamRecord
+		done, err := decodeStreamRecord(decoder, &record, summary != nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if done {
+			break
+		}
+
+		switch {
+		case record.HTTP != nil:
+			output.HTTPStats = append(output.HTTPStats, *record.HTTP)
+		case record.Docker != nil:
+			output.DockerStats = append(output.DockerStats, *record.Docker)
+		case record.Event != nil:
+			output.Events = append(output.Events, *record.Event)
+		case record.Logs != nil:
+			output.Logs = append(output.Logs, *record.Logs)
+		case record.Scraped != nil:
+			output.Scraped = append(output.Scraped, *record.Scraped)
+		case record.Profile != nil:
+			output.Profiles = append(output.Profiles, *record.Profile)
+		case record.Abort != nil:
+			output.Abort = record.Abort
+		case record.Summary != nil:
+			summary = record.Summary
+		}
+	}
+
+	if summary == nil {
+		// The run never finished so the summary was not written, rebuild it from the samples we have
+		summary = Calculate(output.HTTPStats, output.DockerStats, output.Events, output.Abort.Duration(output.Metadata.Duration))
+		if output.Metadata.Logs {
+			summary.AddLogs(output.Metadata.Containers, output.Logs, output.Metadata.LogPatterns)
+		}
+		summary.AddScraped(output.Scraped)
+	}
+
+	output.Summary = *summary
+
+	return output, nil
+}
+
+// decodeStreamRecord decodes the next line of a stream, reporting whether the end of the stream has been reached
+func decodeStreamRecord(decoder *json.Decoder, record any, hasSummary bool) (bool, error) {
+	err := decoder.Decode(record)
+
+	if err == io.EOF {
+		return true, nil
+	}
+
+	if err != nil {
+		// A run that was interrupted leaves a truncated final line, keep everything before it
+		var syntaxErr *json.SyntaxError
+		if !hasSummary && (errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &syntaxErr)) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return false, nil
+}
+
+// readLegacyStream reassembles a stream written with an older schema version into a single document
+// so it can be upgraded by the same migrations as JSON results
+func readLegacyStream(version int, rawHeader json.RawMessage, decoder *json.Decoder) (*JSONOutput, error) {
+	type rawRecord struct {
+		Metadata json.RawMessage `json:"metadata,omitempty"`
+		HTTP     json.RawMessage `json:"http,omitempty"`
+		Docker   json.RawMessage `json:"docker,omitempty"`
+		Summary  json.RawMessage `json:"summary,omitempty"`
+	}
+
+	var header rawRecord
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, err
+	}
+
+	doc := struct {
+		SchemaVersion int               `json:"schema_version"`
+		Metadata      json.RawMessage   `json:"metadata"`
+		HTTPStats     []json.RawMessage `json:"http_stats"`
+		DockerStats   []json.RawMessage `json:"docker_stats,omitempty"`
+		Summary       json.RawMessage   `json:"summary,omitempty"`
+	}{
+		SchemaVersion: version,
+		Metadata:      header.Metadata,
+	}
+
+	for {
+		var record rawRecord
+		done, err := decodeStreamRecord(decoder, &record, doc.Summary != nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if done {
+			break
+		}
+
+		switch {
+		case record.HTTP != nil:
+			doc.HTTPStats = append(doc.HTTPStats, record.HTTP)
+		case record.Docker != nil:
+			doc.DockerStats = append(doc.DockerStats, record.Docker)
+		case record.Summary != nil:
+			doc.Summary = record.Summary
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := ReadFromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Summary == nil {
+		output.Summary = *Calculate(output.HTTPStats, output.DockerStats, output.Events, output.Metadata.Duration)
+	}
+
+	return output, nil
+}
+
+// StreamWriter writes samples to an NDJSON result stream as they are collected, so long tests never need to
+// serialise every sample at once and an interrupted run still leaves its samples on disk.
+// It is safe for concurrent use.
+type StreamWriter struct {
+	mu      sync.Mutex
+	file    *os.File
+	writer  io.WriteCloser
+	buf     *bufio.Writer
+	encoder *json.Encoder
+	err     error
+}
+
+// NewStreamWriter creates filename and writes the stream header
+func NewStreamWriter(filename string, config TestConfig) (*StreamWriter, error) {
+	if !IsStreamFile(filename) {
+		return nil, fmt.Errorf("%s is not a stream file, must be one of .ndjson, .ndjson.gz or .ndjson.zst", filename)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := compressWriter(f, filename)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	buf := bufio.NewWriter(w)
+
+	sw := &StreamWriter{
+		file:    f,
+		writer:  w,
+		buf:     buf,
+		encoder: json.NewEncoder(buf),
+	}
+
+	sw.write(streamRecord{SchemaVersion: SchemaVersion, Metadata: &config})
+
+	if sw.err != nil {
+		sw.writer.Close()
+		sw.file.Close()
+		return nil, sw.err
+	}
+
+	return sw, nil
+}
+
+func (sw *StreamWriter) write(record streamRecord) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	// Only the first error is kept, it is reported when the stream is closed
+	if sw.err != nil {
+		return
+	}
+
+	sw.err = sw.encoder.Encode(record)
+}
+
+func (sw *StreamWriter) ObserveHTTP(stat load.HTTPStats) {
+	sw.write(streamRecord{HTTP: &stat})
+}
+
+func (sw *StreamWriter) ObserveDocker(stat docker.DockerStats) {
+	sw.write(streamRecord{Docker: &stat})
+}
+
+func (sw *StreamWriter) ObserveEvent(event docker.Event) {
+	sw.write(streamRecord{Event: &event})
+}
+
+// WriteLogs writes the per-second log counts, which are only known once the run is over
+func (sw *StreamWriter) WriteLogs(buckets []LogBucket) {
+	for _, bucket := range buckets {
+		sw.write(streamRecord{Logs: &bucket})
+	}
+}
+
+// WriteScraped writes the samples scraped from the target's metrics endpoints
+func (sw *StreamWriter) WriteScraped(samples []scrape.Sample) {
+	for _, sample := range samples {
+		sw.write(streamRecord{Scraped: &sample})
+	}
+}
+
+// WriteProfiles writes the profiles captured during the run
+func (sw *StreamWriter) WriteProfiles(captures []profile.Capture) {
+	for _, capture := range captures {
+		sw.write(streamRecord{Profile: &capture})
+	}
+}
+
+// WriteAbort writes why the run was aborted, if it was
+func (sw *StreamWriter) WriteAbort(reason *abort.Reason) {
+	if reason != nil {
+		sw.write(streamRecord{Abort: reason})
+	}
+}
+
+// Close writes the summary and closes the stream
+func (sw *StreamWriter) Close(summary Metrics) error {
+	sw.write(streamRecord{Summary: &summary})
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	err := sw.err
+	if flushErr := sw.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := sw.writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := sw.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
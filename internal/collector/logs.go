@@ -0,0 +1,185 @@
+package collector
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+)
+
+// LogBucket counts the lines a container logged during one second of the test
+type LogBucket struct {
+	Timestamp time.Time `json:"timestamp"`
+	Container string    `json:"container"`
+	Lines     int       `json:"lines"`
+	// Matches counts the lines matching each log pattern, patterns without a match are left out
+	Matches map[string]int `json:"matches,omitempty"`
+}
+
+// LogMetrics summarises what a container logged during the test
+type LogMetrics struct {
+	Lines              int `json:"lines"`
+	PeakLinesPerSecond int `json:"peak_lines_per_sec"`
+	// Matches counts the lines matching each log pattern, including patterns that never matched
+	Matches map[string]int `json:"matches,omitempty"`
+}
+
+// AddLogs summarises the log buckets into the metrics of the containers whose logs were captured. Containers that
+// weren't otherwise monitored get an entry of their own.
+func (m *Metrics) AddLogs(containers []string, buckets []LogBucket, patterns []string) {
+	byContainer := make(map[string]*LogMetrics)
+	for _, container := range containers {
+		logs := &LogMetrics{}
+		if len(patterns) > 0 {
+			logs.Matches = make(map[string]int)
+			for _, pattern := range patterns {
+				logs.Matches[pattern] = 0
+			}
+		}
+		byContainer[container] = logs
+	}
+
+	for _, bucket := range buckets {
+		logs, ok := byContainer[bucket.Container]
+		if !ok {
+			continue
+		}
+
+		logs.Lines += bucket.Lines
+		logs.PeakLinesPerSecond = max(logs.PeakLinesPerSecond, bucket.Lines)
+		for pattern, count := range bucket.Matches {
+			if logs.Matches == nil {
+				logs.Matches = make(map[string]int)
+			}
+			logs.Matches[pattern] += count
+		}
+	}
+
+	for _, container := range slices.Sorted(maps.Keys(byContainer)) {
+		metrics := m.Container(container)
+		if metrics == nil {
+			m.Containers = append(m.Containers, DockerMetrics{Container: container})
+			slices.SortFunc(m.Containers, func(a, b DockerMetrics) int {
+				return cmp.Compare(a.Container, b.Container)
+			})
+			metrics = m.Container(container)
+		}
+		metrics.Logs = byContainer[container]
+	}
+}
+
+// LogCapture writes the monitored containers' logs to a file and counts the lines logged each second, and how many
+// of them match each pattern. It is safe for concurrent use.
+type LogCapture struct {
+	mu       sync.Mutex
+	file     *os.File
+	buf      *bufio.Writer
+	patterns []*regexp.Regexp
+	buckets  map[logBucketKey]*LogBucket
+	err      error
+}
+
+type logBucketKey struct {
+	second    int64
+	container string
+}
+
+// NewLogCapture creates filename to write the logs to. Patterns are regular expressions, e.g. ERROR or (?i)panic.
+func NewLogCapture(filename string, patterns []string) (*LogCapture, error) {
+	compiled, err := CompileLogPatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogCapture{
+		file:     f,
+		buf:      bufio.NewWriter(f),
+		patterns: compiled,
+		buckets:  make(map[logBucketKey]*LogBucket),
+	}, nil
+}
+
+// CompileLogPatterns checks every pattern is a valid regular expression
+func CompileLogPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func (lc *LogCapture) ObserveHTTP(load.HTTPStats) {}
+
+func (lc *LogCapture) ObserveDocker(docker.DockerStats) {}
+
+func (lc *LogCapture) ObserveLog(line docker.LogLine) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	// Only the first error is kept, it is reported when the capture is closed
+	if lc.err == nil {
+		_, lc.err = fmt.Fprintf(lc.buf, "%s %s %s: %s\n", line.Timestamp.Format(time.RFC3339Nano), line.Container, line.Stream, line.Text)
+	}
+
+	key := logBucketKey{second: line.Timestamp.Unix(), container: line.Container}
+	bucket, ok := lc.buckets[key]
+	if !ok {
+		bucket = &LogBucket{Timestamp: time.Unix(key.second, 0), Container: line.Container}
+		lc.buckets[key] = bucket
+	}
+
+	bucket.Lines++
+	for _, pattern := range lc.patterns {
+		if !pattern.MatchString(line.Text) {
+			continue
+		}
+		if bucket.Matches == nil {
+			bucket.Matches = make(map[string]int)
+		}
+		bucket.Matches[pattern.String()]++
+	}
+}
+
+// Close closes the log file and returns the per-second counts, ordered by time and then container
+func (lc *LogCapture) Close() ([]LogBucket, error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	err := lc.err
+	if flushErr := lc.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := lc.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	buckets := make([]LogBucket, 0, len(lc.buckets))
+	for _, bucket := range lc.buckets {
+		buckets = append(buckets, *bucket)
+	}
+	slices.SortFunc(buckets, func(a, b LogBucket) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Container, b.Container)
+	})
+
+	return buckets, err
+}
@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the JSON result format written by this version of loadship.
+// Bump it and add a migration whenever a change to the output would break reading older files.
+const SchemaVersion = 2
+
+// migration upgrades a raw result document by a single schema version
+type migration func(doc map[string]any) error
+
+// migrations are keyed by the version they upgrade from
+var migrations = map[int]migration{
+	0: migrateV0ToV1,
+	1: migrateV1ToV2,
+}
+
+// Files written before schema versioning was introduced have no schema_version field
+// but are otherwise identical to version 1
+func migrateV0ToV1(doc map[string]any) error {
+	return nil
+}
+
+// Version 2 monitors any number of containers: container_name became a containers list, every docker sample
+// names its container and the single docker_metrics summary became one entry per container in containers
+func migrateV1ToV2(doc map[string]any) error {
+	var container string
+
+	if metadata, ok := doc["metadata"].(map[string]any); ok {
+		container, _ = metadata["container_name"].(string)
+		delete(metadata, "container_name")
+		if container != "" {
+			metadata["containers"] = []any{container}
+		}
+	}
+
+	if stats, ok := doc["docker_stats"].([]any); ok {
+		for _, stat := range stats {
+			if stat, ok := stat.(map[string]any); ok {
+				stat["container"] = container
+			}
+		}
+	}
+
+	if summary, ok := doc["summary"].(map[string]any); ok {
+		dockerMetrics, ok := summary["docker_metrics"].(map[string]any)
+		delete(summary, "docker_metrics")
+
+		// Results without a container still had an empty docker_metrics summary, which is dropped
+		if ok && container != "" {
+			dockerMetrics["container"] = container
+			summary["containers"] = []any{dockerMetrics}
+		}
+	}
+
+	return nil
+}
+
+// Migrate upgrades a result document to the current schema version.
+// It returns the upgraded document and the version the document was originally written with.
+// Documents already at the current version are returned unchanged.
+func Migrate(data []byte) ([]byte, int, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, 0, err
+	}
+
+	version := header.SchemaVersion
+
+	if version == SchemaVersion {
+		return data, version, nil
+	}
+
+	if version > SchemaVersion {
+		return nil, version, fmt.Errorf("result uses schema version %d which is newer than the supported version %d, please upgrade loadship", version, SchemaVersion)
+	}
+
+	// Numbers are kept as json.Number so large values such as nanosecond durations survive the round trip
+	var doc map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, version, err
+	}
+
+	for v := version; v < SchemaVersion; v++ {
+		migrate, ok := migrations[v]
+		if !ok {
+			return nil, version, fmt.Errorf("no migration available from schema version %d", v)
+		}
+
+		if err := migrate(doc); err != nil {
+			return nil, version, fmt.Errorf("failed to migrate from schema version %d to %d: %w", v, v+1, err)
+		}
+
+		doc["schema_version"] = v + 1
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, version, err
+	}
+
+	return migrated, version, nil
+}
+
+//go:embed schema.json
+var schema []byte
+
+// Schema returns the JSON Schema describing the current result format
+func Schema() []byte {
+	return schema
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/fireproofpenguin/loadship/internal/scrape"
+)
+
+// SeriesMetrics summarises a series scraped from the target's metrics endpoints. Gauges are summarised by their
+// values and counters by how much they grew.
+type SeriesMetrics struct {
+	Target  string  `json:"target"`
+	Series  string  `json:"series"`
+	Type    string  `json:"type"`
+	Average float64 `json:"average,omitempty"`
+	Min     float64 `json:"min,omitempty"`
+	Max     float64 `json:"max,omitempty"`
+	Last    float64 `json:"last,omitempty"`
+	// Increase is how much a counter grew during the test, Rate the increase per second
+	Increase float64 `json:"increase,omitempty"`
+	Rate     float64 `json:"rate,omitempty"`
+}
+
+// AddScraped summarises the scraped samples of each series, ordered by target and series
+func (m *Metrics) AddScraped(samples []scrape.Sample) {
+	type key struct{ target, series string }
+
+	bySeries := make(map[key][]scrape.Sample)
+	for _, sample := range samples {
+		k := key{sample.Target, sample.Series}
+		bySeries[k] = append(bySeries[k], sample)
+	}
+
+	m.Scraped = nil
+	for k, series := range bySeries {
+		m.Scraped = append(m.Scraped, calculateSeries(k.target, k.series, series))
+	}
+	slices.SortFunc(m.Scraped, func(a, b SeriesMetrics) int {
+		return cmp.Or(cmp.Compare(a.Target, b.Target), cmp.Compare(a.Series, b.Series))
+	})
+}
+
+func calculateSeries(target, series string, samples []scrape.Sample) SeriesMetrics {
+	metrics := SeriesMetrics{Target: target, Series: series, Type: samples[0].Type}
+
+	if metrics.Type == scrape.TypeCounter {
+		for i := 1; i < len(samples); i++ {
+			// A counter that went backwards was reset, e.g. the target restarted, so it grew by its new value
+			if delta := samples[i].Value - samples[i-1].Value; delta >= 0 {
+				metrics.Increase += delta
+			} else {
+				metrics.Increase += samples[i].Value
+			}
+		}
+		if elapsed := samples[len(samples)-1].Timestamp.Sub(samples[0].Timestamp).Seconds(); elapsed > 0 {
+			metrics.Rate = metrics.Increase / elapsed
+		}
+		return metrics
+	}
+
+	metrics.Min, metrics.Max = samples[0].Value, samples[0].Value
+	var total float64
+	for _, sample := range samples {
+		total += sample.Value
+		metrics.Min = min(metrics.Min, sample.Value)
+		metrics.Max = max(metrics.Max, sample.Value)
+	}
+	metrics.Average = total / float64(len(samples))
+	metrics.Last = samples[len(samples)-1].Value
+
+	return metrics
+}
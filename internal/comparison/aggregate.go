@@ -0,0 +1,184 @@
+package comparison
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+)
+
+// ConfidenceLevel of the intervals in an aggregate
+const ConfidenceLevel = 0.95
+
+// MetricStats summarises a metric across repeated runs
+type MetricStats struct {
+	Name   string  `json:"name"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	// CILow and CIHigh bound the confidence interval of the mean, from Student's t-distribution
+	CILow  float64 `json:"ci_low"`
+	CIHigh float64 `json:"ci_high"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	// Values are the metric of each run, in the order they ran
+	Values        []float64 `json:"values"`
+	LowerIsBetter bool      `json:"lower_is_better,omitempty"`
+	Format        string    `json:"format"`
+}
+
+// Aggregate summarises repeated runs of the same config, so a difference can be judged against the variance
+// between runs rather than a single noisy one
+type Aggregate struct {
+	SchemaVersion int `json:"schema_version"`
+	// Metadata is the config of the first run
+	Metadata collector.TestConfig `json:"metadata"`
+	// Runs are the result files of every run, relative to the aggregate
+	Runs    []string      `json:"runs"`
+	Metrics []MetricStats `json:"metrics"`
+}
+
+// NewAggregate summarises every metric compared between results across the runs saved to files. Metrics are
+// matched by name, container metrics are prefixed with the container's name.
+func NewAggregate(files []string, outputs []*collector.JSONOutput) *Aggregate {
+	aggregate := &Aggregate{SchemaVersion: collector.SchemaVersion}
+	if len(outputs) == 0 {
+		return aggregate
+	}
+	aggregate.Metadata = outputs[0].Metadata
+
+	for _, file := range files {
+		aggregate.Runs = append(aggregate.Runs, filepath.Base(file))
+	}
+
+	runs := make([][]MetricChange, len(outputs))
+	for i, output := range outputs {
+		runs[i] = summaryMetrics(output)
+	}
+
+	for _, metric := range runs[0] {
+		var values []float64
+		for _, run := range runs {
+			for _, m := range run {
+				if m.Name == metric.Name {
+					values = append(values, m.Test)
+					break
+				}
+			}
+		}
+		aggregate.Metrics = append(aggregate.Metrics, newMetricStats(metric, values))
+	}
+
+	return aggregate
+}
+
+// summaryMetrics are the metrics of a result that comparisons look at, as the test side of comparing it with itself
+func summaryMetrics(output *collector.JSONOutput) []MetricChange {
+	return Compare([]*collector.JSONOutput{output, output})[0].Changes()
+}
+
+func newMetricStats(metric MetricChange, values []float64) MetricStats {
+	m := mean(values)
+	stddev := math.Sqrt(variance(values, m))
+
+	stats := MetricStats{
+		Name:          metric.Name,
+		Mean:          m,
+		StdDev:        stddev,
+		CILow:         m,
+		CIHigh:        m,
+		Min:           math.Inf(1),
+		Max:           math.Inf(-1),
+		Values:        values,
+		LowerIsBetter: metric.LowerIsBetter,
+		Format:        metric.Format,
+	}
+	for _, v := range values {
+		stats.Min = min(stats.Min, v)
+		stats.Max = max(stats.Max, v)
+	}
+
+	if len(values) > 1 {
+		margin := tCritical(float64(len(values)-1)) * stddev / math.Sqrt(float64(len(values)))
+		stats.CILow, stats.CIHigh = m-margin, m+margin
+	}
+
+	return stats
+}
+
+// tCritical is the value of Student's t-distribution with df degrees of freedom that a two-sided test at the
+// confidence level exceeds, found by bisection of the p-value
+func tCritical(df float64) float64 {
+	low, high := 0.0, 1000.0
+	for range 100 {
+		t := (low + high) / 2
+		if incompleteBeta(df/2, 0.5, df/(df+t*t)) > 1-ConfidenceLevel {
+			low = t
+		} else {
+			high = t
+		}
+	}
+	return (low + high) / 2
+}
+
+func (a *Aggregate) SaveToFile(filename string) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// ReadAggregate reads an aggregate, without the results of its runs
+func ReadAggregate(filename string) (*Aggregate, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var aggregate Aggregate
+	if err := json.Unmarshal(data, &aggregate); err != nil {
+		return nil, fmt.Errorf("%s is not an aggregate of repeated runs: %w", filename, err)
+	}
+	return &aggregate, nil
+}
+
+// RunFiles are the paths of the results of every run, for the aggregate read from filename
+func (a *Aggregate) RunFiles(filename string) []string {
+	var files []string
+	for _, run := range a.Runs {
+		files = append(files, filepath.Join(filepath.Dir(filename), run))
+	}
+	return files
+}
+
+// ReadRuns reads the results of every run, for the aggregate read from filename
+func (a *Aggregate) ReadRuns(filename string) ([]*collector.JSONOutput, error) {
+	var outputs []*collector.JSONOutput
+	for _, file := range a.RunFiles(filename) {
+		output, err := collector.ReadFromFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading run %s of %s: %w", file, filename, err)
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// Print prints the mean of every metric with its spread across the runs
+func (a *Aggregate) Print() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Printf("\n=== Aggregate of %d runs ===\n", len(a.Runs))
+	fmt.Fprintf(w, "Metric\tMean\tStdDev\t%.0f%% CI\tMin\tMax\n", ConfidenceLevel*100)
+	fmt.Fprintln(w, "------\t----\t------\t------\t---\t---")
+
+	for _, m := range a.Metrics {
+		f := func(v float64) string { return fmt.Sprintf(m.Format, v) }
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s - %s\t%s\t%s\n", m.Name, f(m.Mean), f(m.StdDev), f(m.CILow), f(m.CIHigh), f(m.Min), f(m.Max))
+	}
+
+	w.Flush()
+}
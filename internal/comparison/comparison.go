@@ -2,11 +2,14 @@ package comparison
 
 import (
 	"fmt"
+	"maps"
 	"math"
 	"os"
+	"slices"
 	"text/tabwriter"
 
 	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/scrape"
 )
 
 type MetricChange struct {
@@ -17,6 +20,12 @@ type MetricChange struct {
 	Percent  float64
 	Better   bool
 	Format   string // "%.2f", "%.0f", "%d", etc.
+	// LowerIsBetter is whether a decrease is an improvement, e.g. latency
+	LowerIsBetter bool
+	// Repeats is the number of runs the values are the mean of, the fewer of either side's, when both were repeated
+	Repeats int
+	// PValue is the two-sided p-value of a Welch's t-test between the repeated runs, only set when Repeats > 1
+	PValue float64
 }
 
 func (m MetricChange) BaselineString() string {
@@ -27,6 +36,20 @@ func (m MetricChange) TestString() string {
 	return fmt.Sprintf(m.Format, m.Test)
 }
 
+// IsSignificant reports whether the metric changed by more than 5% from the baseline. For repeated runs the change
+// must instead be unlikely to be noise, with a p-value below SignificanceLevel.
+func (m MetricChange) IsSignificant() bool {
+	if m.Repeats > 1 {
+		return m.Delta != 0 && m.PValue < SignificanceLevel
+	}
+	return m.Baseline != 0 && math.Abs(m.Percent) > 5
+}
+
+// IsRegression reports whether the metric got significantly worse than the baseline
+func (m MetricChange) IsRegression() bool {
+	return m.IsSignificant() && !m.Better
+}
+
 func (m MetricChange) ChangeString() string {
 	sign := ""
 	if m.Delta > 0 {
@@ -37,7 +60,8 @@ func (m MetricChange) ChangeString() string {
 	indicator := ""
 	if m.Baseline == 0 {
 		percentStr = "n/a"
-	} else if math.Abs(m.Percent) > 5 {
+	}
+	if m.IsSignificant() {
 		if m.Better {
 			indicator = "✓"
 		} else {
@@ -46,19 +70,55 @@ func (m MetricChange) ChangeString() string {
 	}
 
 	deltaStr := fmt.Sprintf(m.Format, m.Delta)
+	if m.Repeats > 1 {
+		return fmt.Sprintf("%s%s (%s, p=%.3f) %s", sign, deltaStr, percentStr, m.PValue, indicator)
+	}
 	return fmt.Sprintf("%s%s (%s) %s", sign, deltaStr, percentStr, indicator)
 }
 
+// DockerChanges compares a single container between the baseline and test
 type DockerChanges struct {
-	Memory []MetricChange
-	CPU    []MetricChange
-	DiskIO []MetricChange
-	PIDs   []MetricChange
+	// Container is the name of the container in the test. It can differ from the baseline's when both monitored a single container.
+	Container string
+	Memory    []MetricChange
+	CPU       []MetricChange
+	DiskIO    []MetricChange
+	PIDs      []MetricChange
+	Network   []MetricChange
+	Events    []MetricChange
+	// Logs is only set when both the baseline and test captured the container's logs
+	Logs []MetricChange
 }
 
 type ComparisonReport struct {
-	HTTPChanges   []MetricChange
-	DockerChanges DockerChanges
+	HTTPChanges []MetricChange
+	Containers  []DockerChanges
+	// ScrapedChanges compares the series scraped from the target's metrics endpoints by both
+	ScrapedChanges []MetricChange
+}
+
+// Changes returns every HTTP and docker metric change in the report. Docker metrics are prefixed with their container name.
+func (r *ComparisonReport) Changes() []MetricChange {
+	changes := slices.Clone(r.HTTPChanges)
+	for _, container := range r.Containers {
+		for _, group := range [][]MetricChange{container.Memory, container.CPU, container.DiskIO, container.PIDs, container.Network, container.Events, container.Logs} {
+			for _, change := range group {
+				change.Name = fmt.Sprintf("%s: %s", container.Container, change.Name)
+				changes = append(changes, change)
+			}
+		}
+	}
+	return append(changes, r.ScrapedChanges...)
+}
+
+// container returns the changes of the named container, or nil if it wasn't compared
+func (r *ComparisonReport) container(name string) *DockerChanges {
+	for i := range r.Containers {
+		if r.Containers[i].Container == name {
+			return &r.Containers[i]
+		}
+	}
+	return nil
 }
 
 func (r *ComparisonReport) Print() {
@@ -71,26 +131,58 @@ func (r *ComparisonReport) Print() {
 		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Name, change.BaselineString(), change.TestString(), change.ChangeString())
 	}
 
-	if len(r.DockerChanges.Memory) > 0 {
-		fmt.Fprintln(w, "\n=== Docker Metrics ===")
+	for _, container := range r.Containers {
+		fmt.Fprintf(w, "\n=== Docker Metrics: %s ===\n", container.Container)
 
 		fmt.Fprintln(w, "Memory\tBaseline\tTest\tChange")
 		fmt.Fprintln(w, "------\t------\t------\t------")
-		for _, change := range r.DockerChanges.Memory {
+		for _, change := range container.Memory {
 			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Name, change.BaselineString(), change.TestString(), change.ChangeString())
 		}
 
 		fmt.Fprintln(w)
 		fmt.Fprintln(w, "CPU\tBaseline\tTest\tChange")
 		fmt.Fprintln(w, "------\t------\t------\t------")
-		for _, change := range r.DockerChanges.CPU {
+		for _, change := range container.CPU {
 			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Name, change.BaselineString(), change.TestString(), change.ChangeString())
 		}
 
 		fmt.Fprintln(w)
 		fmt.Fprintln(w, "Disk Op\tBaseline\tTest\tChange")
 		fmt.Fprintln(w, "------\t------\t------\t------")
-		for _, change := range r.DockerChanges.DiskIO {
+		for _, change := range container.DiskIO {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Name, change.BaselineString(), change.TestString(), change.ChangeString())
+		}
+
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Network\tBaseline\tTest\tChange")
+		fmt.Fprintln(w, "------\t------\t------\t------")
+		for _, change := range container.Network {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Name, change.BaselineString(), change.TestString(), change.ChangeString())
+		}
+
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Events\tBaseline\tTest\tChange")
+		fmt.Fprintln(w, "------\t------\t------\t------")
+		for _, change := range container.Events {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Name, change.BaselineString(), change.TestString(), change.ChangeString())
+		}
+
+		if len(container.Logs) > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "Logs\tBaseline\tTest\tChange")
+			fmt.Fprintln(w, "------\t------\t------\t------")
+			for _, change := range container.Logs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Name, change.BaselineString(), change.TestString(), change.ChangeString())
+			}
+		}
+	}
+
+	if len(r.ScrapedChanges) > 0 {
+		fmt.Fprintln(w, "\n=== Application Metrics ===")
+		fmt.Fprintln(w, "Metric\tBaseline\tTest\tChange")
+		fmt.Fprintln(w, "------\t------\t------\t------")
+		for _, change := range r.ScrapedChanges {
 			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Name, change.BaselineString(), change.TestString(), change.ChangeString())
 		}
 	}
@@ -123,8 +215,13 @@ func printMetricSection(w *tabwriter.Writer, reports []*ComparisonReport, getMet
 		}
 	}
 
-	// Get all unique metric names from the first report
-	firstReportMetrics := getMetrics(reports[0])
+	// Get all unique metric names from the first report that has any, as a container may be missing from some tests
+	var firstReportMetrics []MetricChange
+	for _, report := range reports {
+		if firstReportMetrics = getMetrics(report); len(firstReportMetrics) > 0 {
+			break
+		}
+	}
 	for _, metric := range firstReportMetrics {
 		metricName := metric.Name
 		row := fmt.Sprintf("%s\t%s", metricName, metric.BaselineString())
@@ -141,16 +238,17 @@ func printMetricSection(w *tabwriter.Writer, reports []*ComparisonReport, getMet
 	}
 }
 
-// hasDockerMetrics checks if any report contains Docker metrics
-func hasDockerMetrics(reports []*ComparisonReport) bool {
+// containerNames returns every container compared in any of the reports, in the order they first appear
+func containerNames(reports []*ComparisonReport) []string {
+	var names []string
 	for _, report := range reports {
-		if len(report.DockerChanges.Memory) > 0 ||
-			len(report.DockerChanges.CPU) > 0 ||
-			len(report.DockerChanges.DiskIO) > 0 {
-			return true
+		for _, container := range report.Containers {
+			if !slices.Contains(names, container.Container) {
+				names = append(names, container.Container)
+			}
 		}
 	}
-	return false
+	return names
 }
 
 func Compare(outputs []*collector.JSONOutput) []*ComparisonReport {
@@ -160,33 +258,6 @@ func Compare(outputs []*collector.JSONOutput) []*ComparisonReport {
 	var reports []*ComparisonReport
 
 	for _, test := range tests {
-		baselineHasDockerMetrics := len(baseline.DockerStats) > 0
-		testHasDockerMetrics := len(test.DockerStats) > 0
-
-		var memoryChanges, cpuChanges, diskIOChanges, pidChanges []MetricChange
-
-		if baselineHasDockerMetrics && testHasDockerMetrics {
-			memoryChanges = []MetricChange{
-				CalculateMetricChange("Average Memory (MB)", baseline.Summary.DockerMetrics.Memory.Average, test.Summary.DockerMetrics.Memory.Average, true, "%.2f"),
-				CalculateMetricChange("Min Memory (MB)", baseline.Summary.DockerMetrics.Memory.Min, test.Summary.DockerMetrics.Memory.Min, true, "%.2f"),
-				CalculateMetricChange("Max Memory (MB)", baseline.Summary.DockerMetrics.Memory.Max, test.Summary.DockerMetrics.Memory.Max, true, "%.2f"),
-			}
-			cpuChanges = []MetricChange{
-				CalculateMetricChange("Average CPU (%)", baseline.Summary.DockerMetrics.CPU.Average, test.Summary.DockerMetrics.CPU.Average, true, "%.2f"),
-				CalculateMetricChange("Peak CPU (%)", baseline.Summary.DockerMetrics.CPU.Peak, test.Summary.DockerMetrics.CPU.Peak, true, "%.2f"),
-			}
-			diskIOChanges = []MetricChange{
-				CalculateMetricChange("Read (MB)", baseline.Summary.DockerMetrics.DiskIO.ReadMB, test.Summary.DockerMetrics.DiskIO.ReadMB, true, "%.2f"),
-				CalculateMetricChange("Write (MB)", baseline.Summary.DockerMetrics.DiskIO.WriteMB, test.Summary.DockerMetrics.DiskIO.WriteMB, true, "%.2f"),
-			}
-			pidChanges = []MetricChange{
-				CalculateMetricChange("Average PIDs", baseline.Summary.DockerMetrics.PIDs.Average, test.Summary.DockerMetrics.PIDs.Average, true, "%.2f"),
-				CalculateMetricChange("Peak PIDs", baseline.Summary.DockerMetrics.PIDs.Peak, test.Summary.DockerMetrics.PIDs.Peak, true, "%.0f"),
-			}
-		} else if baselineHasDockerMetrics || testHasDockerMetrics {
-			fmt.Println("Warning: Only one of the test results contains Docker metrics. Docker metrics will be skipped in the comparison.")
-		}
-
 		report := &ComparisonReport{
 			HTTPChanges: []MetricChange{
 				CalculateMetricChange("Total Requests", float64(baseline.Summary.HTTPMetrics.Requests.Total), float64(test.Summary.HTTPMetrics.Requests.Total), false, "%.0f"),
@@ -198,12 +269,8 @@ func Compare(outputs []*collector.JSONOutput) []*ComparisonReport {
 				CalculateMetricChange("Latency (p95)", float64(baseline.Summary.HTTPMetrics.Latency.P95), float64(test.Summary.HTTPMetrics.Latency.P95), true, "%.0f"),
 				CalculateMetricChange("Latency (p99)", float64(baseline.Summary.HTTPMetrics.Latency.P99), float64(test.Summary.HTTPMetrics.Latency.P99), true, "%.0f"),
 			},
-			DockerChanges: DockerChanges{
-				Memory: memoryChanges,
-				CPU:    cpuChanges,
-				DiskIO: diskIOChanges,
-				PIDs:   pidChanges,
-			},
+			Containers:     compareContainers(baseline.Summary, test.Summary),
+			ScrapedChanges: compareScraped(baseline.Summary.Scraped, test.Summary.Scraped),
 		}
 
 		reports = append(reports, report)
@@ -212,6 +279,152 @@ func Compare(outputs []*collector.JSONOutput) []*ComparisonReport {
 	return reports
 }
 
+// compareContainers compares each container with the baseline container of the same name.
+// When both monitored a single container they are compared even if the name changed, e.g. app-v1 and app-v2.
+func compareContainers(baseline, test collector.Metrics) []DockerChanges {
+	var changes []DockerChanges
+
+	if len(baseline.Containers) == 1 && len(test.Containers) == 1 {
+		return append(changes, compareContainer(baseline.Containers[0], test.Containers[0]))
+	}
+
+	for _, container := range test.Containers {
+		baselineContainer := baseline.Container(container.Container)
+		if baselineContainer == nil {
+			fmt.Printf("Warning: container %s is not in the baseline results and will be skipped in the comparison.\n", container.Container)
+			continue
+		}
+		changes = append(changes, compareContainer(*baselineContainer, container))
+	}
+
+	for _, container := range baseline.Containers {
+		if test.Container(container.Container) == nil {
+			fmt.Printf("Warning: container %s is only in the baseline results and will be skipped in the comparison.\n", container.Container)
+		}
+	}
+
+	return changes
+}
+
+// compareScraped compares each scraped series with the baseline's series of the same name. Series are matched by
+// endpoint too when either scraped more than one, otherwise endpoints may differ, e.g. blue and green deployments.
+// Lower is taken as better, as most of what's worth scraping is usage: GC time, pool connections, queue depth.
+func compareScraped(baseline, test []collector.SeriesMetrics) []MetricChange {
+	multipleTargets := hasMultipleTargets(baseline) || hasMultipleTargets(test)
+
+	name := func(series collector.SeriesMetrics) string {
+		if multipleTargets {
+			return fmt.Sprintf("%s: %s", series.Target, series.Series)
+		}
+		return series.Series
+	}
+
+	baselineSeries := make(map[string]collector.SeriesMetrics)
+	for _, series := range baseline {
+		baselineSeries[name(series)] = series
+	}
+
+	var changes []MetricChange
+	for _, series := range test {
+		n := name(series)
+		b, ok := baselineSeries[n]
+		if !ok || b.Type != series.Type {
+			continue
+		}
+
+		if series.Type == scrape.TypeCounter {
+			changes = append(changes, CalculateMetricChange(n+" (/s)", b.Rate, series.Rate, true, "%.4g"))
+			continue
+		}
+		changes = append(changes,
+			CalculateMetricChange(n+" (avg)", b.Average, series.Average, true, "%.4g"),
+			CalculateMetricChange(n+" (max)", b.Max, series.Max, true, "%.4g"),
+		)
+	}
+
+	return changes
+}
+
+func hasMultipleTargets(series []collector.SeriesMetrics) bool {
+	for _, s := range series {
+		if s.Target != series[0].Target {
+			return true
+		}
+	}
+	return false
+}
+
+func compareContainer(baseline, test collector.DockerMetrics) DockerChanges {
+	return DockerChanges{
+		Container: test.Container,
+		Memory: []MetricChange{
+			CalculateMetricChange("Average Memory (MB)", baseline.Memory.Average, test.Memory.Average, true, "%.2f"),
+			CalculateMetricChange("Min Memory (MB)", baseline.Memory.Min, test.Memory.Min, true, "%.2f"),
+			CalculateMetricChange("Max Memory (MB)", baseline.Memory.Max, test.Memory.Max, true, "%.2f"),
+			CalculateMetricChange("p50 Memory (MB)", baseline.Memory.P50, test.Memory.P50, true, "%.2f"),
+			CalculateMetricChange("p95 Memory (MB)", baseline.Memory.P95, test.Memory.P95, true, "%.2f"),
+			CalculateMetricChange("Peak Memory (% of limit)", baseline.Memory.PeakPercent, test.Memory.PeakPercent, true, "%.2f"),
+		},
+		CPU: []MetricChange{
+			CalculateMetricChange("Average CPU (%)", baseline.CPU.Average, test.CPU.Average, true, "%.2f"),
+			CalculateMetricChange("p50 CPU (%)", baseline.CPU.P50, test.CPU.P50, true, "%.2f"),
+			CalculateMetricChange("p95 CPU (%)", baseline.CPU.P95, test.CPU.P95, true, "%.2f"),
+			CalculateMetricChange("Peak CPU (%)", baseline.CPU.Peak, test.CPU.Peak, true, "%.2f"),
+			CalculateMetricChange("Throttled Periods (%)", baseline.CPU.ThrottledPercent, test.CPU.ThrottledPercent, true, "%.2f"),
+			CalculateMetricChange("Throttled Time (s)", baseline.CPU.ThrottledSeconds, test.CPU.ThrottledSeconds, true, "%.2f"),
+		},
+		DiskIO: []MetricChange{
+			CalculateMetricChange("Read (MB)", baseline.DiskIO.ReadMB, test.DiskIO.ReadMB, true, "%.2f"),
+			CalculateMetricChange("Write (MB)", baseline.DiskIO.WriteMB, test.DiskIO.WriteMB, true, "%.2f"),
+		},
+		PIDs: []MetricChange{
+			CalculateMetricChange("Average PIDs", baseline.PIDs.Average, test.PIDs.Average, true, "%.2f"),
+			CalculateMetricChange("Peak PIDs", baseline.PIDs.Peak, test.PIDs.Peak, true, "%.0f"),
+		},
+		Network: []MetricChange{
+			CalculateMetricChange("Rx (MB)", baseline.Network.RxMB, test.Network.RxMB, true, "%.2f"),
+			CalculateMetricChange("Tx (MB)", baseline.Network.TxMB, test.Network.TxMB, true, "%.2f"),
+			CalculateMetricChange("Peak Rx (MB/s)", baseline.Network.PeakRxRate, test.Network.PeakRxRate, true, "%.2f"),
+			CalculateMetricChange("Peak Tx (MB/s)", baseline.Network.PeakTxRate, test.Network.PeakTxRate, true, "%.2f"),
+			CalculateMetricChange("Errors", float64(baseline.Network.Errors), float64(test.Network.Errors), true, "%.0f"),
+			CalculateMetricChange("Dropped", float64(baseline.Network.Dropped), float64(test.Network.Dropped), true, "%.0f"),
+		},
+		Events: []MetricChange{
+			CalculateMetricChange("OOM Kills", float64(baseline.Events.OOMKills), float64(test.Events.OOMKills), true, "%.0f"),
+			CalculateMetricChange("Restarts", float64(baseline.Events.Restarts), float64(test.Events.Restarts), true, "%.0f"),
+			CalculateMetricChange("Unhealthy", float64(baseline.Events.Unhealthy), float64(test.Events.Unhealthy), true, "%.0f"),
+		},
+		Logs: compareLogs(baseline.Logs, test.Logs),
+	}
+}
+
+// compareLogs compares the lines logged, and matching each pattern in either, when both captured the logs
+func compareLogs(baseline, test *collector.LogMetrics) []MetricChange {
+	if baseline == nil || test == nil {
+		return nil
+	}
+
+	changes := []MetricChange{
+		CalculateMetricChange("Log Lines", float64(baseline.Lines), float64(test.Lines), true, "%.0f"),
+		CalculateMetricChange("Peak Log Lines/s", float64(baseline.PeakLinesPerSecond), float64(test.PeakLinesPerSecond), true, "%.0f"),
+	}
+
+	patterns := slices.Sorted(maps.Keys(baseline.Matches))
+	for pattern := range test.Matches {
+		if _, ok := baseline.Matches[pattern]; !ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	slices.Sort(patterns)
+
+	for _, pattern := range patterns {
+		name := fmt.Sprintf("Lines Matching %q", pattern)
+		changes = append(changes, CalculateMetricChange(name, float64(baseline.Matches[pattern]), float64(test.Matches[pattern]), true, "%.0f"))
+	}
+
+	return changes
+}
+
 func CalculateMetricChange(name string, baseline, test float64, lowerIsBetter bool, format string) MetricChange {
 	delta := test - baseline
 	percent := 0.0
@@ -228,13 +441,14 @@ func CalculateMetricChange(name string, baseline, test float64, lowerIsBetter bo
 	}
 
 	return MetricChange{
-		Name:     name,
-		Baseline: baseline,
-		Test:     test,
-		Delta:    delta,
-		Percent:  percent,
-		Better:   better,
-		Format:   format,
+		Name:          name,
+		Baseline:      baseline,
+		Test:          test,
+		Delta:         delta,
+		Percent:       percent,
+		Better:        better,
+		Format:        format,
+		LowerIsBetter: lowerIsBetter,
 	}
 }
 
@@ -250,23 +464,49 @@ func PrintComparisonReports(baseline *collector.JSONOutput, reports []*Compariso
 	fmt.Println("\n=== HTTP Metrics ===")
 	printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return r.HTTPChanges })
 
-	// Print Docker metrics if available
-	if hasDockerMetrics(reports) {
-		fmt.Fprintln(w, "\n=== Docker Metrics ===")
+	// Print Docker metrics for each container
+	for _, name := range containerNames(reports) {
+		getContainer := func(r *ComparisonReport) *DockerChanges {
+			if c := r.container(name); c != nil {
+				return c
+			}
+			return &DockerChanges{}
+		}
+
+		fmt.Fprintf(w, "\n=== Docker Metrics: %s ===\n", name)
 		fmt.Fprintln(w, "Memory")
-		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return r.DockerChanges.Memory })
+		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return getContainer(r).Memory })
 
 		fmt.Fprintln(w)
 		fmt.Fprintln(w, "CPU")
-		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return r.DockerChanges.CPU })
+		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return getContainer(r).CPU })
 
 		fmt.Fprintln(w)
 		fmt.Fprintln(w, "Disk I/O")
-		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return r.DockerChanges.DiskIO })
+		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return getContainer(r).DiskIO })
 
 		fmt.Fprintln(w)
 		fmt.Fprintln(w, "PIDs")
-		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return r.DockerChanges.PIDs })
+		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return getContainer(r).PIDs })
+
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Network")
+		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return getContainer(r).Network })
+
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Events")
+		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return getContainer(r).Events })
+
+		if slices.ContainsFunc(reports, func(r *ComparisonReport) bool { return len(getContainer(r).Logs) > 0 }) {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "Logs")
+			printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return getContainer(r).Logs })
+		}
+	}
+
+	if slices.ContainsFunc(reports, func(r *ComparisonReport) bool { return len(r.ScrapedChanges) > 0 }) {
+		fmt.Fprintln(w, "\n=== Application Metrics ===")
+		printMetricSection(w, reports, func(r *ComparisonReport) []MetricChange { return r.ScrapedChanges })
 	}
 
 	w.Flush()
@@ -0,0 +1,276 @@
+package comparison
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+)
+
+// SignificanceLevel is the p-value below which a change between repeated runs is considered real rather than noise
+const SignificanceLevel = 0.05
+
+// verdictMetrics are the HTTP metrics that decide a verdict. Total requests is left out as it follows RPS.
+var verdictMetrics = []string{"Failed Requests", "RPS", "Latency (p50)", "Latency (p95)", "Latency (p99)"}
+
+// CompareRepeated compares repeated runs of a baseline and a test, paired up in the order they ran. Each metric is
+// the mean across the runs and its significance comes from a Welch's t-test between them. When one side has fewer
+// runs, e.g. a single result against an aggregate, its runs are paired up again but only counted once.
+// Containers are paired by position, as each run may have monitored a fresh container with a new name.
+func CompareRepeated(baselines, tests []*collector.JSONOutput) *ComparisonReport {
+	if len(baselines) == 0 || len(tests) == 0 {
+		return &ComparisonReport{}
+	}
+
+	var pairs []*ComparisonReport
+	for i := range max(len(baselines), len(tests)) {
+		pairs = append(pairs, Compare([]*collector.JSONOutput{baselines[i%len(baselines)], tests[i%len(tests)]})[0])
+	}
+
+	combine := func(getMetrics func(*ComparisonReport) []MetricChange) []MetricChange {
+		return combineChanges(pairs, len(baselines), len(tests), getMetrics)
+	}
+
+	report := &ComparisonReport{
+		HTTPChanges:    combine(func(r *ComparisonReport) []MetricChange { return r.HTTPChanges }),
+		ScrapedChanges: combine(func(r *ComparisonReport) []MetricChange { return r.ScrapedChanges }),
+	}
+
+	for i, container := range pairs[0].Containers {
+		compared := true
+		for _, pair := range pairs {
+			compared = compared && i < len(pair.Containers)
+		}
+		if !compared {
+			fmt.Printf("Warning: container %s was not compared in every run and will be skipped.\n", container.Container)
+			continue
+		}
+
+		get := func(group func(DockerChanges) []MetricChange) []MetricChange {
+			return combine(func(r *ComparisonReport) []MetricChange { return group(r.Containers[i]) })
+		}
+
+		report.Containers = append(report.Containers, DockerChanges{
+			Container: container.Container,
+			Memory:    get(func(c DockerChanges) []MetricChange { return c.Memory }),
+			CPU:       get(func(c DockerChanges) []MetricChange { return c.CPU }),
+			DiskIO:    get(func(c DockerChanges) []MetricChange { return c.DiskIO }),
+			PIDs:      get(func(c DockerChanges) []MetricChange { return c.PIDs }),
+			Network:   get(func(c DockerChanges) []MetricChange { return c.Network }),
+			Events:    get(func(c DockerChanges) []MetricChange { return c.Events }),
+			Logs:      get(func(c DockerChanges) []MetricChange { return c.Logs }),
+		})
+	}
+
+	return report
+}
+
+// combineChanges replaces each metric of the pairs with the mean of its values across them. Only the first
+// baselines and tests pairs count towards each side, the rest reuse runs of the side with fewer.
+func combineChanges(pairs []*ComparisonReport, baselines, tests int, getMetrics func(*ComparisonReport) []MetricChange) []MetricChange {
+	var combined []MetricChange
+
+	for _, metric := range getMetrics(pairs[0]) {
+		var baseline, test []float64
+		for i, pair := range pairs {
+			// Matched by name, as scraped series and log patterns can differ between runs
+			index := slices.IndexFunc(getMetrics(pair), func(c MetricChange) bool { return c.Name == metric.Name })
+			if index < 0 {
+				continue
+			}
+			change := getMetrics(pair)[index]
+			if i < baselines {
+				baseline = append(baseline, change.Baseline)
+			}
+			if i < tests {
+				test = append(test, change.Test)
+			}
+		}
+
+		change := CalculateMetricChange(metric.Name, mean(baseline), mean(test), metric.LowerIsBetter, metric.Format)
+		if len(baseline) > 1 && len(test) > 1 {
+			change.Repeats = min(len(baseline), len(test))
+			change.PValue = welchTTest(baseline, test)
+		}
+		combined = append(combined, change)
+	}
+
+	return combined
+}
+
+// Verdict is the overall outcome of a comparison, decided by its key HTTP metrics
+type Verdict string
+
+const (
+	VerdictBetter   Verdict = "better"
+	VerdictWorse    Verdict = "worse"
+	VerdictMixed    Verdict = "mixed"
+	VerdictNoChange Verdict = "no significant difference"
+)
+
+// Verdict reports whether the test is better or worse than the baseline, along with the significant changes in
+// throughput, failures and latency that decided it
+func (r *ComparisonReport) Verdict() (Verdict, []MetricChange) {
+	var changes []MetricChange
+	var better, worse bool
+
+	for _, change := range r.HTTPChanges {
+		if !change.IsSignificant() || !slices.Contains(verdictMetrics, change.Name) {
+			continue
+		}
+		changes = append(changes, change)
+		better = better || change.Better
+		worse = worse || !change.Better
+	}
+
+	switch {
+	case better && worse:
+		return VerdictMixed, changes
+	case better:
+		return VerdictBetter, changes
+	case worse:
+		return VerdictWorse, changes
+	}
+	return VerdictNoChange, changes
+}
+
+// PrintVerdict prints the verdict of the report and the changes behind it
+func (r *ComparisonReport) PrintVerdict(test string) {
+	verdict, changes := r.Verdict()
+
+	fmt.Println("\n=== Verdict ===")
+	switch verdict {
+	case VerdictNoChange:
+		fmt.Printf("No significant difference between %s and the baseline\n", test)
+		return
+	case VerdictMixed:
+		fmt.Printf("%s is better in some ways and worse in others\n", test)
+	default:
+		fmt.Printf("%s is %s than the baseline\n", test, verdict)
+	}
+
+	for _, change := range changes {
+		indicator := "✓"
+		if !change.Better {
+			indicator = "✗"
+		}
+		detail := fmt.Sprintf("%+.2f%%", change.Percent)
+		if change.Baseline == 0 {
+			detail = "n/a"
+		}
+		if change.Repeats > 1 {
+			detail += fmt.Sprintf(", p=%.3f", change.PValue)
+		}
+		fmt.Printf("  %s %s: %s -> %s (%s)\n", indicator, change.Name, change.BaselineString(), change.TestString(), detail)
+	}
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func variance(values []float64, mean float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return sum / float64(len(values)-1)
+}
+
+// welchTTest returns the two-sided p-value of Welch's t-test: the probability of the means differing at least this
+// much if both samples came from the same distribution. It doesn't assume both have the same variance.
+func welchTTest(a, b []float64) float64 {
+	meanA, meanB := mean(a), mean(b)
+	errA := variance(a, meanA) / float64(len(a))
+	errB := variance(b, meanB) / float64(len(b))
+
+	// Runs without any variation, e.g. no failed requests in any run, are only different if their values are
+	if errA+errB == 0 {
+		if meanA == meanB {
+			return 1
+		}
+		return 0
+	}
+
+	t := (meanA - meanB) / math.Sqrt(errA+errB)
+	df := (errA + errB) * (errA + errB) / (errA*errA/float64(len(a)-1) + errB*errB/float64(len(b)-1))
+
+	return incompleteBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// incompleteBeta is the regularized incomplete beta function I_x(a, b), evaluated with a continued fraction
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	// The continued fraction converges quickly only below this point, use the symmetry I_x(a, b) = 1 - I_1-x(b, a) above it
+	if x > (a+1)/(a+b+2) {
+		return 1 - incompleteBeta(b, a, 1-x)
+	}
+
+	lgammaAB, _ := math.Lgamma(a + b)
+	lgammaA, _ := math.Lgamma(a)
+	lgammaB, _ := math.Lgamma(b)
+	front := math.Exp(lgammaAB-lgammaA-lgammaB+a*math.Log(x)+b*math.Log(1-x)) / a
+
+	// Lentz's algorithm
+	const tiny = 1e-30
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	f := d
+
+	for m := 1; m <= 200; m++ {
+		fm := float64(m)
+
+		// Even step
+		numerator := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		f *= d * c
+
+		// Odd step
+		numerator = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		f *= delta
+
+		if math.Abs(delta-1) < 1e-12 {
+			break
+		}
+	}
+
+	return front * f
+}
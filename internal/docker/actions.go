@@ -0,0 +1,108 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/moby/moby/api/pkg/stdcopy"
+	moby "github.com/moby/moby/client"
+)
+
+// Actions that can be taken on a container between runs, e.g. to restart a dependency or flush a cache with exec
+const (
+	ActionRestart = "restart"
+	ActionStart   = "start"
+	ActionStop    = "stop"
+	ActionExec    = "exec"
+)
+
+// Actions lists every supported container action
+var Actions = []string{ActionRestart, ActionStart, ActionStop, ActionExec}
+
+// stopTimeout is how many seconds a container has to stop gracefully before it is killed
+const stopTimeout = 10
+
+// ContainerAction restarts, starts or stops a container, returning once the daemon has done so
+func ContainerAction(ctx context.Context, conn Connection, container, action string) error {
+	cli, err := conn.newClient(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer cli.Close()
+
+	timeout := stopTimeout
+	switch action {
+	case ActionRestart:
+		_, err = cli.ContainerRestart(ctx, container, moby.ContainerRestartOptions{Timeout: &timeout})
+	case ActionStart:
+		_, err = cli.ContainerStart(ctx, container, moby.ContainerStartOptions{})
+	case ActionStop:
+		_, err = cli.ContainerStop(ctx, container, moby.ContainerStopOptions{Timeout: &timeout})
+	default:
+		return fmt.Errorf("unsupported container action %q", action)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to %s container %s: %w", action, container, err)
+	}
+	return nil
+}
+
+// Exec runs a command in a running container, writing its stdout and stderr to output, and returns its exit code
+func Exec(ctx context.Context, conn Connection, container string, command []string, output io.Writer) (int, error) {
+	cli, err := conn.newClient(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer cli.Close()
+
+	created, err := cli.ExecCreate(ctx, container, moby.ExecCreateOptions{
+		Cmd:          command,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to exec in container %s: %w", container, err)
+	}
+
+	attached, err := cli.ExecAttach(ctx, created.ID, moby.ExecAttachOptions{})
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to exec in container %s: %w", container, err)
+	}
+
+	// The hijacked connection ignores ctx, so it is closed to stop reading when ctx is done first
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			attached.Close()
+		case <-done:
+		}
+	}()
+
+	_, err = stdcopy.StdCopy(output, output, attached.Reader)
+	attached.Close()
+
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading exec output failed: %w", err)
+	}
+
+	inspect, err := cli.ExecInspect(ctx, created.ID, moby.ExecInspectOptions{})
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+
+	return inspect.ExitCode, nil
+}
@@ -0,0 +1,183 @@
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/go-sdk/client"
+	dockercontext "github.com/docker/go-sdk/context"
+	moby "github.com/moby/moby/client"
+)
+
+// Connection is the docker daemon containers are monitored through. The zero value connects the same way the docker
+// CLI does, from DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH or the current docker context.
+// Podman is supported through its docker compatible API socket.
+type Connection struct {
+	// Host is the daemon address, e.g. unix:///run/podman/podman.sock, tcp://10.0.0.5:2376 or ssh://user@loadtest-vm
+	Host string `json:"host,omitempty"`
+	// Context is the name of a docker context to take the host from, ignored when Host is set
+	Context string `json:"context,omitempty"`
+	// CertPath is a directory holding ca.pem, cert.pem and key.pem for connecting over TLS, ~/.docker by default
+	CertPath string `json:"cert_path,omitempty" yaml:"cert_path"`
+	// TLSVerify connects over TLS and verifies the daemon's certificate against ca.pem
+	TLSVerify bool `json:"tls_verify,omitempty" yaml:"tls_verify"`
+}
+
+func (c Connection) IsDefault() bool {
+	return c == Connection{}
+}
+
+// String is the daemon the connection resolves to and where it came from, e.g. ssh://user@vm (configured)
+func (c Connection) String() string {
+	endpoint, err := c.resolve()
+	if err != nil {
+		return "docker"
+	}
+	return endpoint.String()
+}
+
+// endpoint is a resolved daemon address along with where it came from, so connection errors can say which
+// daemon was tried and why
+type endpoint struct {
+	host   string
+	source string
+}
+
+func (e endpoint) String() string {
+	return fmt.Sprintf("%s (%s)", e.host, e.source)
+}
+
+func (c Connection) resolve() (endpoint, error) {
+	switch {
+	case c.Host != "":
+		return endpoint{host: c.Host, source: "configured"}, nil
+	case c.Context != "":
+		host, err := dockercontext.DockerHostFromContext(c.Context)
+		if err != nil {
+			return endpoint{}, fmt.Errorf("failed to read docker context %q: %w", c.Context, err)
+		}
+		return endpoint{host: host, source: fmt.Sprintf("docker context %q", c.Context)}, nil
+	}
+
+	// DOCKER_HOST is read directly as the current context only accepts unix, npipe and tcp hosts
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return endpoint{host: host, source: "DOCKER_HOST"}, nil
+	}
+
+	// Without a docker config, e.g. on a host that only runs podman, there is no current context to read
+	current, err := dockercontext.Current()
+	if err != nil {
+		current = dockercontext.DefaultContextName
+	}
+
+	host, err := dockercontext.CurrentDockerHost()
+	if current == dockercontext.DefaultContextName {
+		if err != nil {
+			host = moby.DefaultDockerHost
+		}
+		return endpoint{host: host, source: "default"}, nil
+	}
+	if err != nil {
+		return endpoint{}, fmt.Errorf("failed to read docker context %q: %w", current, err)
+	}
+	return endpoint{host: host, source: fmt.Sprintf("docker context %q", current)}, nil
+}
+
+// newClient connects to the daemon, checking it responds before returning. Errors name the endpoint that was used.
+func (c Connection) newClient(ctx context.Context) (client.SDKClient, error) {
+	endpoint, err := c.resolve()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := c.tlsConfig()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificates for docker at %s: %w", endpoint, err)
+	}
+
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	opts := []moby.Opt{moby.WithHTTPClient(&http.Client{Transport: transport}), moby.WithAPIVersionNegotiation()}
+
+	if strings.HasPrefix(endpoint.host, "ssh://") {
+		dial, err := sshDialer(endpoint.host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid docker host %s: %w", endpoint, err)
+		}
+		// The host is only used for the Host header, every connection is made by running docker over ssh
+		opts = append(opts, moby.WithHost("http://docker.example.com"), moby.WithDialContext(dial))
+	} else {
+		opts = append(opts, moby.WithHost(endpoint.host))
+	}
+
+	api, err := moby.New(opts...)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %s: %w", endpoint, err)
+	}
+
+	cli, err := client.New(ctx, client.WithDockerAPI(api))
+
+	if err != nil {
+		api.Close()
+		return nil, fmt.Errorf("failed to connect to docker at %s: %w", endpoint, err)
+	}
+
+	return cli, nil
+}
+
+// tlsConfig follows the docker CLI: TLS is used when certificates are configured, and the daemon's certificate is only
+// verified with TLSVerify. Without any TLS settings DOCKER_CERT_PATH and DOCKER_TLS_VERIFY apply to the default endpoint.
+func (c Connection) tlsConfig() (*tls.Config, error) {
+	certPath, verify := c.CertPath, c.TLSVerify
+
+	if c.IsDefault() {
+		certPath = os.Getenv("DOCKER_CERT_PATH")
+		verify = os.Getenv("DOCKER_TLS_VERIFY") != ""
+	}
+
+	if certPath == "" && !verify {
+		return nil, nil
+	}
+
+	if certPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		certPath = filepath.Join(home, ".docker")
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: !verify}
+
+	if verify {
+		ca, err := os.ReadFile(filepath.Join(certPath, "ca.pem"))
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", filepath.Join(certPath, "ca.pem"))
+		}
+		config.RootCAs = pool
+	}
+
+	// The client certificate is optional, daemons that don't require one can be verified with just ca.pem
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err == nil {
+		config.Certificates = []tls.Certificate{cert}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return config, nil
+}
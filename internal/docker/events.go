@@ -0,0 +1,113 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/moby/moby/api/types/events"
+	moby "github.com/moby/moby/client"
+)
+
+// Event types recorded on the timeline of a run
+const (
+	EventOOM     = "oom"
+	EventExit    = "exit"
+	EventRestart = "restart"
+	EventHealth  = "health"
+)
+
+// Event is a change in a monitored container's lifecycle during the test
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Container string    `json:"container"`
+	Type      string    `json:"type"`
+	// Detail is the exit code of an exit or the new status of a health change
+	Detail string `json:"detail,omitempty"`
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case EventOOM:
+		return fmt.Sprintf("%s was OOM killed", e.Container)
+	case EventExit:
+		return fmt.Sprintf("%s exited with code %s", e.Container, e.Detail)
+	case EventRestart:
+		return fmt.Sprintf("%s restarted", e.Container)
+	case EventHealth:
+		return fmt.Sprintf("%s is %s", e.Container, e.Detail)
+	}
+	return fmt.Sprintf("%s %s", e.Container, e.Type)
+}
+
+// EventObserver is called with every event as soon as it happens
+type EventObserver func(Event)
+
+// WatchEvents records OOM kills, exits, restarts and health status changes of the containers until ctx is done.
+// The containers are running when the test starts, so any start is counted as a restart whether it was
+// triggered by a restart policy or by hand.
+func WatchEvents(ctx context.Context, conn Connection, containers []string, observe EventObserver) ([]Event, error) {
+	var results []Event
+
+	cli, err := conn.newClient(context.Background())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cli.Close()
+
+	filters := make(moby.Filters).
+		Add("type", string(events.ContainerEventType)).
+		Add("container", containers...).
+		Add("event", string(events.ActionOOM), string(events.ActionDie), string(events.ActionStart), string(events.ActionHealthStatus))
+
+	stream := cli.Events(ctx, moby.EventsListOptions{Filters: filters})
+
+	for {
+		select {
+		case message := <-stream.Messages:
+			event, ok := toEvent(message)
+			if !ok {
+				continue
+			}
+			results = append(results, event)
+			if observe != nil {
+				observe(event)
+			}
+		case err := <-stream.Err:
+			if ctx.Err() != nil || err == nil || errors.Is(err, context.Canceled) {
+				return results, nil
+			}
+			return results, fmt.Errorf("watching container events failed: %w", err)
+		case <-ctx.Done():
+			return results, nil
+		}
+	}
+}
+
+func toEvent(message events.Message) (Event, bool) {
+	event := Event{
+		Timestamp: time.Unix(0, message.TimeNano),
+		Container: message.Actor.Attributes["name"],
+	}
+
+	switch {
+	case message.Action == events.ActionOOM:
+		event.Type = EventOOM
+	case message.Action == events.ActionDie:
+		event.Type = EventExit
+		event.Detail = message.Actor.Attributes["exitCode"]
+	case message.Action == events.ActionStart:
+		event.Type = EventRestart
+	case strings.HasPrefix(string(message.Action), string(events.ActionHealthStatus)):
+		event.Type = EventHealth
+		event.Detail = strings.TrimSpace(strings.TrimPrefix(string(message.Action), string(events.ActionHealthStatus)+":"))
+	default:
+		return Event{}, false
+	}
+
+	return event, true
+}
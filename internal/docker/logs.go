@@ -0,0 +1,122 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moby/moby/api/pkg/stdcopy"
+	moby "github.com/moby/moby/client"
+)
+
+// Streams a container can log to
+const (
+	LogStdout = "stdout"
+	LogStderr = "stderr"
+)
+
+// LogLine is a single line a monitored container wrote to stdout or stderr
+type LogLine struct {
+	Timestamp time.Time
+	Container string
+	Stream    string
+	Text      string
+}
+
+// LogObserver is called with every line as soon as it is logged. It is called from one goroutine per stream.
+type LogObserver func(LogLine)
+
+// maxLogLine is the longest line read, longer lines are split
+const maxLogLine = 1024 * 1024
+
+// StreamLogs follows the stdout and stderr of a container until ctx is done. Only lines logged after it starts are
+// observed, not the container's earlier logs.
+func StreamLogs(ctx context.Context, conn Connection, container string, observe LogObserver) error {
+	cli, err := conn.newClient(context.Background())
+
+	if err != nil {
+		return err
+	}
+
+	defer cli.Close()
+
+	inspect, err := cli.ContainerInspect(ctx, container, moby.ContainerInspectOptions{})
+
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	logs, err := cli.ContainerLogs(ctx, container, moby.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: true,
+		Tail:       "0",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to read container logs: %w", err)
+	}
+
+	defer logs.Close()
+
+	var wg sync.WaitGroup
+	scan := func(stream string) io.WriteCloser {
+		r, w := io.Pipe()
+		wg.Go(func() {
+			scanLines(r, container, stream, observe)
+		})
+		return w
+	}
+
+	// Containers with a TTY don't multiplex stdout and stderr, everything arrives as stdout
+	stdout := scan(LogStdout)
+	if inspect.Container.Config != nil && inspect.Container.Config.Tty {
+		_, err = io.Copy(stdout, logs)
+	} else {
+		stderr := scan(LogStderr)
+		_, err = stdcopy.StdCopy(stdout, stderr, logs)
+		stderr.Close()
+	}
+	stdout.Close()
+	wg.Wait()
+
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("reading container logs failed: %w", err)
+	}
+	return nil
+}
+
+func scanLines(r io.ReadCloser, container, stream string, observe LogObserver) {
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLine)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if advance == 0 && err == nil && len(data) >= maxLogLine {
+			return maxLogLine, data[:maxLogLine], nil
+		}
+		return advance, token, err
+	})
+
+	for scanner.Scan() {
+		line := LogLine{Container: container, Stream: stream, Text: scanner.Text()}
+
+		// Lines are prefixed with the time docker received them, e.g. 2025-01-01T12:00:00.123456789Z
+		if timestamp, text, found := strings.Cut(line.Text, " "); found {
+			if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+				line.Timestamp, line.Text = t, text
+			}
+		}
+		if line.Timestamp.IsZero() {
+			line.Timestamp = time.Now()
+		}
+
+		observe(line)
+	}
+}
@@ -0,0 +1,333 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/go-sdk/client"
+	"github.com/docker/go-units"
+	mobyContainer "github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/network"
+	moby "github.com/moby/moby/client"
+)
+
+// ManagedLabel is set on every container loadship starts, so any left behind by a killed run can be found and removed
+// with RemoveLeftovers
+const ManagedLabel = "loadship.managed"
+
+// DefaultReadyTimeout is how long a managed container has to become ready before the run fails
+const DefaultReadyTimeout = time.Minute
+
+// ContainerSpec is a target started from an image for a run and removed afterwards, so every run is against a
+// fresh container with the same resources
+type ContainerSpec struct {
+	Image string `json:"image"`
+	// Port publishes a container port on the same host port, e.g. 8080, or on another one with host:container, e.g. 9000:8080
+	Port string `json:"port,omitempty"`
+	// Env are KEY=VALUE environment variables
+	Env []string `json:"env,omitempty"`
+	// Memory limits the container's memory, e.g. 512m or 2g
+	Memory string `json:"memory,omitempty"`
+	// CPUs limits the container's CPU time, e.g. 1.5
+	CPUs float64 `json:"cpus,omitempty"`
+	// ReadyTimeout is how long the container has to become ready, DefaultReadyTimeout when zero
+	ReadyTimeout time.Duration `json:"ready_timeout,omitempty" yaml:"ready_timeout"`
+}
+
+func (s ContainerSpec) Validate() error {
+	if strings.TrimSpace(s.Image) == "" {
+		return fmt.Errorf("managed container image cannot be empty")
+	}
+	if s.Port != "" {
+		if _, _, err := s.ports(); err != nil {
+			return err
+		}
+	}
+	if s.Memory != "" {
+		if _, err := units.RAMInBytes(s.Memory); err != nil {
+			return fmt.Errorf("invalid memory limit %q: %w", s.Memory, err)
+		}
+	}
+	if s.CPUs < 0 {
+		return fmt.Errorf("cpus cannot be negative")
+	}
+	if s.ReadyTimeout < 0 {
+		return fmt.Errorf("ready timeout cannot be negative")
+	}
+	for _, env := range s.Env {
+		if key, _, _ := strings.Cut(env, "="); key == "" {
+			return fmt.Errorf("invalid environment variable %q: must be KEY=VALUE", env)
+		}
+	}
+	return nil
+}
+
+// ports returns the host port and the container port it is published from
+func (s ContainerSpec) ports() (string, network.Port, error) {
+	hostPort, containerPort, found := strings.Cut(s.Port, ":")
+	if !found {
+		containerPort = hostPort
+	}
+
+	if _, err := strconv.ParseUint(hostPort, 10, 16); err != nil {
+		return "", network.Port{}, fmt.Errorf("invalid port %q: must be a port or host:container", s.Port)
+	}
+
+	port, err := network.ParsePort(containerPort)
+	if err != nil {
+		return "", network.Port{}, fmt.Errorf("invalid port %q: %w", s.Port, err)
+	}
+
+	return hostPort, port, nil
+}
+
+// ManagedContainer is a container started by loadship from a ContainerSpec
+type ManagedContainer struct {
+	// Name is the generated container name the container is monitored under
+	Name string
+	// URL is the root of the published port on the docker host, the default target of the run
+	URL string
+
+	id  string
+	cli client.SDKClient
+}
+
+var imageNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// StartContainer pulls the image if it isn't present yet and starts a container from it. The container must be
+// removed with Remove once the run is over.
+func StartContainer(ctx context.Context, conn Connection, spec ContainerSpec) (*ManagedContainer, error) {
+	cli, err := conn.newClient(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pullIfMissing(ctx, cli, spec.Image); err != nil {
+		cli.Close()
+		return nil, err
+	}
+
+	// e.g. loadship-myapp-1.4.2-20250101-120000
+	repository, tag, _ := strings.Cut(spec.Image[strings.LastIndex(spec.Image, "/")+1:], ":")
+	name := strings.Trim(imageNameChars.ReplaceAllString(strings.Join([]string{"loadship", repository, tag}, "-"), "-"), "-")
+	name = fmt.Sprintf("%s-%s", name, time.Now().Format("20060102-150405"))
+
+	config := &mobyContainer.Config{
+		Image:  spec.Image,
+		Env:    spec.Env,
+		Labels: map[string]string{ManagedLabel: "true"},
+	}
+	hostConfig := &mobyContainer.HostConfig{}
+
+	m := &ManagedContainer{Name: name, cli: cli}
+
+	if spec.Port != "" {
+		// Already validated
+		hostPort, containerPort, _ := spec.ports()
+		config.ExposedPorts = network.PortSet{containerPort: {}}
+		hostConfig.PortBindings = network.PortMap{containerPort: {{HostPort: hostPort}}}
+		m.URL = fmt.Sprintf("http://%s:%s/", conn.hostname(), hostPort)
+	}
+
+	if spec.Memory != "" {
+		hostConfig.Memory, _ = units.RAMInBytes(spec.Memory)
+	}
+	if spec.CPUs > 0 {
+		hostConfig.NanoCPUs = int64(spec.CPUs * 1e9)
+	}
+
+	created, err := cli.ContainerCreate(ctx, moby.ContainerCreateOptions{Config: config, HostConfig: hostConfig, Name: name})
+
+	if err != nil {
+		cli.Close()
+		return nil, fmt.Errorf("failed to create container from %s: %w", spec.Image, err)
+	}
+	m.id = created.ID
+
+	if _, err := cli.ContainerStart(ctx, m.id, moby.ContainerStartOptions{}); err != nil {
+		m.Remove()
+		return nil, fmt.Errorf("failed to start container from %s: %w", spec.Image, err)
+	}
+
+	return m, nil
+}
+
+func pullIfMissing(ctx context.Context, cli client.SDKClient, image string) error {
+	_, err := cli.ImageInspect(ctx, image)
+	if err == nil {
+		return nil
+	}
+	if !cerrdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to inspect %s: %w", image, err)
+	}
+
+	response, err := cli.ImagePull(ctx, image, moby.ImagePullOptions{})
+
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", image, err)
+	}
+
+	if err := response.Wait(ctx); err != nil {
+		return fmt.Errorf("failed to pull %s: %w", image, err)
+	}
+
+	return nil
+}
+
+// WaitReady waits until the container's healthcheck passes, when the image has one, and the target answers HTTP
+// requests. Any HTTP response counts, as the preflight check does. It fails early if the container exits.
+func (m *ManagedContainer) WaitReady(ctx context.Context, target string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultReadyTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	httpClient := &http.Client{Timeout: 2 * time.Second}
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		lastErr = m.checkReady(ctx, httpClient, target)
+		if lastErr == nil {
+			return nil
+		}
+
+		var exited *exitedError
+		if errors.As(lastErr, &exited) {
+			return lastErr
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("container %s was not ready after %s: %w", m.Name, timeout, lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+type exitedError struct {
+	name     string
+	exitCode int
+}
+
+func (e *exitedError) Error() string {
+	return fmt.Sprintf("container %s exited with code %d before it was ready", e.name, e.exitCode)
+}
+
+func (m *ManagedContainer) checkReady(ctx context.Context, httpClient *http.Client, target string) error {
+	inspect, err := m.cli.ContainerInspect(ctx, m.id, moby.ContainerInspectOptions{})
+
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	state := inspect.Container.State
+	if !state.Running {
+		return &exitedError{name: m.Name, exitCode: state.ExitCode}
+	}
+
+	if state.Health != nil && state.Health.Status != mobyContainer.Healthy {
+		return fmt.Errorf("healthcheck is %s", state.Health.Status)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Remove stops and removes the container. It is safe to call more than once.
+func (m *ManagedContainer) Remove() error {
+	if m.cli == nil {
+		return nil
+	}
+	defer func() {
+		m.cli.Close()
+		m.cli = nil
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Stop gracefully first so the target can shut down cleanly, the forced remove takes care of it otherwise
+	timeout := 10
+	m.cli.ContainerStop(ctx, m.id, moby.ContainerStopOptions{Timeout: &timeout})
+
+	if _, err := m.cli.ContainerRemove(ctx, m.id, moby.ContainerRemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", m.Name, err)
+	}
+
+	return nil
+}
+
+// RemoveLeftovers force removes every container carrying ManagedLabel, running or not, and returns their names
+func RemoveLeftovers(ctx context.Context, conn Connection) ([]string, error) {
+	cli, err := conn.newClient(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cli.Close()
+
+	filters := make(moby.Filters)
+	filters.Add("label", ManagedLabel)
+
+	result, err := cli.ContainerList(ctx, moby.ContainerListOptions{All: true, Filters: filters})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	var removed []string
+	var errs []error
+	for _, summary := range result.Items {
+		name := summary.ID
+		if len(summary.Names) > 0 {
+			name = strings.TrimPrefix(summary.Names[0], "/")
+		}
+
+		if _, err := cli.ContainerRemove(ctx, summary.ID, moby.ContainerRemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove container %s: %w", name, err))
+			continue
+		}
+		removed = append(removed, name)
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// hostname is where ports published by the daemon can be reached from here
+func (c Connection) hostname() string {
+	endpoint, err := c.resolve()
+	if err != nil {
+		return "localhost"
+	}
+
+	u, err := url.Parse(endpoint.host)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "tcp" && u.Scheme != "ssh") {
+		return "localhost"
+	}
+	return u.Hostname()
+}
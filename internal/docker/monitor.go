@@ -13,106 +13,222 @@ import (
 
 type DockerStats struct {
 	Timestamp     time.Time `json:"timestamp"`
+	Container     string    `json:"container"`
 	MemoryUsageMB float64   `json:"memory_usage_mb"`
-	CPUPercent    float64   `json:"cpu_percent"`
-	DiskReadMB    float64   `json:"disk_read_mb"`
-	DiskWriteMB   float64   `json:"disk_write_mb"`
-	PIDs          uint64    `json:"pids"`
+	// MemoryLimitMB is the container's memory limit, or the host's memory when no limit is set
+	MemoryLimitMB float64 `json:"memory_limit_mb,omitempty"`
+	// MemoryPercent is the memory usage as a percentage of the limit
+	MemoryPercent float64         `json:"memory_percent,omitempty"`
+	CPUPercent    float64         `json:"cpu_percent"`
+	DiskReadMB    float64         `json:"disk_read_mb"`
+	DiskWriteMB   float64         `json:"disk_write_mb"`
+	PIDs          uint64          `json:"pids"`
+	CPUThrottling ThrottlingStats `json:"cpu_throttling"`
+	// OpenFDs and Threads are only recorded when monitoring host processes
+	OpenFDs uint64 `json:"open_fds,omitempty"`
+	Threads uint64 `json:"threads,omitempty"`
+	// Network is the total across every interface
+	Network           NetworkStats            `json:"network"`
+	NetworkInterfaces map[string]NetworkStats `json:"network_interfaces,omitempty"`
 }
 
-func RunDockerMonitor(ctx context.Context, container string) ([]DockerStats, error) {
-	var results []DockerStats
+// ThrottlingStats are cumulative CPU throttling counters since the container started.
+// They only grow when the container has a CPU limit.
+type ThrottlingStats struct {
+	Periods          uint64        `json:"periods"`
+	ThrottledPeriods uint64        `json:"throttled_periods"`
+	ThrottledTime    time.Duration `json:"throttled_time"`
+}
 
-	cli, err := client.New(context.Background())
+// NetworkStats are cumulative counters since the container started
+type NetworkStats struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to create docker client: %w", err)
+func (n NetworkStats) add(other NetworkStats) NetworkStats {
+	return NetworkStats{
+		RxBytes:   n.RxBytes + other.RxBytes,
+		TxBytes:   n.TxBytes + other.TxBytes,
+		RxPackets: n.RxPackets + other.RxPackets,
+		TxPackets: n.TxPackets + other.TxPackets,
+		RxErrors:  n.RxErrors + other.RxErrors,
+		TxErrors:  n.TxErrors + other.TxErrors,
+		RxDropped: n.RxDropped + other.RxDropped,
+		TxDropped: n.TxDropped + other.TxDropped,
 	}
+}
 
-	defer cli.Close()
+// DefaultSampleInterval matches the cadence of docker's own streamed stats
+const DefaultSampleInterval = time.Second
 
-	dockerCtx, dockerCtxCancel := context.WithCancel(context.Background())
-	defer dockerCtxCancel()
+// MinSampleInterval is the shortest supported sampling interval, as each sample is a request to the docker daemon
+const MinSampleInterval = 100 * time.Millisecond
 
-	options := moby.ContainerStatsOptions{
-		Stream: true,
+// Observer is called with every sample as soon as it is read
+type Observer func(DockerStats)
+
+func RunDockerMonitor(ctx context.Context, conn Connection, container string, interval time.Duration, observe Observer) ([]DockerStats, error) {
+	var results []DockerStats
+
+	cli, err := conn.newClient(context.Background())
+
+	if err != nil {
+		return nil, err
 	}
 
-	stats, err := cli.ContainerStats(dockerCtx, container, options)
+	defer cli.Close()
+
+	// The first sample only primes the counters, otherwise its CPU usage would be measured against zero and
+	// cover everything since the container started
+	previous, err := readStats(ctx, cli, container)
 
 	if err != nil {
 		return nil, fmt.Errorf("docker monitoring failed: %w", err)
 	}
 
-	defer stats.Body.Close()
-
-	decoder := json.NewDecoder(stats.Body)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	var prevCPU, prevSystem uint64
 	for {
-		if ctx.Err() != nil {
-			dockerCtxCancel()
+		select {
+		case <-ctx.Done():
 			return results, nil
+		case <-ticker.C:
 		}
 
-		response := mobyContainer.StatsResponse{}
-		if err := decoder.Decode(&response); err != nil {
-			dockerCtxCancel()
-			return results, nil
+		response, err := readStats(ctx, cli, container)
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, nil
+			}
+			return results, fmt.Errorf("docker monitoring failed: %w", err)
 		}
 
-		usage := response.MemoryStats.Usage
-		inactiveFile := response.MemoryStats.Stats["inactive_file"]
+		stat := toDockerStats(container, response, previous)
+		previous = response
 
-		var workingSet uint64
-		if usage > inactiveFile {
-			workingSet = usage - inactiveFile
-		} else {
-			workingSet = usage
+		results = append(results, stat)
+		if observe != nil {
+			observe(stat)
 		}
+	}
+}
 
-		memoryMB := float64(workingSet) / 1024 / 1024
+// readStats takes a single sample of the container's stats without waiting for docker to collect a previous one
+func readStats(ctx context.Context, cli client.SDKClient, container string) (mobyContainer.StatsResponse, error) {
+	var response mobyContainer.StatsResponse
 
-		cpuDelta := float64(response.CPUStats.CPUUsage.TotalUsage - prevCPU)
-		systemDelta := float64(response.CPUStats.SystemUsage - prevSystem)
-		prevCPU = response.CPUStats.CPUUsage.TotalUsage
-		prevSystem = response.CPUStats.SystemUsage
+	stats, err := cli.ContainerStats(ctx, container, moby.ContainerStatsOptions{})
 
-		var cpuPercent float64
-		if systemDelta > 0 && cpuDelta > 0 {
-			cpuPercent = (cpuDelta / systemDelta) * float64(response.CPUStats.OnlineCPUs) * 100.0
-		}
+	if err != nil {
+		return response, err
+	}
 
-		var diskReadBytes, diskWriteBytes uint64
-		for _, stat := range response.BlkioStats.IoServiceBytesRecursive {
-			switch stat.Op {
-			case "read":
-				diskReadBytes += stat.Value
-			case "write":
-				diskWriteBytes += stat.Value
-			}
+	defer stats.Body.Close()
+
+	err = json.NewDecoder(stats.Body).Decode(&response)
+	return response, err
+}
+
+func toDockerStats(container string, response, previous mobyContainer.StatsResponse) DockerStats {
+	usage := response.MemoryStats.Usage
+	inactiveFile := response.MemoryStats.Stats["inactive_file"]
+
+	var workingSet uint64
+	if usage > inactiveFile {
+		workingSet = usage - inactiveFile
+	} else {
+		workingSet = usage
+	}
+
+	memoryMB := float64(workingSet) / 1024 / 1024
+	memoryLimitMB := float64(response.MemoryStats.Limit) / 1024 / 1024
+
+	var memoryPercent float64
+	if response.MemoryStats.Limit > 0 {
+		memoryPercent = float64(workingSet) / float64(response.MemoryStats.Limit) * 100.0
+	}
+
+	// Counters go backwards if the container restarted between samples, which counts as no usage
+	cpuDelta := float64(counterDelta(previous.CPUStats.CPUUsage.TotalUsage, response.CPUStats.CPUUsage.TotalUsage))
+	systemDelta := float64(counterDelta(previous.CPUStats.SystemUsage, response.CPUStats.SystemUsage))
+
+	var cpuPercent float64
+	if systemDelta > 0 && cpuDelta > 0 {
+		cpuPercent = (cpuDelta / systemDelta) * float64(response.CPUStats.OnlineCPUs) * 100.0
+	}
+	var diskReadBytes, diskWriteBytes uint64
+	for _, stat := range response.BlkioStats.IoServiceBytesRecursive {
+		switch stat.Op {
+		case "read":
+			diskReadBytes += stat.Value
+		case "write":
+			diskWriteBytes += stat.Value
 		}
+	}
 
-		diskReadMB := float64(diskReadBytes) / 1024 / 1024
-		diskWriteMB := float64(diskWriteBytes) / 1024 / 1024
+	diskReadMB := float64(diskReadBytes) / 1024 / 1024
+	diskWriteMB := float64(diskWriteBytes) / 1024 / 1024
 
-		stat := DockerStats{
-			Timestamp:     response.Read,
-			MemoryUsageMB: memoryMB,
-			CPUPercent:    cpuPercent,
-			DiskReadMB:    diskReadMB,
-			DiskWriteMB:   diskWriteMB,
-			PIDs:          response.PidsStats.Current,
+	var network NetworkStats
+	var interfaces map[string]NetworkStats
+	if len(response.Networks) > 0 {
+		interfaces = make(map[string]NetworkStats, len(response.Networks))
+	}
+	for name, n := range response.Networks {
+		iface := NetworkStats{
+			RxBytes:   n.RxBytes,
+			TxBytes:   n.TxBytes,
+			RxPackets: n.RxPackets,
+			TxPackets: n.TxPackets,
+			RxErrors:  n.RxErrors,
+			TxErrors:  n.TxErrors,
+			RxDropped: n.RxDropped,
+			TxDropped: n.TxDropped,
 		}
-		results = append(results, stat)
+		interfaces[name] = iface
+		network = network.add(iface)
+	}
+
+	return DockerStats{
+		Timestamp:     response.Read,
+		Container:     container,
+		MemoryUsageMB: memoryMB,
+		MemoryLimitMB: memoryLimitMB,
+		MemoryPercent: memoryPercent,
+		CPUPercent:    cpuPercent,
+		DiskReadMB:    diskReadMB,
+		DiskWriteMB:   diskWriteMB,
+		PIDs:          response.PidsStats.Current,
+		CPUThrottling: ThrottlingStats{
+			Periods:          response.CPUStats.ThrottlingData.Periods,
+			ThrottledPeriods: response.CPUStats.ThrottlingData.ThrottledPeriods,
+			ThrottledTime:    time.Duration(response.CPUStats.ThrottlingData.ThrottledTime),
+		},
+		Network:           network,
+		NetworkInterfaces: interfaces,
+	}
+}
+
+func counterDelta(from, to uint64) uint64 {
+	if to < from {
+		return 0
 	}
+	return to - from
 }
 
-func CheckContainerRunning(containerID string) (bool, error) {
-	cli, err := client.New(context.Background())
+func CheckContainerRunning(conn Connection, containerID string) (bool, error) {
+	cli, err := conn.newClient(context.Background())
 
 	if err != nil {
-		return false, fmt.Errorf("failed to create docker client: %w", err)
+		return false, err
 	}
 
 	defer cli.Close()
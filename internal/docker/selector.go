@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	moby "github.com/moby/moby/client"
+)
+
+// composeProjectLabel is set by docker compose on every container of a project
+const composeProjectLabel = "com.docker.compose.project"
+
+// Selector picks the containers to monitor. Containers matching the compose project and labels are monitored
+// alongside any named containers.
+type Selector struct {
+	Names          []string
+	ComposeProject string
+	Labels         map[string]string
+}
+
+func (s Selector) IsEmpty() bool {
+	return len(s.Names) == 0 && s.ComposeProject == "" && len(s.Labels) == 0
+}
+
+// ResolveContainers returns the names of the containers matching the selector.
+// Named containers are returned as given, so one that isn't running is reported by the preflight checks instead of being skipped.
+func ResolveContainers(ctx context.Context, conn Connection, selector Selector) ([]string, error) {
+	var names []string
+	for _, name := range selector.Names {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	if selector.ComposeProject == "" && len(selector.Labels) == 0 {
+		return names, nil
+	}
+
+	cli, err := conn.newClient(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cli.Close()
+
+	filters := make(moby.Filters)
+	if selector.ComposeProject != "" {
+		filters.Add("label", composeProjectLabel+"="+selector.ComposeProject)
+	}
+	for _, key := range slices.Sorted(maps.Keys(selector.Labels)) {
+		filters.Add("label", key+"="+selector.Labels[key])
+	}
+
+	result, err := cli.ContainerList(ctx, moby.ContainerListOptions{Filters: filters})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	var matched []string
+	for _, summary := range result.Items {
+		if len(summary.Names) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(summary.Names[0], "/")
+		if !slices.Contains(names, name) {
+			matched = append(matched, name)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no running containers match %s", selector.describe())
+	}
+
+	slices.Sort(matched)
+	return append(names, matched...), nil
+}
+
+func (s Selector) describe() string {
+	var parts []string
+	if s.ComposeProject != "" {
+		parts = append(parts, fmt.Sprintf("compose project %q", s.ComposeProject))
+	}
+	for _, key := range slices.Sorted(maps.Keys(s.Labels)) {
+		parts = append(parts, fmt.Sprintf("label %s=%s", key, s.Labels[key]))
+	}
+	return strings.Join(parts, " and ")
+}
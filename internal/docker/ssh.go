@@ -0,0 +1,144 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sshDialer connects to a remote daemon the same way the docker CLI does, by running `docker system dial-stdio`
+// on the remote host over the local ssh client. Keys, agents and known hosts come from the usual ssh config.
+func sshDialer(host string) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	u, err := url.Parse(host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("no host in %s", host)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("ssh hosts cannot have a path, got %s", u.Path)
+	}
+
+	var args []string
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// Not tied to ctx, the connection outlives the dial and is kept alive by the http transport
+		cmd := exec.Command("ssh", args...)
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+
+		conn := &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}
+		cmd.Stderr = &conn.stderr
+
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to run ssh: %w", err)
+		}
+
+		return conn, nil
+	}, nil
+}
+
+// commandConn is a net.Conn over the stdin and stdout of a command
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr lockedBuffer
+
+	closeOnce sync.Once
+}
+
+// lockedBuffer collects ssh's stderr, which is written by the command while the connection is in use
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		// ssh exiting early, e.g. when authentication fails, only shows up as the end of its output
+		if stderr := strings.TrimSpace(c.stderr.String()); stderr != "" {
+			return n, fmt.Errorf("ssh exited: %s", stderr)
+		}
+		return n, err
+	}
+	if err != nil {
+		return n, c.withStderr(err)
+	}
+	return n, nil
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	n, err := c.stdin.Write(p)
+	if err != nil {
+		return n, c.withStderr(err)
+	}
+	return n, nil
+}
+
+// withStderr adds what ssh printed to an error, as that's where the reason the connection failed ends up
+func (c *commandConn) withStderr(err error) error {
+	if stderr := strings.TrimSpace(c.stderr.String()); stderr != "" {
+		return fmt.Errorf("%w: %s", err, stderr)
+	}
+	return err
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr{} }
+func (c *commandConn) RemoteAddr() net.Addr { return commandAddr{} }
+
+// Deadlines aren't supported by pipes, requests are bounded by their context instead
+func (c *commandConn) SetDeadline(time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(time.Time) error { return nil }
+
+type commandAddr struct{}
+
+func (commandAddr) Network() string { return "ssh" }
+func (commandAddr) String() string  { return "ssh" }
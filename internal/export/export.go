@@ -0,0 +1,335 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Formats are the supported export formats
+var Formats = []string{"csv", "parquet"}
+
+// Window limits the exported samples to those taken between From and To after the start of the test.
+// A zero To means until the end of the test.
+type Window struct {
+	From time.Duration
+	To   time.Duration
+}
+
+func (w Window) contains(testStart, timestamp time.Time) bool {
+	elapsed := timestamp.Sub(testStart)
+	if elapsed < w.From {
+		return false
+	}
+	if w.To > 0 && elapsed > w.To {
+		return false
+	}
+	return true
+}
+
+// HTTPRow is a single request in the exported http table
+type HTTPRow struct {
+	Timestamp  time.Time `parquet:"timestamp,timestamp(microsecond)"`
+	ElapsedMs  float64   `parquet:"elapsed_ms"`
+	LatencyMs  float64   `parquet:"latency_ms"`
+	StatusCode int32     `parquet:"status_code"`
+	ErrorType  string    `parquet:"error_type,optional"`
+	TraceID    string    `parquet:"trace_id,optional"`
+}
+
+// DockerRow is a single resource sample in the exported docker table
+type DockerRow struct {
+	Timestamp     time.Time `parquet:"timestamp,timestamp(microsecond)"`
+	ElapsedMs     float64   `parquet:"elapsed_ms"`
+	Container     string    `parquet:"container"`
+	MemoryUsageMB float64   `parquet:"memory_usage_mb"`
+	MemoryLimitMB float64   `parquet:"memory_limit_mb"`
+	MemoryPercent float64   `parquet:"memory_percent"`
+	CPUPercent    float64   `parquet:"cpu_percent"`
+	DiskReadMB    float64   `parquet:"disk_read_mb"`
+	DiskWriteMB   float64   `parquet:"disk_write_mb"`
+	PIDs          uint64    `parquet:"pids"`
+	// Throttling counters are cumulative since the container started
+	CPUPeriods          uint64  `parquet:"cpu_periods"`
+	CPUThrottledPeriods uint64  `parquet:"cpu_throttled_periods"`
+	CPUThrottledTimeMs  float64 `parquet:"cpu_throttled_time_ms"`
+	// Only recorded for host processes
+	OpenFDs uint64 `parquet:"open_fds"`
+	Threads uint64 `parquet:"threads"`
+	// Network counters are cumulative totals across every interface since the container started
+	NetworkRxBytes   uint64 `parquet:"network_rx_bytes"`
+	NetworkTxBytes   uint64 `parquet:"network_tx_bytes"`
+	NetworkRxPackets uint64 `parquet:"network_rx_packets"`
+	NetworkTxPackets uint64 `parquet:"network_tx_packets"`
+	NetworkRxErrors  uint64 `parquet:"network_rx_errors"`
+	NetworkTxErrors  uint64 `parquet:"network_tx_errors"`
+	NetworkRxDropped uint64 `parquet:"network_rx_dropped"`
+	NetworkTxDropped uint64 `parquet:"network_tx_dropped"`
+}
+
+// EventRow is a single container event in the exported events table
+type EventRow struct {
+	Timestamp time.Time `parquet:"timestamp,timestamp(microsecond)"`
+	ElapsedMs float64   `parquet:"elapsed_ms"`
+	Container string    `parquet:"container"`
+	Type      string    `parquet:"type"`
+	Detail    string    `parquet:"detail,optional"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func httpRows(stats []load.HTTPStats, testStart time.Time, window Window) []HTTPRow {
+	rows := make([]HTTPRow, 0, len(stats))
+	for _, s := range stats {
+		if !window.contains(testStart, s.Timestamp) {
+			continue
+		}
+		rows = append(rows, HTTPRow{
+			Timestamp:  s.Timestamp,
+			ElapsedMs:  milliseconds(s.Timestamp.Sub(testStart)),
+			LatencyMs:  milliseconds(s.Latency),
+			StatusCode: int32(s.StatusCode),
+			ErrorType:  s.ErrorType,
+			TraceID:    s.TraceID,
+		})
+	}
+	return rows
+}
+
+func dockerRows(stats []docker.DockerStats, testStart time.Time, window Window) []DockerRow {
+	rows := make([]DockerRow, 0, len(stats))
+	for _, s := range stats {
+		if !window.contains(testStart, s.Timestamp) {
+			continue
+		}
+		rows = append(rows, DockerRow{
+			Timestamp:           s.Timestamp,
+			ElapsedMs:           milliseconds(s.Timestamp.Sub(testStart)),
+			Container:           s.Container,
+			MemoryUsageMB:       s.MemoryUsageMB,
+			MemoryLimitMB:       s.MemoryLimitMB,
+			MemoryPercent:       s.MemoryPercent,
+			CPUPercent:          s.CPUPercent,
+			DiskReadMB:          s.DiskReadMB,
+			DiskWriteMB:         s.DiskWriteMB,
+			PIDs:                s.PIDs,
+			CPUPeriods:          s.CPUThrottling.Periods,
+			CPUThrottledPeriods: s.CPUThrottling.ThrottledPeriods,
+			CPUThrottledTimeMs:  milliseconds(s.CPUThrottling.ThrottledTime),
+			OpenFDs:             s.OpenFDs,
+			Threads:             s.Threads,
+			NetworkRxBytes:      s.Network.RxBytes,
+			NetworkTxBytes:      s.Network.TxBytes,
+			NetworkRxPackets:    s.Network.RxPackets,
+			NetworkTxPackets:    s.Network.TxPackets,
+			NetworkRxErrors:     s.Network.RxErrors,
+			NetworkTxErrors:     s.Network.TxErrors,
+			NetworkRxDropped:    s.Network.RxDropped,
+			NetworkTxDropped:    s.Network.TxDropped,
+		})
+	}
+	return rows
+}
+
+func eventRows(events []docker.Event, testStart time.Time, window Window) []EventRow {
+	rows := make([]EventRow, 0, len(events))
+	for _, e := range events {
+		if !window.contains(testStart, e.Timestamp) {
+			continue
+		}
+		rows = append(rows, EventRow{
+			Timestamp: e.Timestamp,
+			ElapsedMs: milliseconds(e.Timestamp.Sub(testStart)),
+			Container: e.Container,
+			Type:      e.Type,
+			Detail:    e.Detail,
+		})
+	}
+	return rows
+}
+
+// Write exports the samples of a result as separate http and docker tables named <prefix>_http.<format> and
+// <prefix>_docker.<format>. The docker table is only written when the result has docker samples, and container events
+// are written to <prefix>_events.<format> when there were any.
+// It returns the paths of the files written.
+func Write(output *collector.JSONOutput, format string, prefix string, window Window) ([]string, error) {
+	testStart := output.Metadata.Timestamp
+
+	var files []string
+
+	httpFile := fmt.Sprintf("%s_http.%s", prefix, format)
+	rows := httpRows(output.HTTPStats, testStart, window)
+
+	var err error
+	switch format {
+	case "csv":
+		err = writeCSV(httpFile, httpCSVHeader, rows, httpCSVRecord)
+	case "parquet":
+		err = writeParquet(httpFile, rows)
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+
+	if err != nil {
+		return files, fmt.Errorf("error writing %s: %w", httpFile, err)
+	}
+	files = append(files, httpFile)
+
+	if len(output.DockerStats) > 0 {
+		dockerFile := fmt.Sprintf("%s_docker.%s", prefix, format)
+		samples := dockerRows(output.DockerStats, testStart, window)
+
+		switch format {
+		case "csv":
+			err = writeCSV(dockerFile, dockerCSVHeader, samples, dockerCSVRecord)
+		case "parquet":
+			err = writeParquet(dockerFile, samples)
+		}
+
+		if err != nil {
+			return files, fmt.Errorf("error writing %s: %w", dockerFile, err)
+		}
+		files = append(files, dockerFile)
+	}
+
+	// Events are written on their own, a container can be OOM killed or restarted before it was ever sampled
+	if len(output.Events) == 0 {
+		return files, nil
+	}
+
+	eventsFile := fmt.Sprintf("%s_events.%s", prefix, format)
+	events := eventRows(output.Events, testStart, window)
+
+	switch format {
+	case "csv":
+		err = writeCSV(eventsFile, eventCSVHeader, events, eventCSVRecord)
+	case "parquet":
+		err = writeParquet(eventsFile, events)
+	}
+
+	if err != nil {
+		return files, fmt.Errorf("error writing %s: %w", eventsFile, err)
+	}
+	files = append(files, eventsFile)
+
+	return files, nil
+}
+
+var httpCSVHeader = []string{"timestamp", "elapsed_ms", "latency_ms", "status_code", "error_type", "trace_id"}
+
+func httpCSVRecord(row HTTPRow) []string {
+	return []string{
+		row.Timestamp.Format(time.RFC3339Nano),
+		formatFloat(row.ElapsedMs),
+		formatFloat(row.LatencyMs),
+		strconv.Itoa(int(row.StatusCode)),
+		row.ErrorType,
+		row.TraceID,
+	}
+}
+
+var dockerCSVHeader = []string{"timestamp", "elapsed_ms", "container", "memory_usage_mb", "memory_limit_mb", "memory_percent",
+	"cpu_percent", "disk_read_mb", "disk_write_mb", "pids", "cpu_periods", "cpu_throttled_periods", "cpu_throttled_time_ms",
+	"open_fds", "threads",
+	"network_rx_bytes", "network_tx_bytes", "network_rx_packets", "network_tx_packets",
+	"network_rx_errors", "network_tx_errors", "network_rx_dropped", "network_tx_dropped"}
+
+func dockerCSVRecord(row DockerRow) []string {
+	return []string{
+		row.Timestamp.Format(time.RFC3339Nano),
+		formatFloat(row.ElapsedMs),
+		row.Container,
+		formatFloat(row.MemoryUsageMB),
+		formatFloat(row.MemoryLimitMB),
+		formatFloat(row.MemoryPercent),
+		formatFloat(row.CPUPercent),
+		formatFloat(row.DiskReadMB),
+		formatFloat(row.DiskWriteMB),
+		strconv.FormatUint(row.PIDs, 10),
+		strconv.FormatUint(row.CPUPeriods, 10),
+		strconv.FormatUint(row.CPUThrottledPeriods, 10),
+		formatFloat(row.CPUThrottledTimeMs),
+		strconv.FormatUint(row.OpenFDs, 10),
+		strconv.FormatUint(row.Threads, 10),
+		strconv.FormatUint(row.NetworkRxBytes, 10),
+		strconv.FormatUint(row.NetworkTxBytes, 10),
+		strconv.FormatUint(row.NetworkRxPackets, 10),
+		strconv.FormatUint(row.NetworkTxPackets, 10),
+		strconv.FormatUint(row.NetworkRxErrors, 10),
+		strconv.FormatUint(row.NetworkTxErrors, 10),
+		strconv.FormatUint(row.NetworkRxDropped, 10),
+		strconv.FormatUint(row.NetworkTxDropped, 10),
+	}
+}
+
+var eventCSVHeader = []string{"timestamp", "elapsed_ms", "container", "type", "detail"}
+
+func eventCSVRecord(row EventRow) []string {
+	return []string{
+		row.Timestamp.Format(time.RFC3339Nano),
+		formatFloat(row.ElapsedMs),
+		row.Container,
+		row.Type,
+		row.Detail,
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func writeCSV[T any](filename string, header []string, rows []T, record func(T) []string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if err := w.Write(record(row)); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeParquet[T any](filename string, rows []T) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := parquet.NewGenericWriter[T](f, parquet.Compression(&parquet.Zstd))
+
+	if _, err := w.Write(rows); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -8,7 +8,7 @@ import (
 	"time"
 )
 
-func MakeConnection(id int, url string, channel chan []HTTPStats, ctx context.Context) {
+func MakeConnection(id int, url string, channel chan []HTTPStats, ctx, requestCtx context.Context, pacer *pacer, hooks Hooks) {
 	defaultTimeout := 30 * time.Second
 
 	client := &http.Client{
@@ -17,31 +17,66 @@ func MakeConnection(id int, url string, channel chan []HTTPStats, ctx context.Co
 
 	var results []HTTPStats
 
+	// The URL has already been checked during preflight, so this should never fail
+	baseReq, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		channel <- results
+		return
+	}
+
 	for {
-		if ctx.Err() != nil {
+		if ctx.Err() != nil || !pacer.wait(ctx) {
 			channel <- results
 			return
 		}
 
-		reqStart := time.Now()
-		resp, err := client.Get(url)
+		if hooks.OnRequest != nil {
+			hooks.OnRequest()
+		}
 
-		if err != nil {
-			errorType := classifyError(err)
-			results = append(results, HTTPStats{Timestamp: reqStart, ErrorType: errorType})
-			continue
+		// Aborted tests cancel the requests in flight, so a hung target doesn't hold up the results until the client
+		// times out
+		req := baseReq.Clone(requestCtx)
+
+		var finish func(*HTTPStats)
+		if hooks.Trace != nil {
+			req, finish = hooks.Trace(req)
 		}
 
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
+		reqStart := time.Now()
+		resp, err := client.Do(req)
+
+		var stat HTTPStats
+		if err != nil && requestCtx.Err() != nil {
+			// Cut off by the abort rather than failed by the target, so it isn't counted
+			if finish != nil {
+				finish(&HTTPStats{Timestamp: reqStart, ErrorType: "cancelled"})
+			}
+			channel <- results
+			return
+		} else if err != nil {
+			stat = HTTPStats{Timestamp: reqStart, ErrorType: classifyError(err)}
+		} else {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
 
-		latency := time.Since(reqStart)
+			latency := time.Since(reqStart)
+
+			stat = HTTPStats{
+				Timestamp:  reqStart,
+				Latency:    latency,
+				StatusCode: resp.StatusCode,
+			}
+		}
 
-		results = append(results, HTTPStats{
-			Timestamp:  reqStart,
-			Latency:    latency,
-			StatusCode: resp.StatusCode,
-		})
+		if finish != nil {
+			finish(&stat)
+		}
+
+		results = append(results, stat)
+		if hooks.OnResult != nil {
+			hooks.OnResult(stat)
+		}
 	}
 }
 
@@ -2,6 +2,7 @@ package load
 
 import (
 	"context"
+	"net/http"
 	"sync"
 	"time"
 )
@@ -11,17 +12,35 @@ type HTTPStats struct {
 	Latency    time.Duration `json:"latency"`
 	ErrorType  string        `json:"error_type,omitempty"`
 	StatusCode int           `json:"status_code"`
+	TraceID    string        `json:"trace_id,omitempty"`
 }
 
-func RunHTTPTest(ctx context.Context, url string, connections int) []HTTPStats {
+// Hooks are notified as requests are made.
+// They are called concurrently from every connection so must be safe for concurrent use.
+type Hooks struct {
+	// OnRequest is called just before each request is sent
+	OnRequest func()
+	// OnResult is called with every result as soon as its request completes
+	OnResult func(HTTPStats)
+	// Trace is called with each request before it is sent, returning the request to send and a function
+	// called with its result once it completes. It is used to wrap requests in client spans.
+	Trace func(*http.Request) (*http.Request, func(*HTTPStats))
+}
+
+// RunHTTPTest sends requests from every connection until ctx is done. A rate above zero caps the requests sent per
+// second across all connections, the connections only limit how many can be in flight at once. Requests are sent
+// with requestCtx, so the ones in flight once ctx is done complete and are recorded, unless requestCtx is cancelled
+// too, e.g. because the test was aborted.
+func RunHTTPTest(ctx, requestCtx context.Context, url string, connections, rate int, hooks Hooks) []HTTPStats {
 	var results []HTTPStats
+	pacer := newPacer(rate)
 
 	ch := make(chan []HTTPStats)
 	var wg sync.WaitGroup
 
 	for i := range connections {
 		wg.Go(func() {
-			MakeConnection(i, url, ch, ctx)
+			MakeConnection(i, url, ch, ctx, requestCtx, pacer, hooks)
 		})
 	}
 
@@ -0,0 +1,53 @@
+package load
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pacer spaces requests evenly across every connection to hold a fixed arrival rate
+type pacer struct {
+	mu       sync.Mutex
+	next     time.Time
+	interval time.Duration
+}
+
+func newPacer(rate int) *pacer {
+	if rate <= 0 {
+		return nil
+	}
+	return &pacer{next: time.Now(), interval: time.Second / time.Duration(rate)}
+}
+
+// wait blocks until the next request is due, returning false if ctx is done first. A nil pacer never waits.
+func (p *pacer) wait(ctx context.Context) bool {
+	if p == nil {
+		return true
+	}
+
+	p.mu.Lock()
+	// Slots missed while every connection was busy aren't made up for, so a slow target isn't hit with a burst
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	due := p.next
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	delay := time.Until(due)
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,232 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "loadship"
+
+// Exporter serves live test metrics on a Prometheus /metrics endpoint.
+// It stays up across every run of a suite so dashboards can overlay the whole suite.
+type Exporter struct {
+	registry *prometheus.Registry
+	server   *http.Server
+
+	requests          *prometheus.CounterVec
+	latency           prometheus.Histogram
+	inFlight          prometheus.Gauge
+	running           prometheus.Gauge
+	targetConnections prometheus.Gauge
+	stage             prometheus.Gauge
+
+	memoryBytes    *prometheus.GaugeVec
+	memoryLimit    *prometheus.GaugeVec
+	cpuPercent     *prometheus.GaugeVec
+	diskReadBytes  *prometheus.GaugeVec
+	diskWriteBytes *prometheus.GaugeVec
+	pids           *prometheus.GaugeVec
+	throttled      *prometheus.GaugeVec
+	networkRx      *prometheus.GaugeVec
+	networkTx      *prometheus.GaugeVec
+	events         *prometheus.CounterVec
+}
+
+func New() *Exporter {
+	containerLabels := []string{"container"}
+
+	e := &Exporter{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Requests made by status code and error type. Requests that failed before receiving a response have an empty status.",
+		}, []string{"status", "error_type"}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of requests that received a response.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "in_flight_requests",
+			Help:      "Requests currently waiting for a response.",
+		}),
+		running: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "test_running",
+			Help:      "1 while a test is running, 0 between runs.",
+		}),
+		targetConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "target_connections",
+			Help:      "Number of concurrent connections the current run is configured with.",
+		}),
+		stage: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "stage",
+			Help:      "Number of the current run within the suite, starting at 1.",
+		}),
+		memoryBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "container_memory_bytes",
+			Help:      "Working set memory of the monitored container.",
+		}, containerLabels),
+		memoryLimit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "container_memory_limit_bytes",
+			Help:      "Memory limit of the monitored container, or the host's memory when no limit is set.",
+		}, containerLabels),
+		cpuPercent: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "container_cpu_percent",
+			Help:      "CPU usage of the monitored container, where 100 is one full core.",
+		}, containerLabels),
+		diskReadBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "container_disk_read_bytes",
+			Help:      "Bytes read from disk by the monitored container since it started.",
+		}, containerLabels),
+		diskWriteBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "container_disk_write_bytes",
+			Help:      "Bytes written to disk by the monitored container since it started.",
+		}, containerLabels),
+		pids: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "container_pids",
+			Help:      "Number of processes in the monitored container.",
+		}, containerLabels),
+		throttled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "container_cpu_throttled_periods",
+			Help:      "CPU periods the monitored container was throttled in since it started.",
+		}, containerLabels),
+		networkRx: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "container_network_receive_bytes",
+			Help:      "Bytes received across every network interface of the monitored container since it started.",
+		}, containerLabels),
+		networkTx: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "container_network_transmit_bytes",
+			Help:      "Bytes sent across every network interface of the monitored container since it started.",
+		}, containerLabels),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "container_events_total",
+			Help:      "OOM kills, exits, restarts and health changes of the monitored containers by type.",
+		}, []string{"container", "type"}),
+	}
+
+	e.registry.MustRegister(
+		e.requests,
+		e.latency,
+		e.inFlight,
+		e.running,
+		e.targetConnections,
+		e.stage,
+		e.memoryBytes,
+		e.memoryLimit,
+		e.cpuPercent,
+		e.diskReadBytes,
+		e.diskWriteBytes,
+		e.pids,
+		e.throttled,
+		e.networkRx,
+		e.networkTx,
+		e.events,
+	)
+
+	return e
+}
+
+// Serve starts serving /metrics on addr in the background.
+// Listening happens before returning so an address already in use is reported straight away.
+func (e *Exporter) Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{}))
+
+	e.server = &http.Server{Handler: mux}
+
+	go func() {
+		err := e.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("Metrics endpoint failed:", err)
+		}
+	}()
+
+	fmt.Printf("Serving metrics on http://%s/metrics\n", listener.Addr())
+	return nil
+}
+
+// Shutdown stops serving metrics
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	if e.server == nil {
+		return nil
+	}
+	return e.server.Shutdown(ctx)
+}
+
+// StartRun records the config of a run that is about to start. stage is the number of the run within a suite.
+func (e *Exporter) StartRun(config collector.TestConfig, stage int) {
+	e.targetConnections.Set(float64(config.Connections))
+	e.stage.Set(float64(stage))
+	e.running.Set(1)
+}
+
+// EndRun records that the current run has finished
+func (e *Exporter) EndRun() {
+	e.running.Set(0)
+	e.inFlight.Set(0)
+}
+
+func (e *Exporter) ObserveRequest() {
+	e.inFlight.Inc()
+}
+
+func (e *Exporter) ObserveHTTP(stat load.HTTPStats) {
+	e.inFlight.Dec()
+
+	if stat.ErrorType != "" {
+		e.requests.WithLabelValues("", stat.ErrorType).Inc()
+		return
+	}
+
+	e.requests.WithLabelValues(strconv.Itoa(stat.StatusCode), "").Inc()
+	e.latency.Observe(stat.Latency.Seconds())
+}
+
+func (e *Exporter) ObserveDocker(stat docker.DockerStats) {
+	const mb = 1024 * 1024
+
+	e.memoryBytes.WithLabelValues(stat.Container).Set(stat.MemoryUsageMB * mb)
+	e.memoryLimit.WithLabelValues(stat.Container).Set(stat.MemoryLimitMB * mb)
+	e.cpuPercent.WithLabelValues(stat.Container).Set(stat.CPUPercent)
+	e.diskReadBytes.WithLabelValues(stat.Container).Set(stat.DiskReadMB * mb)
+	e.diskWriteBytes.WithLabelValues(stat.Container).Set(stat.DiskWriteMB * mb)
+	e.pids.WithLabelValues(stat.Container).Set(float64(stat.PIDs))
+	e.throttled.WithLabelValues(stat.Container).Set(float64(stat.CPUThrottling.ThrottledPeriods))
+	e.networkRx.WithLabelValues(stat.Container).Set(float64(stat.Network.RxBytes))
+	e.networkTx.WithLabelValues(stat.Container).Set(float64(stat.Network.TxBytes))
+}
+
+func (e *Exporter) ObserveEvent(event docker.Event) {
+	e.events.WithLabelValues(event.Container, event.Type).Inc()
+}
@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/fireproofpenguin/loadship/internal/abort"
+	"github.com/fireproofpenguin/loadship/internal/baseline"
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/comparison"
+)
+
+// Status of a finished run or suite
+const (
+	StatusPassed    = "passed"
+	StatusRegressed = "regressed"
+	StatusFailed    = "failed"
+)
+
+// Event is the summary sent to webhooks when a run or suite finishes
+type Event struct {
+	// Event is either run or suite
+	Event string `json:"event"`
+	Suite string `json:"suite,omitempty"`
+	// Status is failed if any run failed or was aborted, regressed if any run regressed against its baseline, otherwise passed
+	Status string      `json:"status"`
+	Runs   []RunResult `json:"runs"`
+}
+
+// RunResult is the outcome of a single run
+type RunResult struct {
+	Config  collector.TestConfig `json:"config"`
+	Metrics *collector.Metrics   `json:"metrics,omitempty"`
+	Error   string               `json:"error,omitempty"`
+	// Aborted is why the run was stopped early, its metrics only cover the time until then
+	Aborted    *abort.Reason `json:"aborted,omitempty"`
+	ResultFile string        `json:"result_file,omitempty"`
+	ReportFile string        `json:"report_file,omitempty"`
+	Comparison *Comparison   `json:"comparison,omitempty"`
+}
+
+// Comparison is the result of comparing a run against its baseline
+type Comparison struct {
+	Baseline string   `json:"baseline"`
+	Changes  []Change `json:"changes"`
+	// Regressions names the metrics that got more than 5% worse
+	Regressions []string `json:"regressions"`
+}
+
+type Change struct {
+	Name     string  `json:"name"`
+	Baseline float64 `json:"baseline"`
+	Test     float64 `json:"test"`
+	Percent  float64 `json:"percent"`
+	Better   bool    `json:"better"`
+}
+
+// Compare compares a run against the baseline result read from baselineFile
+func Compare(baselineFile string, test *collector.JSONOutput) (*Comparison, error) {
+	baseline, err := collector.ReadFromFile(baselineFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading baseline %s: %w", baselineFile, err)
+	}
+
+	report := comparison.Compare([]*collector.JSONOutput{baseline, test})[0]
+
+	c := &Comparison{
+		Baseline:    baselineFile,
+		Regressions: []string{},
+	}
+
+	for _, change := range report.Changes() {
+		c.Changes = append(c.Changes, Change{
+			Name:     change.Name,
+			Baseline: change.Baseline,
+			Test:     change.Test,
+			Percent:  change.Percent,
+			Better:   change.Better,
+		})
+		if change.IsRegression() {
+			c.Regressions = append(c.Regressions, change.Name)
+		}
+	}
+
+	return c, nil
+}
+
+// CompareToBaseline resolves the baseline for a finished run and compares against it.
+// Failing to find a baseline is reported but isn't fatal, e.g. the first nightly run won't have one.
+func CompareToBaseline(spec string, dir string, output *collector.JSONOutput, exclude ...string) *Comparison {
+	selector, err := baseline.ParseSelector(spec)
+	if err != nil {
+		fmt.Println("Invalid baseline:", err)
+		return nil
+	}
+
+	baselineFile, err := baseline.Resolve(dir, selector, output.Metadata, exclude...)
+	if err != nil {
+		fmt.Printf("Unable to resolve baseline %q: %v\n", spec, err)
+		return nil
+	}
+
+	c, err := Compare(baselineFile, output)
+	if err != nil {
+		fmt.Println("Error comparing against baseline:", err)
+		return nil
+	}
+
+	if len(c.Regressions) > 0 {
+		fmt.Printf("✗ Regressed compared to %s: %s\n", baselineFile, strings.Join(c.Regressions, ", "))
+	} else {
+		fmt.Printf("✓ No regressions compared to %s\n", baselineFile)
+	}
+
+	return c
+}
+
+func NewRunEvent(run RunResult) Event {
+	return newEvent("run", "", []RunResult{run})
+}
+
+func NewSuiteEvent(name string, runs []RunResult) Event {
+	return newEvent("suite", name, runs)
+}
+
+func newEvent(kind string, suite string, runs []RunResult) Event {
+	status := StatusPassed
+
+	for _, run := range runs {
+		if run.Error != "" || run.Aborted != nil {
+			status = StatusFailed
+			break
+		}
+		if run.Comparison != nil && len(run.Comparison.Regressions) > 0 {
+			status = StatusRegressed
+		}
+	}
+
+	return Event{
+		Event:  kind,
+		Suite:  suite,
+		Status: status,
+		Runs:   runs,
+	}
+}
+
+// Formats are the supported webhook payload formats
+var Formats = []string{"generic", "slack"}
+
+// Webhook is a URL notified when a run or suite finishes
+type Webhook struct {
+	URL string
+	// Format is generic, which posts the Event as JSON, or slack, which posts a readable message
+	Format string
+}
+
+// ParseWebhook parses a webhook spec, which is either a URL or <format>=<url>:
+//
+//	https://ci.example.com/hooks/loadship                  the Event as JSON
+//	slack=https://hooks.slack.com/services/T000/B000/XXXX  a Slack message
+func ParseWebhook(spec string) (Webhook, error) {
+	webhook := Webhook{URL: spec, Format: "generic"}
+
+	for _, format := range Formats {
+		if target, ok := strings.CutPrefix(spec, format+"="); ok {
+			webhook = Webhook{URL: target, Format: format}
+			break
+		}
+	}
+
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("invalid webhook %q: must be an http(s) URL, optionally prefixed with %s", spec, strings.Join(prefixes(), " or "))
+	}
+
+	return webhook, nil
+}
+
+// ParseWebhooks parses every spec
+func ParseWebhooks(specs []string) ([]Webhook, error) {
+	var webhooks []Webhook
+
+	for _, spec := range specs {
+		webhook, err := ParseWebhook(spec)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, nil
+}
+
+func prefixes() []string {
+	var p []string
+	for _, format := range Formats {
+		p = append(p, format+"=")
+	}
+	return p
+}
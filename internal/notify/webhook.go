@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	attempts     = 3
+	retryBackoff = 2 * time.Second
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Send posts the event to every webhook, retrying failed deliveries. Failures are printed rather than returned
+// so that a broken webhook never fails the test itself.
+func Send(webhooks []Webhook, event Event) {
+	for _, webhook := range webhooks {
+		payload, err := webhook.payload(event)
+		if err != nil {
+			fmt.Println("Error creating webhook payload:", err)
+			continue
+		}
+
+		// Only show the host, Slack webhook paths are secrets
+		host := webhook.URL
+		if u, err := url.Parse(webhook.URL); err == nil {
+			host = u.Host
+		}
+
+		if err := post(webhook.URL, payload); err != nil {
+			fmt.Printf("Error notifying webhook %s: %v\n", host, err)
+			continue
+		}
+
+		fmt.Printf("✓ Notified webhook %s\n", host)
+	}
+}
+
+func (w Webhook) payload(event Event) ([]byte, error) {
+	if w.Format == "slack" {
+		return json.Marshal(map[string]string{"text": slackMessage(event)})
+	}
+	return json.Marshal(event)
+}
+
+func post(url string, payload []byte) error {
+	var err error
+	backoff := retryBackoff
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var retry bool
+		retry, err = postOnce(url, payload)
+		if err == nil || !retry {
+			return err
+		}
+
+		if attempt < attempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+}
+
+// postOnce makes a single delivery attempt, reporting whether a failure is worth retrying
+func postOnce(url string, payload []byte) (bool, error) {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+
+	// Client errors other than rate limiting won't succeed on a retry
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, err
+}
+
+func slackMessage(event Event) string {
+	var b strings.Builder
+
+	icon := ":white_check_mark:"
+	switch event.Status {
+	case StatusRegressed:
+		icon = ":warning:"
+	case StatusFailed:
+		icon = ":x:"
+	}
+
+	if event.Event == "suite" {
+		fmt.Fprintf(&b, "%s loadship suite *%s* %s (%d runs)\n", icon, event.Suite, event.Status, len(event.Runs))
+	} else {
+		fmt.Fprintf(&b, "%s loadship run %s\n", icon, event.Status)
+	}
+
+	for _, run := range event.Runs {
+		fmt.Fprintf(&b, "\n*%s* — %d connections for %s\n", run.Config.URL, run.Config.Connections, run.Config.Duration)
+
+		if run.Error != "" {
+			fmt.Fprintf(&b, "Failed: %s\n", run.Error)
+			continue
+		}
+
+		if run.Aborted != nil {
+			fmt.Fprintf(&b, "Aborted after %s: %s\n", run.Aborted.Elapsed.Round(time.Second), run.Aborted.Message)
+		}
+
+		if run.Metrics != nil {
+			http := run.Metrics.HTTPMetrics
+			fmt.Fprintf(&b, "Requests: %d (%d failed)    RPS: %.2f    Latency p50/p99: %d / %d ms\n",
+				http.Requests.Total, http.Requests.Failed, http.Requests.Rps, http.Latency.P50, http.Latency.P99)
+		}
+
+		if run.Comparison != nil {
+			if len(run.Comparison.Regressions) > 0 {
+				var parts []string
+				for _, change := range run.Comparison.Changes {
+					if slices.Contains(run.Comparison.Regressions, change.Name) {
+						parts = append(parts, fmt.Sprintf("%s %+.2f%%", change.Name, change.Percent))
+					}
+				}
+				fmt.Fprintf(&b, "Regressed vs %s: %s\n", run.Comparison.Baseline, strings.Join(parts, ", "))
+			} else {
+				fmt.Fprintf(&b, "No regressions vs %s\n", run.Comparison.Baseline)
+			}
+		}
+
+		if run.ReportFile != "" {
+			fmt.Fprintf(&b, "Report: %s\n", run.ReportFile)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+)
+
+// StartManaged starts the target from its image and waits until it is ready, or ctx is done. It returns the target
+// URL, which defaults to the container's published port when url is empty and is resolved against it when url is a
+// path.
+func StartManaged(ctx context.Context, conn docker.Connection, spec docker.ContainerSpec, url string) (*docker.ManagedContainer, string, error) {
+	fmt.Printf("Starting %s...\n", spec.Image)
+	start := time.Now()
+
+	managed, err := docker.StartContainer(ctx, conn, spec)
+
+	if err != nil {
+		return nil, url, err
+	}
+
+	url = resolveManagedURL(managed.URL, url)
+
+	if err := managed.WaitReady(ctx, url, spec.ReadyTimeout); err != nil {
+		RemoveManaged(managed)
+		return nil, url, err
+	}
+
+	fmt.Printf("✓ %s ready after %s\n", managed.Name, time.Since(start).Round(100*time.Millisecond))
+	return managed, url, nil
+}
+
+// RemoveManaged stops and removes a container started by StartManaged, if there is one
+func RemoveManaged(managed *docker.ManagedContainer) {
+	if managed == nil {
+		return
+	}
+
+	if err := managed.Remove(); err != nil {
+		fmt.Println("Error removing container:", err)
+	}
+}
+
+// resolveManagedURL resolves target against the URL of a managed container. An empty target is the container's URL
+// and a path is on it, anything else is left as is.
+func resolveManagedURL(container, target string) string {
+	if target == "" {
+		return container
+	}
+	if !strings.HasPrefix(target, "/") {
+		return target
+	}
+
+	base, err := url.Parse(container)
+	if err != nil {
+		return container
+	}
+	path, err := url.Parse(target)
+	if err != nil {
+		return container
+	}
+	return base.ResolveReference(path).String()
+}
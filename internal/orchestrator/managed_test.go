@@ -0,0 +1,23 @@
+package orchestrator
+
+import "testing"
+
+func TestResolveManagedURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{name: "no URL", target: "", want: "http://localhost:32768/"},
+		{name: "path", target: "/api/health?full=1", want: "http://localhost:32768/api/health?full=1"},
+		{name: "URL", target: "http://example.com/health", want: "http://example.com/health"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := resolveManagedURL("http://localhost:32768/", test.target); got != test.want {
+				t.Errorf("resolveManagedURL(%q) = %q, want %q", test.target, got, test.want)
+			}
+		})
+	}
+}
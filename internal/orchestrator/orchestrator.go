@@ -2,28 +2,256 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/fireproofpenguin/loadship/internal/collector"
 	"github.com/fireproofpenguin/loadship/internal/docker"
 	"github.com/fireproofpenguin/loadship/internal/load"
+	"github.com/fireproofpenguin/loadship/internal/process"
+	"github.com/fireproofpenguin/loadship/internal/tui"
 	"github.com/schollz/progressbar/v3"
 )
 
-func Orchestrate(config collector.TestConfig) ([]load.HTTPStats, []docker.DockerStats, error) {
-	err := preflightChecks(config)
+// Observer receives samples while the test is running, e.g. to stream them to a file
+type Observer interface {
+	ObserveHTTP(load.HTTPStats)
+	ObserveDocker(docker.DockerStats)
+}
+
+// RequestObserver is implemented by observers that also need to know when each request is sent, e.g. to track in-flight requests
+type RequestObserver interface {
+	ObserveRequest()
+}
+
+// RequestTracer is implemented by observers that wrap each request in a trace span.
+// Only the first tracer in the observers is used.
+type RequestTracer interface {
+	TraceRequest(*http.Request) (*http.Request, func(*load.HTTPStats))
+}
+
+// EventObserver is implemented by observers that also want container lifecycle events, e.g. OOM kills and restarts
+type EventObserver interface {
+	ObserveEvent(docker.Event)
+}
+
+// LogObserver is implemented by observers that want the monitored containers' logs. Containers' logs are only
+// followed when at least one observer implements it. ObserveLog is called concurrently.
+type LogObserver interface {
+	ObserveLog(docker.LogLine)
+}
+
+// BackgroundObserver is implemented by observers that do periodic work for as long as the test is running,
+// e.g. flushing aggregates. Run must return once ctx is done.
+type BackgroundObserver interface {
+	Run(ctx context.Context)
+}
+
+// Aborter is implemented by observers that stop the test early, e.g. once the target has fallen over. The test and
+// the requests in flight are cancelled as soon as the channel returned by Aborted is closed, and the samples taken
+// until then are returned.
+type Aborter interface {
+	Aborted() <-chan struct{}
+}
+
+// ErrInterrupted is returned once a test is interrupted, e.g. with Ctrl+C, rather than running for its duration
+var ErrInterrupted = errors.New("interrupted")
+
+type Options struct {
+	// Observers receive every sample while the test is running
+	Observers []Observer
+	// TUI replaces the progress bar with a live dashboard of the running test
+	TUI bool
+	// Docker is the daemon the containers are monitored through
+	Docker docker.Connection
+}
+
+// Orchestrate runs the test until its duration is up, an observer aborts it, or parent is cancelled, e.g. on Ctrl+C,
+// which fails it with ErrInterrupted
+func Orchestrate(parent context.Context, config collector.TestConfig, options Options) ([]load.HTTPStats, []docker.DockerStats, []docker.Event, error) {
+	err := preflightChecks(config, options.Docker)
 
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), config.Duration)
+	ctx, cancel := context.WithTimeout(parent, config.Duration)
 	defer cancel()
 
-	bar := progressbar.NewOptions(int(config.Duration.Seconds()),
+	// Requests still in flight at the end of the test complete and are recorded, only an abort or interrupt cancels them
+	requestCtx, cancelRequests := context.WithCancel(parent)
+	defer cancelRequests()
+
+	observers := options.Observers
+
+	// The dashboard draws itself as a background observer, otherwise show the progress bar
+	var background sync.WaitGroup
+	if options.TUI {
+		observers = append(observers, tui.New(config))
+	} else {
+		background.Go(func() {
+			showProgress(ctx, config.Duration)
+		})
+	}
+
+	var wg sync.WaitGroup
+
+	var httpResults []load.HTTPStats
+	var dockerResults []docker.DockerStats
+	var events []docker.Event
+
+	var hooks load.Hooks
+	var observeDocker docker.Observer
+	var observeEvent docker.EventObserver
+	var observeLog docker.LogObserver
+
+	if len(observers) > 0 {
+		hooks.OnResult = func(stat load.HTTPStats) {
+			for _, o := range observers {
+				o.ObserveHTTP(stat)
+			}
+		}
+		observeDocker = func(stat docker.DockerStats) {
+			for _, o := range observers {
+				o.ObserveDocker(stat)
+			}
+		}
+	}
+
+	var requestObservers []RequestObserver
+	var eventObservers []EventObserver
+	var logObservers []LogObserver
+	for _, o := range observers {
+		if bo, ok := o.(BackgroundObserver); ok {
+			background.Go(func() {
+				bo.Run(ctx)
+			})
+		}
+		if ro, ok := o.(RequestObserver); ok {
+			requestObservers = append(requestObservers, ro)
+		}
+		if eo, ok := o.(EventObserver); ok {
+			eventObservers = append(eventObservers, eo)
+		}
+		if lo, ok := o.(LogObserver); ok {
+			logObservers = append(logObservers, lo)
+		}
+		if tracer, ok := o.(RequestTracer); ok && hooks.Trace == nil {
+			hooks.Trace = tracer.TraceRequest
+		}
+		if ao, ok := o.(Aborter); ok {
+			background.Go(func() {
+				select {
+				case <-ao.Aborted():
+					cancelRequests()
+					cancel()
+				case <-ctx.Done():
+				}
+			})
+		}
+	}
+
+	if len(requestObservers) > 0 {
+		hooks.OnRequest = func() {
+			for _, o := range requestObservers {
+				o.ObserveRequest()
+			}
+		}
+	}
+
+	if len(eventObservers) > 0 {
+		observeEvent = func(event docker.Event) {
+			for _, o := range eventObservers {
+				o.ObserveEvent(event)
+			}
+		}
+	}
+
+	if len(logObservers) > 0 {
+		observeLog = func(line docker.LogLine) {
+			for _, o := range logObservers {
+				o.ObserveLog(line)
+			}
+		}
+	}
+
+	wg.Go(func() {
+		httpResults = load.RunHTTPTest(ctx, requestCtx, config.URL, config.Connections, config.Rate, hooks)
+	})
+
+	interval := config.SampleInterval
+	if interval <= 0 {
+		interval = docker.DefaultSampleInterval
+	}
+
+	var dockerMu sync.Mutex
+	for _, container := range config.Containers {
+		wg.Go(func() {
+			results, dockerErr := docker.RunDockerMonitor(ctx, options.Docker, container, interval, observeDocker)
+			if dockerErr != nil {
+				fmt.Printf("Docker monitoring of %s failed: %v\n", container, dockerErr)
+			}
+
+			dockerMu.Lock()
+			dockerResults = append(dockerResults, results...)
+			dockerMu.Unlock()
+		})
+	}
+
+	if observeLog != nil {
+		for _, container := range config.Containers {
+			wg.Go(func() {
+				if logsErr := docker.StreamLogs(ctx, options.Docker, container, observeLog); logsErr != nil {
+					fmt.Printf("Capturing logs of %s failed: %v\n", container, logsErr)
+				}
+			})
+		}
+	}
+
+	for _, target := range config.Processes {
+		wg.Go(func() {
+			results, processErr := process.RunMonitor(ctx, target, interval, observeDocker)
+			if processErr != nil {
+				fmt.Printf("Monitoring of %s failed: %v\n", target, processErr)
+			}
+
+			dockerMu.Lock()
+			dockerResults = append(dockerResults, results...)
+			dockerMu.Unlock()
+		})
+	}
+
+	if len(config.Containers) > 0 {
+		wg.Go(func() {
+			var eventsErr error
+			events, eventsErr = docker.WatchEvents(ctx, options.Docker, config.Containers, observeEvent)
+			if eventsErr != nil {
+				fmt.Printf("Watching container events failed: %v\n", eventsErr)
+			}
+		})
+	}
+
+	wg.Wait()
+	background.Wait()
+
+	if parent.Err() != nil {
+		return nil, nil, nil, ErrInterrupted
+	}
+
+	// Interleave the samples of each container and process in the order they were taken
+	slices.SortStableFunc(dockerResults, func(a, b docker.DockerStats) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	return httpResults, dockerResults, events, nil
+}
+
+func showProgress(ctx context.Context, duration time.Duration) {
+	bar := progressbar.NewOptions(int(duration.Seconds()),
 		progressbar.OptionSetDescription("Running test..."),
 		progressbar.OptionSetWidth(40),
 		progressbar.OptionShowElapsedTimeOnFinish(),
@@ -36,48 +264,50 @@ func Orchestrate(config collector.TestConfig) ([]load.HTTPStats, []docker.Docker
 
 	var (
 		elapsed int
-		total   int = int(config.Duration.Seconds())
+		total   int = int(duration.Seconds())
 	)
 
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				bar.Add(1)
-				elapsed += 1
-				bar.Describe(fmt.Sprintf("Running test (%d/%ds)", elapsed, total))
-			case <-ctx.Done():
-				bar.Finish()
-				return
-			}
+	for {
+		select {
+		case <-ticker.C:
+			bar.Add(1)
+			elapsed += 1
+			bar.Describe(fmt.Sprintf("Running test (%d/%ds)", elapsed, total))
+		case <-ctx.Done():
+			bar.Finish()
+			return
 		}
-	}()
+	}
+}
 
-	var wg sync.WaitGroup
+// Cooldown waits between runs so the target can settle, showing the time left. It returns early once ctx is done.
+func Cooldown(ctx context.Context, duration time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
 
-	var httpResults []load.HTTPStats
-	var dockerResults []docker.DockerStats
+	bar := progressbar.NewOptions(int(duration.Seconds()),
+		progressbar.OptionSetDescription("Cooldown..."),
+		progressbar.OptionSetWidth(40),
+		progressbar.OptionShowElapsedTimeOnFinish(),
+		progressbar.OptionSetPredictTime(false),
+		progressbar.OptionClearOnFinish(),
+	)
 
-	wg.Go(func() {
-		httpResults = load.RunHTTPTest(ctx, config.URL, config.Connections)
-	})
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
 
-	if config.ContainerName != "" {
-		wg.Go(func() {
-			var dockerErr error
-			dockerResults, dockerErr = docker.RunDockerMonitor(ctx, config.ContainerName)
-			if dockerErr != nil {
-				fmt.Println("Docker monitoring failed:", dockerErr)
-			}
-		})
+	for {
+		select {
+		case <-ticker.C:
+			bar.Add(1)
+		case <-ctx.Done():
+			bar.Finish()
+			return
+		}
 	}
-
-	wg.Wait()
-
-	return httpResults, dockerResults, nil
 }
 
-func preflightChecks(config collector.TestConfig) error {
+func preflightChecks(config collector.TestConfig, conn docker.Connection) error {
 	// Do a preflight HTTP check against the provided URL. Only care about transport issues - valid HTTP responses are fine
 	// This prevents us gunking up the output with a bunch of failed requests that resolve almost instantly
 	preflightClient := &http.Client{Timeout: 10 * time.Second}
@@ -87,14 +317,20 @@ func preflightChecks(config collector.TestConfig) error {
 	}
 	resp.Body.Close()
 
-	if config.ContainerName != "" {
-		isRunning, err := docker.CheckContainerRunning(config.ContainerName)
+	for _, container := range config.Containers {
+		isRunning, err := docker.CheckContainerRunning(conn, container)
 
 		if err != nil {
 			return fmt.Errorf("Preflight container check failed: %v", err)
 		}
 		if !isRunning {
-			return fmt.Errorf("Preflight container check failed: Container %s is not running", config.ContainerName)
+			return fmt.Errorf("Preflight container check failed: Container %s is not running on %s", container, conn)
+		}
+	}
+
+	for _, target := range config.Processes {
+		if err := process.Check(target); err != nil {
+			return fmt.Errorf("Preflight process check failed: %v", err)
 		}
 	}
 
@@ -0,0 +1,83 @@
+package orchestrator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+)
+
+type testAborter struct {
+	aborted chan struct{}
+}
+
+func (a *testAborter) ObserveHTTP(load.HTTPStats)       {}
+func (a *testAborter) ObserveDocker(docker.DockerStats) {}
+func (a *testAborter) Aborted() <-chan struct{}         { return a.aborted }
+
+func TestAbortCancelsInFlightRequests(t *testing.T) {
+	// The preflight check gets a response, every request after it hangs until it is cancelled
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-r.Context().Done()
+			return
+		}
+	}))
+	defer server.Close()
+
+	aborter := &testAborter{aborted: make(chan struct{})}
+	time.AfterFunc(500*time.Millisecond, func() { close(aborter.aborted) })
+
+	start := time.Now()
+	httpStats, _, _, err := Orchestrate(context.Background(), collector.TestConfig{
+		URL:         server.URL,
+		Duration:    time.Minute,
+		Connections: 2,
+	}, Options{Observers: []Observer{aborter}})
+
+	if err != nil {
+		t.Fatalf("Orchestrate() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Orchestrate() returned %s after the abort, want the hung requests cancelled", elapsed)
+	}
+	if len(httpStats) != 0 {
+		t.Errorf("Orchestrate() returned %d results, want the cancelled requests left out", len(httpStats))
+	}
+}
+
+func TestEndOfTestRecordsInFlightRequests(t *testing.T) {
+	// The preflight check gets a response straight away, every request after it outlasts the test
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			time.Sleep(time.Second)
+		}
+	}))
+	defer server.Close()
+
+	httpStats, _, _, err := Orchestrate(context.Background(), collector.TestConfig{
+		URL:         server.URL,
+		Duration:    200 * time.Millisecond,
+		Connections: 2,
+	}, Options{})
+
+	if err != nil {
+		t.Fatalf("Orchestrate() error = %v", err)
+	}
+	if len(httpStats) != 2 {
+		t.Fatalf("Orchestrate() returned %d results, want the 2 requests in flight at the end", len(httpStats))
+	}
+	for _, stat := range httpStats {
+		if stat.ErrorType != "" || stat.StatusCode != http.StatusOK {
+			t.Errorf("request in flight at the end = %+v, want it to complete", stat)
+		}
+	}
+}
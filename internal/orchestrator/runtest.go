@@ -0,0 +1,207 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/abort"
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/metrics"
+	"github.com/fireproofpenguin/loadship/internal/profile"
+	"github.com/fireproofpenguin/loadship/internal/scrape"
+	"github.com/fireproofpenguin/loadship/internal/sink"
+	"github.com/fireproofpenguin/loadship/internal/telemetry"
+)
+
+// Test is a single load test along with everything recorded around it, shared by every command that runs tests
+type Test struct {
+	// Config is the test to run. Its Logs, LogPatterns and Abort turn on log capture and the abort conditions, and its
+	// Timestamp is set when the test starts.
+	Config collector.TestConfig
+	// Managed starts the target from an image for the test, its published port is the URL when Config has none
+	Managed *docker.ContainerSpec
+	// ResultFile is where the results are saved, nothing is saved when empty. Streams are written as samples arrive,
+	// and logs and profiles are saved next to it.
+	ResultFile string
+	// Scrape and Profile are resolved against the URL once it is known
+	Scrape  *scrape.Config
+	Profile *profile.Config
+	// Exporter, Telemetry and Sinks outlive the test, so are left open. Run is the test's number on the exporter.
+	Exporter  *metrics.Exporter
+	Run       int
+	Telemetry *telemetry.Telemetry
+	Sinks     []sink.Sink
+	Options   Options
+}
+
+// RunTest runs the test and saves its results. The config the test ran with is returned even when it fails, filled
+// in as far as it got, so the failure can be reported against it. A container started from Managed is removed
+// however the test ends, including when ctx is cancelled on Ctrl+C.
+func RunTest(ctx context.Context, test Test) (collector.TestConfig, *collector.JSONOutput, error) {
+	config := test.Config
+	options := test.Options
+	// Failures before the test starts are reported as of when it was attempted
+	config.Timestamp = time.Now()
+	options.Observers = slices.Clone(options.Observers)
+
+	if test.Managed != nil {
+		config.Image = test.Managed.Image
+
+		managed, url, err := StartManaged(ctx, options.Docker, *test.Managed, config.URL)
+
+		if err != nil {
+			return config, nil, fmt.Errorf("error starting %s: %w", test.Managed.Image, err)
+		}
+		defer RemoveManaged(managed)
+
+		config.URL = url
+		config.Containers = append(slices.Clone(config.Containers), managed.Name)
+	}
+
+	var scraper *scrape.Scraper
+	if test.Scrape != nil {
+		resolved, err := test.Scrape.Resolve(config.URL, config.SampleInterval)
+
+		if err != nil {
+			return config, nil, fmt.Errorf("error setting up metrics scraping: %w", err)
+		}
+
+		config.Scrape = &resolved
+		scraper = scrape.New(resolved)
+		options.Observers = append(options.Observers, scraper)
+	}
+
+	var profiler *profile.Profiler
+	if test.Profile != nil {
+		resolved, err := test.Profile.Resolve(config.URL)
+
+		if err != nil {
+			return config, nil, fmt.Errorf("error setting up profiling: %w", err)
+		}
+
+		config.Profile = &resolved
+		profiler = profile.New(resolved, config.Duration, collector.TrimResultExt(test.ResultFile)+"_pprof")
+
+		if err := profiler.Check(); err != nil {
+			return config, nil, fmt.Errorf("error reaching pprof endpoint: %w", err)
+		}
+
+		options.Observers = append(options.Observers, profiler)
+	}
+
+	// The test starts once the container is ready, so time axes don't include pulling the image and waiting for it.
+	// Everything after this only opens files and hands the config to the observers.
+	config.Timestamp = time.Now()
+
+	var watcher *abort.Watcher
+	if config.Abort != nil {
+		watcher = abort.New(*config.Abort)
+		options.Observers = append(options.Observers, watcher)
+	}
+
+	// Streams are written as samples arrive rather than all at once after the test, and only kept once it completes
+	var stream *collector.StreamWriter
+	if collector.IsStreamFile(test.ResultFile) {
+		var err error
+		stream, err = collector.NewStreamWriter(test.ResultFile, config)
+
+		if err != nil {
+			return config, nil, fmt.Errorf("error creating results stream: %w", err)
+		}
+
+		options.Observers = append(options.Observers, stream)
+	}
+	discardStream := func() {
+		if stream != nil {
+			stream.Close(collector.Metrics{})
+			os.Remove(test.ResultFile)
+		}
+	}
+
+	var logs *collector.LogCapture
+	if config.Logs {
+		var err error
+		logs, err = collector.NewLogCapture(collector.TrimResultExt(test.ResultFile)+".log", config.LogPatterns)
+
+		if err != nil {
+			discardStream()
+			return config, nil, fmt.Errorf("error creating log file: %w", err)
+		}
+
+		options.Observers = append(options.Observers, logs)
+	}
+
+	if test.Exporter != nil {
+		test.Exporter.StartRun(config, test.Run)
+		options.Observers = append(options.Observers, test.Exporter)
+	}
+
+	if test.Telemetry != nil {
+		test.Telemetry.StartRun(config)
+		options.Observers = append(options.Observers, test.Telemetry)
+	}
+
+	if len(test.Sinks) > 0 {
+		options.Observers = append(options.Observers, sink.NewAggregator(config, test.Sinks))
+	}
+
+	httpStats, dockerStats, events, err := Orchestrate(ctx, config, options)
+
+	if test.Exporter != nil {
+		test.Exporter.EndRun()
+	}
+
+	var logBuckets []collector.LogBucket
+	if logs != nil {
+		var logsErr error
+		logBuckets, logsErr = logs.Close()
+
+		if logsErr != nil {
+			fmt.Println("Error saving container logs:", logsErr)
+		}
+	}
+
+	if err != nil {
+		discardStream()
+		return config, nil, fmt.Errorf("error during test orchestration: %w", err)
+	}
+
+	aborted := watcher.Reason()
+	metrics := collector.Calculate(httpStats, dockerStats, events, aborted.Duration(config.Duration))
+	if config.Logs {
+		metrics.AddLogs(config.Containers, logBuckets, config.LogPatterns)
+	}
+	var scraped []scrape.Sample
+	if scraper != nil {
+		scraped = scraper.Samples()
+		metrics.AddScraped(scraped)
+	}
+
+	output := collector.ToJSONOutput(httpStats, dockerStats, events, config, *metrics)
+	output.Logs = logBuckets
+	output.Scraped = scraped
+	output.Abort = aborted
+	if profiler != nil {
+		output.Profiles = profiler.Captures()
+	}
+
+	if stream != nil {
+		stream.WriteLogs(output.Logs)
+		stream.WriteScraped(output.Scraped)
+		stream.WriteProfiles(output.Profiles)
+		stream.WriteAbort(output.Abort)
+		err = stream.Close(*metrics)
+	} else if test.ResultFile != "" {
+		err = output.SaveToFile(test.ResultFile)
+	}
+
+	if err != nil {
+		return config, nil, fmt.Errorf("error saving results to %s: %w", test.ResultFile, err)
+	}
+
+	return config, &output, nil
+}
@@ -0,0 +1,106 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+)
+
+// Target is a host process or cgroup to monitor without docker. Exactly one of PID, Name or Cgroup is set.
+type Target struct {
+	// PID monitors a single process
+	PID int `json:"pid,omitempty"`
+	// Name monitors every process with this name, as shown in /proc/<pid>/comm
+	Name string `json:"name,omitempty"`
+	// Cgroup monitors a cgroup v2 group, given as an absolute path or relative to /sys/fs/cgroup
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+// String is the name samples of the target are recorded under in place of a container name
+func (t Target) String() string {
+	switch {
+	case t.PID != 0:
+		return fmt.Sprintf("pid:%d", t.PID)
+	case t.Name != "":
+		return "process:" + t.Name
+	}
+	return "cgroup:" + t.Cgroup
+}
+
+func (t Target) Validate() error {
+	set := 0
+	for _, isSet := range []bool{t.PID != 0, t.Name != "", t.Cgroup != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("process target must set exactly one of pid, name or cgroup")
+	}
+	if t.PID < 0 {
+		return fmt.Errorf("invalid pid %d", t.PID)
+	}
+	return nil
+}
+
+// Targets builds the targets selected by the --pid, --process-name and --cgroup flags
+func Targets(pids []int, names []string, cgroups []string) []Target {
+	var targets []Target
+	for _, pid := range pids {
+		targets = append(targets, Target{PID: pid})
+	}
+	for _, name := range names {
+		targets = append(targets, Target{Name: name})
+	}
+	for _, cgroup := range cgroups {
+		targets = append(targets, Target{Cgroup: cgroup})
+	}
+	return targets
+}
+
+// Check reports whether the target can be monitored, e.g. that the process is running
+func Check(target Target) error {
+	_, err := newSampler(target)
+	return err
+}
+
+// RunMonitor samples the target every interval until ctx is done. Samples have the same shape as docker samples
+// so they are summarised, reported and compared the same way as containers.
+func RunMonitor(ctx context.Context, target Target, interval time.Duration, observe docker.Observer) ([]docker.DockerStats, error) {
+	var results []docker.DockerStats
+
+	s, err := newSampler(target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The first sample only primes the CPU counters so every recorded sample covers a full interval
+	if _, err := s.sample(time.Now()); err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return results, nil
+		case <-ticker.C:
+		}
+
+		stat, err := s.sample(time.Now())
+		if err != nil {
+			return results, err
+		}
+
+		stat.Container = target.String()
+		results = append(results, stat)
+		if observe != nil {
+			observe(stat)
+		}
+	}
+}
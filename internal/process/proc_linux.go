@@ -0,0 +1,416 @@
+//go:build linux
+
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+)
+
+const (
+	procRoot   = "/proc"
+	cgroupRoot = "/sys/fs/cgroup"
+	// clockTicks is USER_HZ, the unit of the CPU times in /proc/<pid>/stat. It is 100 on every mainstream architecture.
+	clockTicks = 100
+	mb         = 1024 * 1024
+)
+
+type sampler struct {
+	target Target
+	// cgroup is the absolute path of the cgroup being monitored, if any
+	cgroup   string
+	memTotal uint64
+
+	prevCPU  time.Duration
+	prevTime time.Time
+}
+
+func newSampler(target Target) (*sampler, error) {
+	if err := target.Validate(); err != nil {
+		return nil, err
+	}
+
+	memTotal, err := readMemTotal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host memory: %w", err)
+	}
+
+	s := &sampler{target: target, memTotal: memTotal}
+
+	if target.Cgroup != "" {
+		s.cgroup = target.Cgroup
+		if s.cgroup != cgroupRoot && !strings.HasPrefix(s.cgroup, cgroupRoot+"/") {
+			s.cgroup = filepath.Join(cgroupRoot, s.cgroup)
+		}
+		if _, err := os.Stat(filepath.Join(s.cgroup, "cgroup.controllers")); err != nil {
+			return nil, fmt.Errorf("%s is not a cgroup v2 group: %w", s.cgroup, err)
+		}
+		return s, nil
+	}
+
+	pids, err := s.pids()
+	if err != nil {
+		return nil, err
+	}
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("no process named %q is running", target.Name)
+	}
+
+	return s, nil
+}
+
+// pids lists the processes that currently make up the target
+func (s *sampler) pids() ([]int, error) {
+	switch {
+	case s.target.PID != 0:
+		if _, err := os.Stat(filepath.Join(procRoot, strconv.Itoa(s.target.PID))); err != nil {
+			return nil, fmt.Errorf("process %d is not running", s.target.PID)
+		}
+		return []int{s.target.PID}, nil
+	case s.cgroup != "":
+		return readCgroupProcs(s.cgroup)
+	}
+	return findByName(s.target.Name)
+}
+
+// sample reads the current resource usage of the target.
+// Processes are summed together, so a name matching a pool of workers reports the whole pool.
+func (s *sampler) sample(now time.Time) (docker.DockerStats, error) {
+	pids, err := s.pids()
+	if err != nil {
+		return docker.DockerStats{}, err
+	}
+	if len(pids) == 0 && s.cgroup == "" {
+		return docker.DockerStats{}, fmt.Errorf("no process named %q is running", s.target.Name)
+	}
+
+	stat := docker.DockerStats{
+		Timestamp:     now,
+		MemoryLimitMB: float64(s.memTotal) / mb,
+	}
+
+	var (
+		cpu                   time.Duration
+		rss                   uint64
+		readBytes, writeBytes uint64
+	)
+
+	var networkPID int
+	for _, pid := range pids {
+		p, err := readProcess(pid)
+		if err != nil {
+			// The process exited between listing and reading it
+			continue
+		}
+		if networkPID == 0 {
+			networkPID = pid
+		}
+		cpu += p.cpu
+		rss += p.rss
+		readBytes += p.readBytes
+		writeBytes += p.writeBytes
+		stat.OpenFDs += p.openFDs
+		stat.Threads += p.threads
+	}
+
+	stat.PIDs = uint64(len(pids))
+	memory := rss
+
+	if s.cgroup != "" {
+		c, err := readCgroup(s.cgroup)
+		if err != nil {
+			return docker.DockerStats{}, err
+		}
+		cpu = c.cpu
+		memory = c.memory
+		readBytes, writeBytes = c.readBytes, c.writeBytes
+		stat.PIDs = c.pids
+		stat.CPUThrottling = c.throttling
+		if c.memoryLimit > 0 && c.memoryLimit < s.memTotal {
+			stat.MemoryLimitMB = float64(c.memoryLimit) / mb
+		}
+	}
+
+	stat.MemoryUsageMB = float64(memory) / mb
+	if stat.MemoryLimitMB > 0 {
+		stat.MemoryPercent = stat.MemoryUsageMB / stat.MemoryLimitMB * 100
+	}
+	stat.DiskReadMB = float64(readBytes) / mb
+	stat.DiskWriteMB = float64(writeBytes) / mb
+
+	if !s.prevTime.IsZero() {
+		if elapsed := now.Sub(s.prevTime); elapsed > 0 && cpu > s.prevCPU {
+			stat.CPUPercent = float64(cpu-s.prevCPU) / float64(elapsed) * 100
+		}
+	}
+	s.prevCPU = cpu
+	s.prevTime = now
+
+	if networkPID != 0 {
+		stat.Network, stat.NetworkInterfaces = readNetwork(networkPID)
+	}
+
+	return stat, nil
+}
+
+type processStats struct {
+	cpu        time.Duration
+	rss        uint64
+	readBytes  uint64
+	writeBytes uint64
+	openFDs    uint64
+	threads    uint64
+}
+
+func readProcess(pid int) (processStats, error) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+
+	data, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return processStats{}, err
+	}
+
+	// The command name can contain spaces and parentheses, so fields are counted from the last ')'
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return processStats{}, fmt.Errorf("unexpected format of %s/stat", dir)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return processStats{}, fmt.Errorf("unexpected format of %s/stat", dir)
+	}
+
+	// Fields are numbered from the state, which is field 3 in proc(5)
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	threads, _ := strconv.ParseUint(fields[17], 10, 64)
+	rssPages, _ := strconv.ParseUint(fields[21], 10, 64)
+
+	p := processStats{
+		cpu:     time.Duration(utime+stime) * time.Second / clockTicks,
+		rss:     rssPages * uint64(os.Getpagesize()),
+		threads: threads,
+	}
+
+	// io and fd are only readable for our own processes unless running as root, so they are left at zero otherwise
+	if values, err := readKeyValues(filepath.Join(dir, "io"), ":"); err == nil {
+		p.readBytes = values["read_bytes"]
+		p.writeBytes = values["write_bytes"]
+	}
+	if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		p.openFDs = uint64(len(fds))
+	}
+
+	return p, nil
+}
+
+func findByName(name string) ([]int, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(procRoot, entry.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(comm)) == name {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+func readCgroupProcs(cgroup string) ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(cgroup, "cgroup.procs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes of cgroup %s: %w", cgroup, err)
+	}
+
+	var pids []int
+	for _, line := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(line); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+type cgroupStats struct {
+	cpu         time.Duration
+	throttling  docker.ThrottlingStats
+	memory      uint64
+	memoryLimit uint64
+	readBytes   uint64
+	writeBytes  uint64
+	pids        uint64
+}
+
+func readCgroup(cgroup string) (cgroupStats, error) {
+	var c cgroupStats
+
+	cpuStat, err := readKeyValues(filepath.Join(cgroup, "cpu.stat"), " ")
+	if err != nil {
+		return c, fmt.Errorf("failed to read cgroup %s: %w", cgroup, err)
+	}
+	c.cpu = time.Duration(cpuStat["usage_usec"]) * time.Microsecond
+	c.throttling = docker.ThrottlingStats{
+		Periods:          cpuStat["nr_periods"],
+		ThrottledPeriods: cpuStat["nr_throttled"],
+		ThrottledTime:    time.Duration(cpuStat["throttled_usec"]) * time.Microsecond,
+	}
+
+	// The root cgroup has no memory or pids files, those are left at zero
+	usage, _ := readUint(filepath.Join(cgroup, "memory.current"))
+	if memoryStat, err := readKeyValues(filepath.Join(cgroup, "memory.stat"), " "); err == nil {
+		// Report the working set like docker does, as the page cache can be reclaimed
+		if inactive := memoryStat["inactive_file"]; inactive < usage {
+			usage -= inactive
+		}
+	}
+	c.memory = usage
+	c.memoryLimit, _ = readUint(filepath.Join(cgroup, "memory.max"))
+	c.pids, _ = readUint(filepath.Join(cgroup, "pids.current"))
+
+	if data, err := os.ReadFile(filepath.Join(cgroup, "io.stat")); err == nil {
+		// Each line is a device followed by key=value counters, e.g. "8:0 rbytes=1459200 wbytes=314773504 ..."
+		for _, line := range strings.Split(string(data), "\n") {
+			for _, field := range strings.Fields(line) {
+				key, value, ok := strings.Cut(field, "=")
+				if !ok {
+					continue
+				}
+				n, _ := strconv.ParseUint(value, 10, 64)
+				switch key {
+				case "rbytes":
+					c.readBytes += n
+				case "wbytes":
+					c.writeBytes += n
+				}
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// readNetwork reads the counters of the network namespace the process is in, which for a host process are the host's.
+// The loopback interface is left out as it would count the load test's own traffic to a local target.
+func readNetwork(pid int) (docker.NetworkStats, map[string]docker.NetworkStats) {
+	var total docker.NetworkStats
+
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(pid), "net", "dev"))
+	if err != nil {
+		return total, nil
+	}
+	defer f.Close()
+
+	interfaces := make(map[string]docker.NetworkStats)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			// Header lines
+			continue
+		}
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(counters)
+		if name == "lo" || len(fields) < 12 {
+			continue
+		}
+
+		values := make([]uint64, len(fields))
+		for i, field := range fields {
+			values[i], _ = strconv.ParseUint(field, 10, 64)
+		}
+
+		iface := docker.NetworkStats{
+			RxBytes:   values[0],
+			RxPackets: values[1],
+			RxErrors:  values[2],
+			RxDropped: values[3],
+			TxBytes:   values[8],
+			TxPackets: values[9],
+			TxErrors:  values[10],
+			TxDropped: values[11],
+		}
+		interfaces[name] = iface
+		total.RxBytes += iface.RxBytes
+		total.RxPackets += iface.RxPackets
+		total.RxErrors += iface.RxErrors
+		total.RxDropped += iface.RxDropped
+		total.TxBytes += iface.TxBytes
+		total.TxPackets += iface.TxPackets
+		total.TxErrors += iface.TxErrors
+		total.TxDropped += iface.TxDropped
+	}
+
+	if len(interfaces) == 0 {
+		return total, nil
+	}
+	return total, interfaces
+}
+
+func readMemTotal() (uint64, error) {
+	values, err := readKeyValues(filepath.Join(procRoot, "meminfo"), ":")
+	if err != nil {
+		return 0, err
+	}
+	// meminfo is in kB
+	return values["MemTotal"] * 1024, nil
+}
+
+// readKeyValues parses files with one "key<sep> value" per line, such as cpu.stat or /proc/<pid>/io
+func readKeyValues(path string, sep string) (map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			values[strings.TrimSpace(key)] = n
+		}
+	}
+	return values, nil
+}
+
+// readUint reads a file holding a single number. "max" means no limit and reads as zero.
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected contents of %s: %w", path, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+)
+
+type sampler struct{}
+
+func newSampler(target Target) (*sampler, error) {
+	return nil, fmt.Errorf("monitoring %s is not supported on %s, only on Linux", target, runtime.GOOS)
+}
+
+func (s *sampler) sample(now time.Time) (docker.DockerStats, error) {
+	return docker.DockerStats{}, fmt.Errorf("process monitoring is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,345 @@
+package profile
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+)
+
+// Profiles that can be captured from net/http/pprof. Mutex and block profiles are only recorded by the target when
+// it sets runtime.SetMutexProfileFraction and runtime.SetBlockProfileRate.
+const (
+	CPU       = "cpu"
+	Heap      = "heap"
+	Allocs    = "allocs"
+	Goroutine = "goroutine"
+	Mutex     = "mutex"
+	Block     = "block"
+)
+
+// Moments of the run profiles can be captured at, alongside offsets such as 30s and percentages such as 75%
+const (
+	AtStart  = "start"
+	AtMiddle = "middle"
+	AtEnd    = "end"
+)
+
+var (
+	// DefaultProfiles are captured when none are selected
+	DefaultProfiles = []string{CPU, Heap, Goroutine, Mutex}
+	// DefaultCPUDuration is how long the CPU is profiled for at each moment
+	DefaultCPUDuration = 10 * time.Second
+
+	profiles = []string{CPU, Heap, Allocs, Goroutine, Mutex, Block}
+)
+
+// Config selects the pprof endpoint of the target and which profiles are captured when
+type Config struct {
+	// URL is the pprof index, e.g. http://localhost:6060/debug/pprof, or a path on the target such as /debug/pprof
+	URL      string   `json:"url"`
+	Profiles []string `json:"profiles,omitempty"`
+	// At are the moments profiles are captured at: start, middle, end, an offset into the run or a percentage of it
+	At []string `json:"at,omitempty"`
+	// CPUDuration is how long the CPU is profiled for, cut short when the run ends first
+	CPUDuration time.Duration `json:"cpu_duration,omitempty" yaml:"cpu_duration"`
+}
+
+func (c Config) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("pprof URL cannot be empty")
+	}
+	if !strings.HasPrefix(c.URL, "/") {
+		if parsed, err := url.Parse(c.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("invalid pprof URL %q: must be an http(s) URL or a path on the target", c.URL)
+		}
+	}
+	for _, p := range c.Profiles {
+		if !slices.Contains(profiles, p) {
+			return fmt.Errorf("unknown profile %q: must be one of %s", p, strings.Join(profiles, ", "))
+		}
+	}
+	for _, at := range c.At {
+		if _, err := offset(at, time.Hour); err != nil {
+			return err
+		}
+	}
+	if c.CPUDuration < 0 {
+		return fmt.Errorf("CPU profile duration cannot be negative")
+	}
+	return nil
+}
+
+// Resolve makes a path absolute against the target URL and fills in the defaults, so the config recorded in the
+// results says exactly what was captured
+func (c Config) Resolve(target string) (Config, error) {
+	resolved := c
+	if len(resolved.Profiles) == 0 {
+		resolved.Profiles = DefaultProfiles
+	}
+	if len(resolved.At) == 0 {
+		resolved.At = []string{AtEnd}
+	}
+	if resolved.CPUDuration <= 0 {
+		resolved.CPUDuration = DefaultCPUDuration
+	}
+
+	if strings.HasPrefix(c.URL, "/") {
+		base, err := url.Parse(target)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to resolve %s against %s: %w", c.URL, target, err)
+		}
+		path, _ := url.Parse(c.URL)
+		resolved.URL = base.ResolveReference(path).String()
+	}
+	resolved.URL = strings.TrimSuffix(resolved.URL, "/")
+
+	return resolved, nil
+}
+
+// offset is how far into a run of the given duration a moment is
+func offset(at string, duration time.Duration) (time.Duration, error) {
+	switch at {
+	case AtStart:
+		return 0, nil
+	case AtMiddle:
+		return duration / 2, nil
+	case AtEnd:
+		return duration, nil
+	}
+
+	if percent, found := strings.CutSuffix(at, "%"); found {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("invalid profile moment %q: percentages must be between 0%% and 100%%", at)
+		}
+		return time.Duration(float64(duration) * p / 100), nil
+	}
+
+	d, err := time.ParseDuration(at)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid profile moment %q: must be start, middle, end, an offset such as 30s or a percentage such as 75%%", at)
+	}
+	return min(d, duration), nil
+}
+
+// Capture is a profile saved during a run
+type Capture struct {
+	Type string `json:"type"`
+	// At is the moment it was requested for and Elapsed how far into the run it was taken
+	At      string        `json:"at"`
+	Elapsed time.Duration `json:"elapsed"`
+	// File is relative to the results file, e.g. results_pprof/cpu_end.pb.gz
+	File string `json:"file"`
+}
+
+// Profiler captures profiles from the target's pprof endpoint at the configured moments of a run
+type Profiler struct {
+	config   Config
+	duration time.Duration
+	dir      string
+	client   *http.Client
+
+	mu       sync.Mutex
+	captures []Capture
+}
+
+// New creates a profiler for a resolved config, saving the profiles to dir
+func New(config Config, duration time.Duration, dir string) *Profiler {
+	return &Profiler{
+		config:   config,
+		duration: duration,
+		dir:      dir,
+		client:   &http.Client{},
+	}
+}
+
+// Check makes sure the pprof endpoint is reachable before the run starts
+func (p *Profiler) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.URL+"/", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", p.config.URL, resp.Status)
+	}
+
+	return os.MkdirAll(p.dir, 0o755)
+}
+
+func (p *Profiler) ObserveHTTP(load.HTTPStats) {}
+
+func (p *Profiler) ObserveDocker(docker.DockerStats) {}
+
+// capture is a profile scheduled at an offset into the run
+type capture struct {
+	profile string
+	at      string
+	offset  time.Duration
+	seconds int
+}
+
+// schedule works out when each profile is captured. Every capture has to finish before the run does, so profiles
+// at the end are taken a second early and CPU profiles start early enough to cover their full duration.
+func (p *Profiler) schedule() []capture {
+	var captures []capture
+	for _, at := range p.config.At {
+		// Already validated
+		start, _ := offset(at, p.duration)
+
+		for _, profile := range p.config.Profiles {
+			c := capture{profile: profile, at: at, offset: min(start, max(p.duration-time.Second, 0))}
+
+			if profile == CPU {
+				cpuDuration := min(p.config.CPUDuration, p.duration).Truncate(time.Second)
+				c.offset = min(start, p.duration-cpuDuration)
+				c.seconds = max(int(cpuDuration.Seconds()), 1)
+			}
+
+			captures = append(captures, c)
+		}
+	}
+
+	slices.SortStableFunc(captures, func(a, b capture) int {
+		return cmp.Compare(a.offset, b.offset)
+	})
+
+	// Only one CPU profile can run at a time, so a CPU profile overlapping the one before it waits for it to finish
+	// and is cut short, or is skipped when the run would be over by then
+	var scheduled []capture
+	var cpuFree time.Duration
+	var previous string
+	for _, c := range captures {
+		if c.profile == CPU {
+			if c.offset < cpuFree {
+				seconds := min(c.seconds, int((p.duration - cpuFree).Seconds()))
+				if seconds < 1 {
+					fmt.Printf("Skipping the CPU profile at %s, it would overlap the one at %s\n", c.at, previous)
+					continue
+				}
+				c.offset, c.seconds = cpuFree, seconds
+			}
+			// pprof takes a moment to release the profiler after a profile is written
+			cpuFree = c.offset + time.Duration(c.seconds+1)*time.Second
+			previous = c.at
+		}
+		scheduled = append(scheduled, c)
+	}
+
+	slices.SortStableFunc(scheduled, func(a, b capture) int {
+		return cmp.Compare(a.offset, b.offset)
+	})
+	return scheduled
+}
+
+// Run captures each profile at its moment. Captures already in progress when ctx is done are allowed to finish.
+func (p *Profiler) Run(ctx context.Context) {
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for _, c := range p.schedule() {
+		timer := time.NewTimer(time.Until(start.Add(c.offset)))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			wg.Wait()
+			return
+		case <-timer.C:
+		}
+
+		wg.Go(func() {
+			elapsed := time.Since(start).Truncate(time.Second)
+			if err := p.capture(c, elapsed); err != nil {
+				fmt.Printf("Capturing %s profile at %s failed: %v\n", c.profile, c.at, err)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func (p *Profiler) capture(c capture, elapsed time.Duration) error {
+	endpoint := fmt.Sprintf("%s/%s", p.config.URL, c.profile)
+	if c.profile == CPU {
+		endpoint = fmt.Sprintf("%s/profile?seconds=%d", p.config.URL, c.seconds)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.seconds)*time.Second+30*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", endpoint, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	// e.g. cpu_end.pb.gz or heap_30s.pb.gz
+	name := fmt.Sprintf("%s_%s.pb.gz", c.profile, strings.ReplaceAll(c.at, "%", "pct"))
+	f, err := os.Create(filepath.Join(p.dir, name))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.captures = append(p.captures, Capture{
+		Type:    c.profile,
+		At:      c.at,
+		Elapsed: elapsed,
+		File:    filepath.ToSlash(filepath.Join(filepath.Base(p.dir), name)),
+	})
+	return nil
+}
+
+// Captures returns the profiles saved during the run, in the order they were taken
+func (p *Profiler) Captures() []Capture {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	captures := slices.Clone(p.captures)
+	slices.SortStableFunc(captures, func(a, b Capture) int {
+		return cmp.Compare(a.Elapsed, b.Elapsed)
+	})
+	return captures
+}
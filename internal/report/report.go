@@ -2,16 +2,21 @@ package report
 
 import (
 	"bytes"
+	"cmp"
 	_ "embed"
 	"fmt"
 	"html/template"
+	"maps"
 	"math"
 	"slices"
 	"time"
 
+	"github.com/fireproofpenguin/loadship/internal/abort"
 	"github.com/fireproofpenguin/loadship/internal/collector"
 	"github.com/fireproofpenguin/loadship/internal/docker"
 	"github.com/fireproofpenguin/loadship/internal/load"
+	"github.com/fireproofpenguin/loadship/internal/profile"
+	"github.com/fireproofpenguin/loadship/internal/scrape"
 )
 
 //go:embed template.html
@@ -35,37 +40,155 @@ func Generate(data ReportData) ([]byte, error) {
 }
 
 type ReportData struct {
-	Summary     collector.Metrics
-	Metadata    collector.TestConfig
-	Labels      []string
-	RPS         []float64
-	Errors      []float64
-	Latency     []float64
-	Memory      []float64
-	CPU         []float64
-	DiskReadMB  []float64
-	DiskWriteMB []float64
-	PIDs        []uint64
+	Summary    collector.Metrics
+	Metadata   collector.TestConfig
+	Labels     []string
+	RPS        []float64
+	Errors     []float64
+	Latency    []float64
+	Containers []ContainerSeries
+	// NetworkIssues is set when any container saw network errors or dropped packets
+	NetworkIssues bool
+	// MemoryLimits is set when the memory limit of the containers was recorded
+	MemoryLimits bool
+	// Throttled is set when any container had its CPU throttled
+	Throttled bool
+	Events    []EventMarker
+	// Logs is set when the containers' logs were captured
+	Logs []LogSeries
+	// Scraped has a chart per metric scraped from the target's metrics endpoints
+	Scraped []ScrapedChart
+	// Profiles link to the pprof profiles captured during the test, relative to the results file
+	Profiles []profile.Capture
+	// Capacity is set when the report is for the sustainable trial of a capacity search
+	Capacity *CapacityCurve
+	// Abort is why the test was stopped early, if it was
+	Abort *abort.Reason
+}
+
+// CapacityCurve is the throughput and latency of every trial of a capacity search, charted as latency against
+// throughput to show where the knee is
+type CapacityCurve struct {
+	// Mode is what the search varied, connections or rate
+	Mode string
+	// Sustainable is the highest load that met the SLO, zero when none did
+	Sustainable int
+	RPS         float64
+	// P99Limit is the p99 latency the SLO allows in milliseconds, ErrorRateLimit the percentage of failed requests
+	P99Limit       int64
+	ErrorRateLimit float64
+	// Trials are in order of their load
+	Trials []CapacityTrial
+}
+
+type CapacityTrial struct {
+	Load      int
+	RPS       float64
+	P50       int64
+	P95       int64
+	P99       int64
+	ErrorRate float64
+	Passed    bool
+}
+
+// ScrapedChart charts every series of a scraped metric. Counters are charted as their rate per second.
+type ScrapedChart struct {
+	Title  string
+	Series []ScrapedSeries
+}
+
+type ScrapedSeries struct {
+	Label  string
+	Values []float64
+}
+
+// LogSeries are the lines a container logged each second, in total and matching each log pattern
+type LogSeries struct {
+	Name    string
+	Lines   []int
+	Matches []MatchSeries
+}
+
+type MatchSeries struct {
+	Pattern string
+	Lines   []int
+}
+
+// EventMarker is a container event annotated on the charts
+type EventMarker struct {
+	// Index is the position of the event on the chart labels
+	Index   int
+	Elapsed string
+	Type    string
+	Text    string
+}
+
+// ContainerSeries are the per-second chart series of a single container.
+// Disk and network are the amount transferred within each second.
+type ContainerSeries struct {
+	Name           string
+	Memory         []float64
+	MemoryPercent  []float64
+	CPU            []float64
+	Throttled      []float64
+	DiskReadMB     []float64
+	DiskWriteMB    []float64
+	PIDs           []uint64
+	NetworkRxMB    []float64
+	NetworkTxMB    []float64
+	NetworkErrors  []uint64
+	NetworkDropped []uint64
 }
 
 func CreateReportData(json *collector.JSONOutput) ReportData {
-	labels, rps, errors, latency := bucketHTTP(json.HTTPStats, json.Metadata.Timestamp)
+	seconds, rps, errors, latency := bucketHTTP(json.HTTPStats, json.Metadata.Timestamp)
+
+	labels := make([]string, len(seconds))
+	for i, second := range seconds {
+		labels[i] = fmt.Sprintf("%ds", second)
+	}
+
+	data := ReportData{
+		Summary:  sanitiseSummary(json.Summary),
+		Metadata: json.Metadata,
+		Labels:   labels,
+		RPS:      rps,
+		Errors:   errors,
+		Latency:  latency,
+	}
+
+	byContainer := make(map[string][]docker.DockerStats)
+	for _, stat := range json.DockerStats {
+		byContainer[stat.Container] = append(byContainer[stat.Container], stat)
+	}
 
-	memory, cpu, diskReadMB, diskWriteMB, pids := bucketDocker(json.DockerStats, json.Metadata.Timestamp)
+	for _, name := range slices.Sorted(maps.Keys(byContainer)) {
+		data.Containers = append(data.Containers, bucketDocker(name, byContainer[name], json.Metadata.Timestamp, seconds))
+	}
 
-	return ReportData{
-		Summary:     sanitiseSummary(json.Summary),
-		Metadata:    json.Metadata,
-		Labels:      labels,
-		RPS:         rps,
-		Errors:      errors,
-		Latency:     latency,
-		Memory:      memory,
-		CPU:         cpu,
-		DiskReadMB:  diskReadMB,
-		DiskWriteMB: diskWriteMB,
-		PIDs:        pids,
+	for _, container := range json.Summary.Containers {
+		if container.Network.Errors > 0 || container.Network.Dropped > 0 {
+			data.NetworkIssues = true
+		}
+		if container.Memory.LimitMB > 0 {
+			data.MemoryLimits = true
+		}
+		if container.CPU.ThrottledPeriods > 0 {
+			data.Throttled = true
+		}
 	}
+
+	data.Events = eventMarkers(json.Events, seconds, json.Metadata.Timestamp)
+
+	if json.Metadata.Logs {
+		data.Logs = bucketLogs(json.Metadata.Containers, json.Metadata.LogPatterns, json.Logs, seconds, json.Metadata.Timestamp)
+	}
+
+	data.Scraped = scrapedCharts(json.Scraped, seconds, json.Metadata.Timestamp)
+	data.Profiles = json.Profiles
+	data.Abort = json.Abort
+
+	return data
 }
 
 func roundFloat(val float64, precision int) float64 {
@@ -79,7 +202,9 @@ func sanitiseSummary(summary collector.Metrics) collector.Metrics {
 	return summary
 }
 
-func bucketHTTP(stats []load.HTTPStats, testStart time.Time) ([]string, []float64, []float64, []float64) {
+// bucketHTTP groups requests by the second of the test they were made in, returning the seconds that had any requests
+// along with the requests, errors and average latency of each
+func bucketHTTP(stats []load.HTTPStats, testStart time.Time) ([]int64, []float64, []float64, []float64) {
 	type bucket struct {
 		requests int
 		errors   int
@@ -109,13 +234,11 @@ func bucketHTTP(stats []load.HTTPStats, testStart time.Time) ([]string, []float6
 
 	slices.Sort(keys)
 
-	labels := make([]string, len(keys))
 	rps := make([]float64, len(keys))
 	errors := make([]float64, len(keys))
 	latency := make([]float64, len(keys))
 
 	for i, k := range keys {
-		labels[i] = fmt.Sprintf("%ds", k)
 		rps[i] = float64(buckets[k].requests)
 		errors[i] = float64(buckets[k].errors)
 		var totalLatency int64
@@ -129,60 +252,209 @@ func bucketHTTP(stats []load.HTTPStats, testStart time.Time) ([]string, []float6
 		}
 	}
 
-	return labels, rps, errors, latency
+	return keys, rps, errors, latency
 }
 
-func bucketDocker(stats []docker.DockerStats, testStart time.Time) ([]float64, []float64, []float64, []float64, []uint64) {
-	type bucket struct {
-		memoryUsageMB float64
-		cpuPercent    float64
-		diskReadMB    float64
-		diskWriteMB   float64
-		pids          uint64
+// bucketDocker lines the samples of a container up with the chart's seconds, using the latest sample taken by each second.
+// Disk and network are rates between that sample and the one before it, so they read the same whatever the sampling interval.
+func bucketDocker(name string, stats []docker.DockerStats, testStart time.Time, seconds []int64) ContainerSeries {
+	series := ContainerSeries{
+		Name:           name,
+		Memory:         make([]float64, len(seconds)),
+		MemoryPercent:  make([]float64, len(seconds)),
+		CPU:            make([]float64, len(seconds)),
+		Throttled:      make([]float64, len(seconds)),
+		DiskReadMB:     make([]float64, len(seconds)),
+		DiskWriteMB:    make([]float64, len(seconds)),
+		PIDs:           make([]uint64, len(seconds)),
+		NetworkRxMB:    make([]float64, len(seconds)),
+		NetworkTxMB:    make([]float64, len(seconds)),
+		NetworkErrors:  make([]uint64, len(seconds)),
+		NetworkDropped: make([]uint64, len(seconds)),
 	}
 
-	buckets := make(map[int64]*bucket)
+	const mb = 1024 * 1024
 
-	for _, s := range stats {
-		second := int64(s.Timestamp.Sub(testStart).Seconds())
+	next := 0
+	for i, second := range seconds {
+		end := testStart.Add(time.Duration(second+1) * time.Second)
+		for next < len(stats) && stats[next].Timestamp.Before(end) {
+			next++
+		}
+		if next == 0 {
+			// No samples yet
+			continue
+		}
+
+		current := stats[next-1]
+		series.Memory[i] = current.MemoryUsageMB
+		series.MemoryPercent[i] = roundFloat(current.MemoryPercent, 2)
+		series.CPU[i] = roundFloat(current.CPUPercent, 2)
+		series.PIDs[i] = current.PIDs
 
-		buckets[second] = &bucket{
-			memoryUsageMB: s.MemoryUsageMB,
-			cpuPercent:    s.CPUPercent,
-			diskReadMB:    s.DiskReadMB,
-			diskWriteMB:   s.DiskWriteMB,
-			pids:          s.PIDs,
+		if next < 2 {
+			continue
+		}
+
+		previous := stats[next-2]
+		elapsed := current.Timestamp.Sub(previous.Timestamp).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+
+		series.DiskReadMB[i] = roundFloat(max(current.DiskReadMB-previous.DiskReadMB, 0)/elapsed, 3)
+		series.DiskWriteMB[i] = roundFloat(max(current.DiskWriteMB-previous.DiskWriteMB, 0)/elapsed, 3)
+		series.NetworkRxMB[i] = roundFloat(float64(counterDelta(previous.Network.RxBytes, current.Network.RxBytes))/mb/elapsed, 3)
+		series.NetworkTxMB[i] = roundFloat(float64(counterDelta(previous.Network.TxBytes, current.Network.TxBytes))/mb/elapsed, 3)
+		series.NetworkErrors[i] = counterDelta(previous.Network.RxErrors+previous.Network.TxErrors, current.Network.RxErrors+current.Network.TxErrors)
+		series.NetworkDropped[i] = counterDelta(previous.Network.RxDropped+previous.Network.TxDropped, current.Network.RxDropped+current.Network.TxDropped)
+		if periods := counterDelta(previous.CPUThrottling.Periods, current.CPUThrottling.Periods); periods > 0 {
+			throttled := counterDelta(previous.CPUThrottling.ThrottledPeriods, current.CPUThrottling.ThrottledPeriods)
+			series.Throttled[i] = roundFloat(float64(throttled)/float64(periods)*100, 2)
 		}
 	}
 
-	keys := make([]int64, 0, len(buckets))
-	for k := range buckets {
-		keys = append(keys, k)
+	return series
+}
+
+// bucketLogs lines the log counts of each container up with the chart's seconds. Like events, lines logged in a
+// second without any requests are added to the next charted second.
+func bucketLogs(containers, patterns []string, buckets []collector.LogBucket, seconds []int64, testStart time.Time) []LogSeries {
+	if len(seconds) == 0 {
+		return nil
 	}
 
-	slices.Sort(keys)
+	series := make([]LogSeries, len(containers))
+	byContainer := make(map[string]*LogSeries)
+	for i, name := range containers {
+		series[i] = LogSeries{Name: name, Lines: make([]int, len(seconds))}
+		for _, pattern := range patterns {
+			series[i].Matches = append(series[i].Matches, MatchSeries{Pattern: pattern, Lines: make([]int, len(seconds))})
+		}
+		byContainer[name] = &series[i]
+	}
 
-	memoryUsage := make([]float64, len(keys))
-	cpuPercent := make([]float64, len(keys))
-	diskReadMB := make([]float64, len(keys))
-	diskWriteMB := make([]float64, len(keys))
-	pids := make([]uint64, len(keys))
+	for _, bucket := range buckets {
+		s, ok := byContainer[bucket.Container]
+		if !ok {
+			continue
+		}
+
+		index, _ := slices.BinarySearch(seconds, int64(bucket.Timestamp.Sub(testStart).Seconds()))
+		if index == len(seconds) {
+			index--
+		}
 
-	var previousReadMB, previousWriteMB float64
-	if len(keys) > 0 {
-		previousReadMB = buckets[keys[0]].diskReadMB
-		previousWriteMB = buckets[keys[0]].diskWriteMB
+		s.Lines[index] += bucket.Lines
+		for _, match := range s.Matches {
+			match.Lines[index] += bucket.Matches[match.Pattern]
+		}
 	}
 
-	for i, k := range keys {
-		memoryUsage[i] = buckets[k].memoryUsageMB
-		cpuPercent[i] = roundFloat(buckets[k].cpuPercent, 2)
-		diskReadMB[i] = buckets[k].diskReadMB - previousReadMB
-		diskWriteMB[i] = buckets[k].diskWriteMB - previousWriteMB
-		previousReadMB = buckets[k].diskReadMB
-		previousWriteMB = buckets[k].diskWriteMB
-		pids[i] = buckets[k].pids
+	return series
+}
+
+// scrapedCharts groups the scraped series into a chart per metric and endpoint, lined up with the chart's seconds
+// the same way as docker samples
+func scrapedCharts(samples []scrape.Sample, seconds []int64, testStart time.Time) []ScrapedChart {
+	type key struct{ target, series string }
+
+	bySeries := make(map[key][]scrape.Sample)
+	targets := make(map[string]bool)
+	for _, sample := range samples {
+		k := key{sample.Target, sample.Series}
+		bySeries[k] = append(bySeries[k], sample)
+		targets[sample.Target] = true
+	}
+
+	keys := slices.SortedFunc(maps.Keys(bySeries), func(a, b key) int {
+		return cmp.Or(cmp.Compare(a.target, b.target), cmp.Compare(a.series, b.series))
+	})
+
+	var charts []ScrapedChart
+	for _, k := range keys {
+		series := bySeries[k]
+
+		title := scrape.BaseName(k.series)
+		if len(targets) > 1 {
+			title = fmt.Sprintf("%s (%s)", title, k.target)
+		}
+		if series[0].Type == scrape.TypeCounter {
+			title += " per second"
+		}
+
+		if len(charts) == 0 || charts[len(charts)-1].Title != title {
+			charts = append(charts, ScrapedChart{Title: title})
+		}
+		chart := &charts[len(charts)-1]
+		chart.Series = append(chart.Series, ScrapedSeries{Label: k.series, Values: bucketScraped(series, seconds, testStart)})
+	}
+
+	return charts
+}
+
+// bucketScraped uses the latest sample taken by each second, or for counters the rate between it and the one before
+func bucketScraped(samples []scrape.Sample, seconds []int64, testStart time.Time) []float64 {
+	values := make([]float64, len(seconds))
+	counter := samples[0].Type == scrape.TypeCounter
+
+	next := 0
+	for i, second := range seconds {
+		end := testStart.Add(time.Duration(second+1) * time.Second)
+		for next < len(samples) && samples[next].Timestamp.Before(end) {
+			next++
+		}
+		if next == 0 {
+			continue
+		}
+
+		current := samples[next-1]
+		if !counter {
+			values[i] = roundFloat(current.Value, 3)
+			continue
+		}
+
+		if next < 2 {
+			continue
+		}
+		previous := samples[next-2]
+		if elapsed := current.Timestamp.Sub(previous.Timestamp).Seconds(); elapsed > 0 {
+			values[i] = roundFloat(max(current.Value-previous.Value, 0)/elapsed, 3)
+		}
 	}
 
-	return memoryUsage, cpuPercent, diskReadMB, diskWriteMB, pids
+	return values
+}
+
+// eventMarkers places each event on the first chart second at or after the second it happened in,
+// as seconds without any requests are not charted
+func eventMarkers(events []docker.Event, seconds []int64, testStart time.Time) []EventMarker {
+	if len(seconds) == 0 {
+		return nil
+	}
+
+	markers := make([]EventMarker, 0, len(events))
+	for _, event := range events {
+		second := int64(event.Timestamp.Sub(testStart).Seconds())
+
+		index, _ := slices.BinarySearch(seconds, second)
+		if index == len(seconds) {
+			index--
+		}
+
+		markers = append(markers, EventMarker{
+			Index:   index,
+			Elapsed: event.Timestamp.Sub(testStart).Truncate(time.Second).String(),
+			Type:    event.Type,
+			Text:    event.String(),
+		})
+	}
+	return markers
+}
+
+func counterDelta(from, to uint64) uint64 {
+	if to < from {
+		return 0
+	}
+	return to - from
 }
@@ -9,9 +9,20 @@ import (
 	"github.com/fireproofpenguin/loadship/internal/collector"
 )
 
-func Write(json *collector.JSONOutput, reportName string) {
+// Write generates the HTML report for a result and returns the path it was saved to, or an empty string if saving failed
+func Write(json *collector.JSONOutput, reportName string) string {
+	return write(CreateReportData(json), reportName)
+}
+
+// WriteCapacity generates the HTML report for the sustainable trial of a capacity search, with the curve of every
+// trial above it
+func WriteCapacity(json *collector.JSONOutput, curve CapacityCurve, reportName string) string {
 	reportData := CreateReportData(json)
+	reportData.Capacity = &curve
+	return write(reportData, reportName)
+}
 
+func write(reportData ReportData, reportName string) string {
 	reportBytes, err := Generate(reportData)
 
 	if err != nil {
@@ -22,15 +33,16 @@ func Write(json *collector.JSONOutput, reportName string) {
 
 	if err != nil {
 		fmt.Println("Error determining absolute path for report:", err)
-		return
+		return ""
 	}
 
 	err = os.WriteFile(outputPath, reportBytes, 0644)
 
 	if err != nil {
 		fmt.Println("Error writing report:", err)
-		return
+		return ""
 	}
 
 	fmt.Printf("\n✓ Report saved to %s\n", outputPath)
+	return outputPath
 }
@@ -0,0 +1,286 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Types a scraped series can have. Counters are charted and compared as a rate per second.
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+)
+
+// Config selects the Prometheus metrics endpoints scraped during a test and the metrics recorded from them
+type Config struct {
+	// URLs are metrics endpoints, or paths such as /metrics on the target
+	URLs []string `json:"urls"`
+	// Metrics are the names of the metric families to record, e.g. go_gc_duration_seconds or db_pool_in_use
+	Metrics []string `json:"metrics"`
+	// Interval is how often the endpoints are scraped, the sample interval when zero
+	Interval time.Duration `json:"interval,omitempty"`
+}
+
+func (c Config) Validate() error {
+	if len(c.URLs) == 0 {
+		return fmt.Errorf("must provide at least one metrics URL to scrape")
+	}
+	if len(c.Metrics) == 0 {
+		return fmt.Errorf("must select at least one metric to record from %s", strings.Join(c.URLs, ", "))
+	}
+	for _, u := range c.URLs {
+		if strings.HasPrefix(u, "/") {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("invalid metrics URL %q: must be an http(s) URL or a path on the target", u)
+		}
+	}
+	if c.Interval != 0 && c.Interval < docker.MinSampleInterval {
+		return fmt.Errorf("scrape interval must be at least %s", docker.MinSampleInterval)
+	}
+	return nil
+}
+
+// Resolve makes paths absolute against the target URL and fills in the interval, so the config recorded in the
+// results says exactly what was scraped
+func (c Config) Resolve(target string, sampleInterval time.Duration) (Config, error) {
+	resolved := Config{Metrics: c.Metrics, Interval: c.Interval}
+	if resolved.Interval <= 0 {
+		resolved.Interval = sampleInterval
+	}
+	if resolved.Interval <= 0 {
+		resolved.Interval = docker.DefaultSampleInterval
+	}
+
+	for _, u := range c.URLs {
+		if !strings.HasPrefix(u, "/") {
+			resolved.URLs = append(resolved.URLs, u)
+			continue
+		}
+
+		base, err := url.Parse(target)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to resolve %s against %s: %w", u, target, err)
+		}
+		path, _ := url.Parse(u)
+		resolved.URLs = append(resolved.URLs, base.ResolveReference(path).String())
+	}
+
+	return resolved, nil
+}
+
+// Sample is the value of one series at the time it was scraped
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Target is the metrics URL the series was scraped from
+	Target string `json:"target"`
+	// Series is the metric name and its labels, e.g. db_pool_in_use{pool="orders"}
+	Series string  `json:"series"`
+	Type   string  `json:"type"`
+	Value  float64 `json:"value"`
+}
+
+// Scraper scrapes the metrics endpoints on an interval for as long as the test is running
+type Scraper struct {
+	config  Config
+	metrics map[string]bool
+	client  *http.Client
+
+	mu      sync.Mutex
+	samples []Sample
+	// failing records endpoints that have already reported an error, so a dead endpoint doesn't flood the output
+	failing map[string]bool
+}
+
+// New creates a scraper for a resolved config
+func New(config Config) *Scraper {
+	metrics := make(map[string]bool)
+	for _, name := range config.Metrics {
+		metrics[name] = true
+	}
+
+	return &Scraper{
+		config:  config,
+		metrics: metrics,
+		client:  &http.Client{Timeout: max(config.Interval, 5*time.Second)},
+		failing: make(map[string]bool),
+	}
+}
+
+func (s *Scraper) ObserveHTTP(load.HTTPStats) {}
+
+func (s *Scraper) ObserveDocker(docker.DockerStats) {}
+
+// Run scrapes every endpoint straight away and then on every interval until ctx is done
+func (s *Scraper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+		for _, target := range s.config.URLs {
+			wg.Go(func() {
+				s.scrapeTarget(ctx, target)
+			})
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Samples returns every sample scraped, ordered by time
+func (s *Scraper) Samples() []Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	samples := slices.Clone(s.samples)
+	slices.SortStableFunc(samples, func(a, b Sample) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return samples
+}
+
+func (s *Scraper) scrapeTarget(ctx context.Context, target string) {
+	timestamp := time.Now()
+	samples, err := s.scrape(ctx, target, timestamp)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		// Scrapes cut short by the end of the test aren't failures
+		if ctx.Err() == nil && !s.failing[target] {
+			fmt.Printf("Scraping %s failed: %v\n", target, err)
+			s.failing[target] = true
+		}
+		return
+	}
+
+	s.samples = append(s.samples, samples...)
+}
+
+func (s *Scraper) scrape(ctx context.Context, target string, timestamp time.Time) ([]Sample, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeTextPlain)))
+
+	resp, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	decoder := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+
+	var samples []Sample
+	for {
+		var family dto.MetricFamily
+		err := decoder.Decode(&family)
+
+		if errors.Is(err, io.EOF) {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metrics: %w", err)
+		}
+
+		for _, sample := range s.familySamples(&family) {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+			sample.Timestamp, sample.Target = timestamp, target
+			samples = append(samples, sample)
+		}
+	}
+}
+
+// familySamples flattens the selected series of a family. Summaries and histograms are recorded as their _sum and
+// _count counters, along with each quantile of a summary.
+func (s *Scraper) familySamples(family *dto.MetricFamily) []Sample {
+	name := family.GetName()
+
+	var samples []Sample
+	add := func(series string, labels []*dto.LabelPair, extra *dto.LabelPair, kind string, value float64) {
+		if !s.metrics[name] && !s.metrics[series] {
+			return
+		}
+		samples = append(samples, Sample{Series: seriesName(series, labels, extra), Type: kind, Value: value})
+	}
+
+	for _, metric := range family.GetMetric() {
+		labels := metric.GetLabel()
+
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			add(name, labels, nil, TypeCounter, metric.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			add(name, labels, nil, TypeGauge, metric.GetGauge().GetValue())
+		case dto.MetricType_UNTYPED:
+			add(name, labels, nil, TypeGauge, metric.GetUntyped().GetValue())
+		case dto.MetricType_SUMMARY:
+			summary := metric.GetSummary()
+			for _, quantile := range summary.GetQuantile() {
+				label, q := "quantile", fmt.Sprint(quantile.GetQuantile())
+				add(name, labels, &dto.LabelPair{Name: &label, Value: &q}, TypeGauge, quantile.GetValue())
+			}
+			add(name+"_sum", labels, nil, TypeCounter, summary.GetSampleSum())
+			add(name+"_count", labels, nil, TypeCounter, float64(summary.GetSampleCount()))
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			histogram := metric.GetHistogram()
+			add(name+"_sum", labels, nil, TypeCounter, histogram.GetSampleSum())
+			add(name+"_count", labels, nil, TypeCounter, float64(histogram.GetSampleCount()))
+		}
+	}
+
+	return samples
+}
+
+// seriesName formats a series the way Prometheus does, e.g. http_requests_total{code="200",method="GET"}
+func seriesName(name string, labels []*dto.LabelPair, extra *dto.LabelPair) string {
+	if extra != nil {
+		labels = append(slices.Clone(labels), extra)
+	}
+	if len(labels) == 0 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+	}
+	slices.Sort(pairs)
+
+	return fmt.Sprintf("%s{%s}", name, strings.Join(pairs, ","))
+}
+
+// BaseName is the metric name of a series without its labels
+func BaseName(series string) string {
+	name, _, _ := strings.Cut(series, "{")
+	return name
+}
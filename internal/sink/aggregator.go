@@ -0,0 +1,143 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+)
+
+// Aggregator rolls requests up into one Interval per second and streams them, along with every docker sample, to sinks
+type Aggregator struct {
+	run   Run
+	sinks []Sink
+
+	mu           sync.Mutex
+	requests     int
+	failed       int
+	errors       map[string]int
+	totalLatency float64
+	latency      *hdrhistogram.Histogram
+
+	// writeMu serialises writes to the sinks separately from mu so slow sinks never hold up the connections
+	writeMu sync.Mutex
+	// failing records sinks that have already reported an error, so a dead endpoint doesn't flood the output
+	failing map[int]bool
+}
+
+func NewAggregator(config collector.TestConfig, sinks []Sink) *Aggregator {
+	return &Aggregator{
+		run: Run{
+			URL:  config.URL,
+			Tags: config.Tags,
+		},
+		sinks:   sinks,
+		errors:  make(map[string]int),
+		latency: hdrhistogram.New(1, 60000, 3),
+		failing: make(map[int]bool),
+	}
+}
+
+func (a *Aggregator) ObserveHTTP(stat load.HTTPStats) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.requests++
+
+	if stat.ErrorType != "" {
+		a.failed++
+		a.errors[stat.ErrorType]++
+		return
+	}
+
+	if stat.StatusCode < 200 || stat.StatusCode >= 300 {
+		a.failed++
+		a.errors[fmt.Sprintf("http_%d", stat.StatusCode)]++
+		return
+	}
+
+	a.totalLatency += float64(stat.Latency.Milliseconds())
+	a.latency.RecordValue(stat.Latency.Milliseconds())
+}
+
+func (a *Aggregator) ObserveDocker(stat docker.DockerStats) {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	for i, s := range a.sinks {
+		a.report(i, s.WriteDocker(a.run, stat))
+	}
+}
+
+// Run flushes an interval every second until ctx is done, then flushes whatever remains
+func (a *Aggregator) Run(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	last := time.Now()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			a.flush(now, now.Sub(last))
+			last = now
+		case <-ctx.Done():
+			now := time.Now()
+			a.flush(now, now.Sub(last))
+			return
+		}
+	}
+}
+
+func (a *Aggregator) flush(now time.Time, elapsed time.Duration) {
+	// The final flush usually covers a sliver of a second, which would otherwise show a wildly inflated rate
+	if elapsed < time.Second {
+		elapsed = time.Second
+	}
+
+	a.mu.Lock()
+
+	interval := Interval{
+		Timestamp: now,
+		Requests:  a.requests,
+		Failed:    a.failed,
+		RPS:       float64(a.requests) / elapsed.Seconds(),
+		Errors:    a.errors,
+	}
+
+	if successful := a.requests - a.failed; successful > 0 {
+		interval.LatencyMean = a.totalLatency / float64(successful)
+		interval.LatencyP50 = a.latency.ValueAtQuantile(50)
+		interval.LatencyP90 = a.latency.ValueAtQuantile(90)
+		interval.LatencyP99 = a.latency.ValueAtQuantile(99)
+	}
+
+	a.requests = 0
+	a.failed = 0
+	a.errors = make(map[string]int)
+	a.totalLatency = 0
+	a.latency.Reset()
+
+	a.mu.Unlock()
+
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	for i, s := range a.sinks {
+		a.report(i, s.WriteInterval(a.run, interval))
+	}
+}
+
+func (a *Aggregator) report(i int, err error) {
+	if err == nil || a.failing[i] {
+		return
+	}
+
+	a.failing[i] = true
+	fmt.Println("\nError writing to results sink, further errors will be ignored:", err)
+}
@@ -0,0 +1,133 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+)
+
+// influx writes InfluxDB line protocol to a file or an HTTP write endpoint
+type influx struct {
+	file   *os.File
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newInflux(target string) (*influx, error) {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return &influx{
+			url:    target,
+			token:  os.Getenv("INFLUX_TOKEN"),
+			client: &http.Client{Timeout: 5 * time.Second},
+		}, nil
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open influx sink file: %w", err)
+	}
+
+	return &influx{file: f}, nil
+}
+
+var (
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+)
+
+func (i *influx) tags(run Run, extra ...string) string {
+	var b strings.Builder
+
+	tags := map[string]string{"url": run.URL}
+	maps.Copy(tags, run.Tags)
+
+	for n := 0; n+1 < len(extra); n += 2 {
+		tags[extra[n]] = extra[n+1]
+	}
+
+	// Influx performs best with tags sorted by key
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		if tags[key] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ",%s=%s", tagEscaper.Replace(key), tagEscaper.Replace(tags[key]))
+	}
+
+	return b.String()
+}
+
+func (i *influx) WriteInterval(run Run, interval Interval) error {
+	var b bytes.Buffer
+	timestamp := interval.Timestamp.UnixNano()
+
+	fmt.Fprintf(&b, "%s%s requests=%di,failed=%di,rps=%s,latency_mean=%s,latency_p50=%di,latency_p90=%di,latency_p99=%di %d\n",
+		measurementEscaper.Replace("loadship_http"), i.tags(run),
+		interval.Requests, interval.Failed, formatFloat(interval.RPS), formatFloat(interval.LatencyMean),
+		interval.LatencyP50, interval.LatencyP90, interval.LatencyP99, timestamp)
+
+	for _, errorType := range slices.Sorted(maps.Keys(interval.Errors)) {
+		fmt.Fprintf(&b, "loadship_errors%s count=%di %d\n", i.tags(run, "error_type", errorType), interval.Errors[errorType], timestamp)
+	}
+
+	return i.write(b.Bytes())
+}
+
+func (i *influx) WriteDocker(run Run, stat docker.DockerStats) error {
+	line := fmt.Sprintf("loadship_docker%s memory_mb=%s,cpu_percent=%s,disk_read_mb=%s,disk_write_mb=%s,pids=%di,network_rx_bytes=%di,network_tx_bytes=%di %d\n",
+		i.tags(run, "container", stat.Container), formatFloat(stat.MemoryUsageMB), formatFloat(stat.CPUPercent),
+		formatFloat(stat.DiskReadMB), formatFloat(stat.DiskWriteMB), stat.PIDs,
+		stat.Network.RxBytes, stat.Network.TxBytes, stat.Timestamp.UnixNano())
+
+	return i.write([]byte(line))
+}
+
+func (i *influx) write(lines []byte) error {
+	if i.file != nil {
+		_, err := i.file.Write(lines)
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, i.url, bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influx write to %s failed with %s: %s", i.url, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+func (i *influx) Close() error {
+	if i.file != nil {
+		return i.file.Close()
+	}
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+)
+
+// Interval is the aggregate of every request that completed within one interval of a running test
+type Interval struct {
+	Timestamp time.Time
+	Requests  int
+	Failed    int
+	RPS       float64
+	// Errors counts failed requests by error type, or http_<status> for unsuccessful responses
+	Errors map[string]int
+	// Latency of successful requests in milliseconds
+	LatencyMean float64
+	LatencyP50  int64
+	LatencyP90  int64
+	LatencyP99  int64
+}
+
+// Sink receives results while a test is running
+type Sink interface {
+	// WriteInterval is called once per interval with the aggregated requests
+	WriteInterval(run Run, interval Interval) error
+	// WriteDocker is called with every docker sample, which should be tagged with its container
+	WriteDocker(run Run, stat docker.DockerStats) error
+	Close() error
+}
+
+// Run describes the test the results belong to, so sinks can tag them
+type Run struct {
+	URL  string
+	Tags map[string]string
+}
+
+// Kinds are the supported sink types
+var Kinds = []string{"influx", "statsd", "dogstatsd"}
+
+// Open creates a sink from a spec in the form <kind>=<target>:
+//
+//	influx=results.lp                                                    InfluxDB line protocol appended to a file
+//	influx=http://localhost:8086/api/v2/write?org=my-org&bucket=loadship  InfluxDB write endpoint, authenticated with $INFLUX_TOKEN
+//	statsd=localhost:8125                                                StatsD over UDP
+//	dogstatsd=localhost:8125                                             DogStatsD over UDP, with tags
+func Open(spec string) (Sink, error) {
+	kind, target, ok := strings.Cut(spec, "=")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("invalid sink %q: must be in <kind>=<target> format, e.g. statsd=localhost:8125", spec)
+	}
+
+	switch kind {
+	case "influx":
+		return newInflux(target)
+	case "statsd":
+		return newStatsD(target, false)
+	case "dogstatsd":
+		return newStatsD(target, true)
+	}
+
+	return nil, fmt.Errorf("invalid sink %q: kind must be one of %s", spec, strings.Join(Kinds, ", "))
+}
+
+// Validate checks a sink spec without opening it
+func Validate(spec string) error {
+	kind, target, ok := strings.Cut(spec, "=")
+	if !ok || target == "" {
+		return fmt.Errorf("invalid sink %q: must be in <kind>=<target> format, e.g. statsd=localhost:8125", spec)
+	}
+
+	for _, k := range Kinds {
+		if k == kind {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid sink %q: kind must be one of %s", spec, strings.Join(Kinds, ", "))
+}
+
+// OpenAll opens every spec, closing any already opened if one fails
+func OpenAll(specs []string) ([]Sink, error) {
+	var sinks []Sink
+
+	for _, spec := range specs {
+		s, err := Open(spec)
+		if err != nil {
+			CloseAll(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+
+	return sinks, nil
+}
+
+// CloseAll closes every sink, printing any errors
+func CloseAll(sinks []Sink) {
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			fmt.Println("Error closing results sink:", err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+)
+
+// maxPacketSize keeps datagrams under the typical MTU so they are not fragmented
+const maxPacketSize = 1432
+
+// statsd writes aggregates as StatsD metrics over UDP. DogStatsD additionally supports tags,
+// which plain StatsD has no way to express so they are dropped.
+type statsd struct {
+	conn net.Conn
+	dog  bool
+}
+
+func newStatsD(target string, dog bool) (*statsd, error) {
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd sink: %w", err)
+	}
+
+	return &statsd{conn: conn, dog: dog}, nil
+}
+
+var statsdNameEscaper = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", " ", "_")
+
+func (s *statsd) tags(run Run, extra ...string) string {
+	if !s.dog {
+		return ""
+	}
+
+	tags := map[string]string{"url": run.URL}
+	maps.Copy(tags, run.Tags)
+
+	for n := 0; n+1 < len(extra); n += 2 {
+		tags[extra[n]] = extra[n+1]
+	}
+
+	var parts []string
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		parts = append(parts, strings.NewReplacer(",", "_", "|", "_").Replace(key+":"+tags[key]))
+	}
+
+	return "|#" + strings.Join(parts, ",")
+}
+
+func (s *statsd) WriteInterval(run Run, interval Interval) error {
+	tags := s.tags(run)
+
+	lines := []string{
+		fmt.Sprintf("loadship.requests:%d|c%s", interval.Requests, tags),
+		fmt.Sprintf("loadship.requests.failed:%d|c%s", interval.Failed, tags),
+		fmt.Sprintf("loadship.rps:%s|g%s", formatFloat(interval.RPS), tags),
+	}
+
+	if interval.Requests > interval.Failed {
+		lines = append(lines,
+			fmt.Sprintf("loadship.latency.mean:%s|g%s", formatFloat(interval.LatencyMean), tags),
+			fmt.Sprintf("loadship.latency.p50:%d|g%s", interval.LatencyP50, tags),
+			fmt.Sprintf("loadship.latency.p90:%d|g%s", interval.LatencyP90, tags),
+			fmt.Sprintf("loadship.latency.p99:%d|g%s", interval.LatencyP99, tags),
+		)
+	}
+
+	for _, errorType := range slices.Sorted(maps.Keys(interval.Errors)) {
+		if s.dog {
+			lines = append(lines, fmt.Sprintf("loadship.errors:%d|c%s", interval.Errors[errorType], s.tags(run, "error_type", errorType)))
+		} else {
+			lines = append(lines, fmt.Sprintf("loadship.errors.%s:%d|c", statsdNameEscaper.Replace(errorType), interval.Errors[errorType]))
+		}
+	}
+
+	return s.send(lines)
+}
+
+func (s *statsd) WriteDocker(run Run, stat docker.DockerStats) error {
+	tags := s.tags(run, "container", stat.Container)
+
+	// Without tags each container needs its own metric names
+	prefix := "loadship.container."
+	if !s.dog {
+		prefix += statsdNameEscaper.Replace(strings.ReplaceAll(stat.Container, ".", "_")) + "."
+	}
+
+	return s.send([]string{
+		fmt.Sprintf("%smemory_mb:%s|g%s", prefix, formatFloat(stat.MemoryUsageMB), tags),
+		fmt.Sprintf("%scpu_percent:%s|g%s", prefix, formatFloat(stat.CPUPercent), tags),
+		fmt.Sprintf("%sdisk_read_mb:%s|g%s", prefix, formatFloat(stat.DiskReadMB), tags),
+		fmt.Sprintf("%sdisk_write_mb:%s|g%s", prefix, formatFloat(stat.DiskWriteMB), tags),
+		fmt.Sprintf("%spids:%d|g%s", prefix, stat.PIDs, tags),
+		fmt.Sprintf("%snetwork.rx_bytes:%d|g%s", prefix, stat.Network.RxBytes, tags),
+		fmt.Sprintf("%snetwork.tx_bytes:%d|g%s", prefix, stat.Network.TxBytes, tags),
+	})
+}
+
+// send batches lines into as few datagrams as possible
+func (s *statsd) send(lines []string) error {
+	var packet bytes.Buffer
+
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxPacketSize {
+			if _, err := s.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		_, err := s.conn.Write(packet.Bytes())
+		return err
+	}
+
+	return nil
+}
+
+func (s *statsd) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,357 @@
+package suite
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/docker"
+)
+
+// Stages of a suite hooks run at
+const (
+	BeforeSuite = "before_suite"
+	BeforeEach  = "before_each"
+	AfterEach   = "after_each"
+	AfterSuite  = "after_suite"
+)
+
+// What happens when a hook fails. Hooks before the suite or a run abort by default, hooks after them continue.
+const (
+	// OnFailureAbort stops the suite, after_each and after_suite hooks still run so the environment is cleaned up
+	OnFailureAbort = "abort"
+	// OnFailureSkipRun fails the run without load testing, only for before_each hooks
+	OnFailureSkipRun = "skip_run"
+	// OnFailureContinue reports the failure and carries on
+	OnFailureContinue = "continue"
+)
+
+// DefaultHookTimeout is how long a hook has to finish when it doesn't set a timeout
+const DefaultHookTimeout = time.Minute
+
+var failurePolicies = []string{OnFailureAbort, OnFailureSkipRun, OnFailureContinue}
+
+// Hooks prepare and clean up the environment around the suite and every run, so each run starts from a known state
+type Hooks struct {
+	BeforeSuite []Hook `yaml:"before_suite"`
+	BeforeEach  []Hook `yaml:"before_each"`
+	AfterEach   []Hook `yaml:"after_each"`
+	AfterSuite  []Hook `yaml:"after_suite"`
+}
+
+// Hook is a shell command, an HTTP request or a docker action. Exactly one of Run, HTTP and Docker is set.
+type Hook struct {
+	Name string
+	// Run is a shell command, run with sh -c (cmd /C on Windows)
+	Run    string
+	HTTP   *HTTPHook
+	Docker *DockerHook
+	// Timeout is how long the hook has to finish, DefaultHookTimeout when zero
+	Timeout time.Duration
+	// OnFailure is abort, skip_run or continue
+	OnFailure string `yaml:"on_failure"`
+}
+
+// HTTPHook is a request that has to succeed, e.g. to flush a cache or reset test data through an admin endpoint
+type HTTPHook struct {
+	// URL is an http(s) URL, or a path such as /admin/reset on the suite URL
+	URL string
+	// Method is GET by default
+	Method  string
+	Headers map[string]string
+	Body    string
+	// Status is the status code expected, any 2xx response when zero
+	Status int
+}
+
+// DockerHook restarts, starts or stops a container, or runs a command in it with exec
+type DockerHook struct {
+	Action string
+	// Container defaults to the suite's container
+	Container string
+	// Command is run by exec, e.g. [redis-cli, FLUSHALL]
+	Command []string
+}
+
+func (h Hooks) stages() map[string][]Hook {
+	return map[string][]Hook{
+		BeforeSuite: h.BeforeSuite,
+		BeforeEach:  h.BeforeEach,
+		AfterEach:   h.AfterEach,
+		AfterSuite:  h.AfterSuite,
+	}
+}
+
+func (c *Config) validateHooks() error {
+	for _, stage := range []string{BeforeSuite, BeforeEach, AfterEach, AfterSuite} {
+		for i, hook := range c.Hooks.stages()[stage] {
+			if err := c.validateHook(stage, hook); err != nil {
+				return fmt.Errorf("%s hook %d: %w", stage, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateHook(stage string, hook Hook) error {
+	actions := 0
+	for _, set := range []bool{hook.Run != "", hook.HTTP != nil, hook.Docker != nil} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return fmt.Errorf("must set exactly one of run, http and docker")
+	}
+
+	if hook.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	if hook.OnFailure != "" && !slices.Contains(failurePolicies, hook.OnFailure) {
+		return fmt.Errorf("unknown on_failure %q: must be one of %s", hook.OnFailure, strings.Join(failurePolicies, ", "))
+	}
+	if hook.OnFailure == OnFailureSkipRun && stage != BeforeEach {
+		return fmt.Errorf("on_failure skip_run is only supported by before_each hooks")
+	}
+
+	if hook.HTTP != nil {
+		if strings.HasPrefix(hook.HTTP.URL, "/") {
+			if c.Url == "" {
+				return fmt.Errorf("cannot use the path %s without a suite URL", hook.HTTP.URL)
+			}
+		} else if parsed, err := url.Parse(hook.HTTP.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("invalid URL %q: must be an http(s) URL or a path on the suite URL", hook.HTTP.URL)
+		}
+	}
+
+	if hook.Docker != nil {
+		if !slices.Contains(docker.Actions, hook.Docker.Action) {
+			return fmt.Errorf("unknown docker action %q: must be one of %s", hook.Docker.Action, strings.Join(docker.Actions, ", "))
+		}
+		if hook.Docker.Container == "" && c.Container == "" {
+			return fmt.Errorf("docker %s must name a container", hook.Docker.Action)
+		}
+		if hook.Docker.Action == docker.ActionExec && len(hook.Docker.Command) == 0 {
+			return fmt.Errorf("docker exec must have a command")
+		}
+	}
+
+	return nil
+}
+
+// policy is what happens when the hook fails at a stage
+func (h Hook) policy(stage string) string {
+	if h.OnFailure != "" {
+		return h.OnFailure
+	}
+	if stage == BeforeSuite || stage == BeforeEach {
+		return OnFailureAbort
+	}
+	return OnFailureContinue
+}
+
+// describe names the hook in the output, by its name or what it does
+func (h Hook) describe() string {
+	switch {
+	case h.Name != "":
+		return h.Name
+	case h.HTTP != nil:
+		return fmt.Sprintf("%s %s", cmp.Or(h.HTTP.Method, http.MethodGet), h.HTTP.URL)
+	case h.Docker != nil && h.Docker.Action == docker.ActionExec:
+		return fmt.Sprintf("docker exec %s %s", h.Docker.Container, strings.Join(h.Docker.Command, " "))
+	case h.Docker != nil:
+		return fmt.Sprintf("docker %s %s", h.Docker.Action, h.Docker.Container)
+	}
+	return h.Run
+}
+
+var envNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// hookRunner runs the hooks of a suite, saving the output of every hook to the hooks directory of the suite
+type hookRunner struct {
+	config Config
+	// dir is the suite directory
+	dir string
+}
+
+// hookFailure is a failed hook and what should happen because of it
+type hookFailure struct {
+	policy string
+	err    error
+}
+
+// run runs the hooks of a stage in order, for the 1-based run number or 0 for the suite stages. Failures whose policy
+// is continue are reported and the next hook runs, any other failure stops the stage and is returned.
+func (r *hookRunner) run(stage string, hooks []Hook, run int, target string, vars map[string]string) *hookFailure {
+	for i, hook := range hooks {
+		if hook.Docker != nil && hook.Docker.Container == "" {
+			withContainer := *hook.Docker
+			withContainer.Container = r.config.Container
+			hook.Docker = &withContainer
+		}
+
+		name := stage
+		if run > 0 {
+			name = fmt.Sprintf("%s_run_%d", stage, run)
+		}
+		name = fmt.Sprintf("%s_%d", name, i+1)
+		if hook.Name != "" {
+			name += "_" + safeName(hook.Name)
+		}
+		logFile := filepath.Join(r.dir, "hooks", name+".log")
+
+		fmt.Printf("Running %s hook: %s\n", stage, hook.describe())
+
+		err := r.runHook(stage, hook, run, target, vars, logFile)
+		if err == nil {
+			continue
+		}
+
+		err = fmt.Errorf("%s hook %q failed: %w (output in %s)", stage, hook.describe(), err, logFile)
+		policy := hook.policy(stage)
+		if policy == OnFailureContinue {
+			fmt.Println(err)
+			continue
+		}
+		return &hookFailure{policy: policy, err: err}
+	}
+	return nil
+}
+
+func (r *hookRunner) runHook(stage string, hook Hook, run int, target string, vars map[string]string, logFile string) error {
+	if err := os.MkdirAll(filepath.Dir(logFile), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(logFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fmt.Fprintf(f, "# %s: %s\n", stage, hook.describe())
+	start := time.Now()
+
+	switch {
+	case hook.HTTP != nil:
+		err = r.runHTTP(ctx, *hook.HTTP, f)
+	case hook.Docker != nil:
+		err = r.runDocker(ctx, *hook.Docker, f)
+	default:
+		err = r.runShell(ctx, hook.Run, stage, run, target, vars, f)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		fmt.Fprintf(f, "\n# failed after %s: %v\n", elapsed, err)
+		return err
+	}
+	fmt.Fprintf(f, "\n# finished in %s\n", elapsed)
+	return nil
+}
+
+// runShell runs the command with the suite's details in its environment, e.g. to seed data for the URL under test.
+// Matrix variables are passed as LOADSHIP_VAR_<NAME>.
+func (r *hookRunner) runShell(ctx context.Context, command, stage string, run int, target string, vars map[string]string, output io.Writer) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	cmd.Env = append(os.Environ(),
+		"LOADSHIP_SUITE="+r.config.Name,
+		"LOADSHIP_SUITE_DIR="+r.dir,
+		"LOADSHIP_STAGE="+stage,
+		fmt.Sprintf("LOADSHIP_RUN=%d", run),
+		"LOADSHIP_URL="+target,
+	)
+	for name, value := range vars {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("LOADSHIP_VAR_%s=%s", strings.ToUpper(envNameChars.ReplaceAllString(name, "_")), value))
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// Processes started by the command can keep its output open after it is killed
+	cmd.WaitDelay = time.Second
+
+	return cmd.Run()
+}
+
+func (r *hookRunner) runHTTP(ctx context.Context, hook HTTPHook, output io.Writer) error {
+	target := hook.URL
+	if strings.HasPrefix(target, "/") {
+		// Already validated
+		base, _ := url.Parse(r.config.Url)
+		path, _ := url.Parse(target)
+		target = base.ResolveReference(path).String()
+	}
+
+	var body io.Reader
+	if hook.Body != "" {
+		body = strings.NewReader(hook.Body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, cmp.Or(hook.Method, http.MethodGet), target, body)
+	if err != nil {
+		return err
+	}
+	for key, value := range hook.Headers {
+		request.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	fmt.Fprintf(output, "%s %s\n%s\n", request.Method, target, resp.Status)
+	io.Copy(output, io.LimitReader(resp.Body, 1024*1024))
+
+	if hook.Status != 0 && resp.StatusCode != hook.Status {
+		return fmt.Errorf("%s returned %s, expected %d", target, resp.Status, hook.Status)
+	}
+	if hook.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return nil
+}
+
+func (r *hookRunner) runDocker(ctx context.Context, hook DockerHook, output io.Writer) error {
+	if hook.Action != docker.ActionExec {
+		return docker.ContainerAction(ctx, r.config.Docker, hook.Container, hook.Action)
+	}
+
+	exitCode, err := docker.Exec(ctx, r.config.Docker, hook.Container, hook.Command, output)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%s exited with code %d", strings.Join(hook.Command, " "), exitCode)
+	}
+	return nil
+}
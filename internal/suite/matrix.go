@@ -0,0 +1,252 @@
+package suite
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Matrix keys that set the run's own settings, any other key is a variable of the run
+const (
+	matrixConnections = "connections"
+	matrixDuration    = "duration"
+	matrixImage       = "image"
+	matrixURL         = "url"
+	matrixRepeat      = "repeat"
+)
+
+// misspeltKeys are matrix keys that look like a run setting, mapped to the setting. They would otherwise silently
+// become variables, e.g. endpoint: [/a, /b] running every combination against the suite URL.
+var misspeltKeys = map[string]string{
+	"endpoint":   matrixURL,
+	"endpoints":  matrixURL,
+	"path":       matrixURL,
+	"target":     matrixURL,
+	"urls":       matrixURL,
+	"connection": matrixConnections,
+	"conns":      matrixConnections,
+	"durations":  matrixDuration,
+	"images":     matrixImage,
+	"repeats":    matrixRepeat,
+}
+
+// Matrix expands into a run for every combination of its values, e.g. connections: [10, 50, 100] and
+// payload: [small, large] into six runs. Connections, duration, image and url set those of the run, any other key is a
+// variable recorded as a tag of the run and passed to its hooks. Repeat repeats every combination.
+type Matrix struct {
+	// Keys are in the order they were written, the values of the last one change first
+	Keys   []string
+	Values map[string][]string
+	// Include adds combinations. Keys they leave out take the matrix's value when it has only one.
+	Include []map[string]string
+	// Exclude removes every combination matching all of the values of a rule
+	Exclude []map[string]string
+}
+
+func (m *Matrix) UnmarshalYAML(unmarshal func(any) error) error {
+	var raw yaml.MapSlice
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	m.Values = make(map[string][]string)
+	for _, item := range raw {
+		key := fmt.Sprint(item.Key)
+
+		switch key {
+		case "include", "exclude":
+			rules, ok := item.Value.([]any)
+			if !ok {
+				return fmt.Errorf("matrix %s must be a list of combinations", key)
+			}
+
+			for _, rule := range rules {
+				values, ok := rule.(map[string]any)
+				if !ok {
+					return fmt.Errorf("matrix %s must be a list of combinations", key)
+				}
+
+				combination := make(map[string]string)
+				for k, v := range values {
+					combination[k] = fmt.Sprint(v)
+				}
+
+				if key == "include" {
+					m.Include = append(m.Include, combination)
+				} else {
+					m.Exclude = append(m.Exclude, combination)
+				}
+			}
+		default:
+			m.Keys = append(m.Keys, key)
+
+			// A single value doesn't have to be written as a list
+			values, ok := item.Value.([]any)
+			if !ok {
+				values = []any{item.Value}
+			}
+			for _, v := range values {
+				m.Values[key] = append(m.Values[key], fmt.Sprint(v))
+			}
+		}
+	}
+
+	return nil
+}
+
+// Runs expands the matrix into its runs, in the order the combinations were written
+func (m Matrix) Runs() ([]Run, error) {
+	for _, key := range m.Keys {
+		if len(m.Values[key]) == 0 {
+			return nil, fmt.Errorf("matrix %s has no values", key)
+		}
+	}
+
+	combinations := []map[string]string{{}}
+	for _, key := range m.Keys {
+		var expanded []map[string]string
+		for _, combination := range combinations {
+			for _, value := range m.Values[key] {
+				next := maps.Clone(combination)
+				next[key] = value
+				expanded = append(expanded, next)
+			}
+		}
+		combinations = expanded
+	}
+
+	combinations = slices.DeleteFunc(combinations, func(combination map[string]string) bool {
+		return slices.ContainsFunc(m.Exclude, func(rule map[string]string) bool {
+			return matches(combination, rule)
+		})
+	})
+
+	for _, include := range m.Include {
+		combination := maps.Clone(include)
+		for _, key := range m.Keys {
+			if _, ok := combination[key]; !ok && len(m.Values[key]) == 1 {
+				combination[key] = m.Values[key][0]
+			}
+		}
+		combinations = append(combinations, combination)
+	}
+
+	var runs []Run
+	seen := make(map[string]bool)
+	for _, combination := range combinations {
+		// An include can repeat a combination the matrix already has, maps are printed with sorted keys
+		if key := fmt.Sprint(combination); seen[key] {
+			continue
+		} else {
+			seen[key] = true
+		}
+
+		run, err := m.run(combination)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// matches reports whether the combination has every value of the rule
+func matches(combination, rule map[string]string) bool {
+	for key, value := range rule {
+		if combination[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// run makes the run of a combination, named after its values, e.g. connections-50_payload-large
+func (m Matrix) run(combination map[string]string) (Run, error) {
+	// Keys only named by an include come after the matrix's own
+	keys := slices.DeleteFunc(slices.Sorted(maps.Keys(combination)), func(key string) bool {
+		return slices.Contains(m.Keys, key)
+	})
+	keys = append(slices.DeleteFunc(slices.Clone(m.Keys), func(key string) bool {
+		_, ok := combination[key]
+		return !ok
+	}), keys...)
+
+	// Only the values that differ between runs name them, unless every key has a single value
+	named := slices.DeleteFunc(slices.Clone(keys), func(key string) bool {
+		return len(m.Values[key]) == 1
+	})
+	if len(named) == 0 {
+		named = keys
+	}
+
+	var run Run
+	var name []string
+	for _, key := range keys {
+		value := combination[key]
+		if slices.Contains(named, key) {
+			name = append(name, safeName(fmt.Sprintf("%s-%s", key, value)))
+		}
+
+		switch key {
+		case matrixConnections:
+			connections, err := strconv.Atoi(value)
+			if err != nil {
+				return Run{}, fmt.Errorf("invalid matrix connections %q: must be a number", value)
+			}
+			run.Connections = connections
+		case matrixDuration:
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return Run{}, fmt.Errorf("invalid matrix duration %q: %w", value, err)
+			}
+			run.Duration = duration
+		case matrixImage:
+			run.Image = value
+		case matrixURL:
+			run.URL = value
+		case matrixRepeat:
+			repeat, err := strconv.Atoi(value)
+			if err != nil {
+				return Run{}, fmt.Errorf("invalid matrix repeat %q: must be a number", value)
+			}
+			run.Repeat = repeat
+		default:
+			if setting, ok := misspeltKeys[key]; ok {
+				return Run{}, fmt.Errorf("matrix key %s is not a run setting, use %s to set the run's %s", key, setting, setting)
+			}
+			if run.Vars == nil {
+				run.Vars = make(map[string]string)
+			}
+			run.Vars[key] = value
+		}
+	}
+	run.Name = strings.Join(name, "_")
+
+	// Suites have no run defaults, so the run would otherwise only fail validation as run N
+	for _, key := range []string{matrixConnections, matrixDuration} {
+		if _, ok := combination[key]; !ok {
+			return Run{}, fmt.Errorf("matrix run %s has no %s: set %s in the matrix, or in the include that adds the run", run.Name, key, key)
+		}
+	}
+
+	return run, nil
+}
+
+var (
+	unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+	repeatedDashes  = regexp.MustCompile(`-{2,}`)
+)
+
+// safeName makes a name safe to use in a filename, e.g. url-/api/users becomes url-api-users and url-/ becomes url
+func safeName(name string) string {
+	name = unsafeNameChars.ReplaceAllString(name, "-")
+	name = repeatedDashes.ReplaceAllString(name, "-")
+	return strings.Trim(name, "-")
+}
@@ -0,0 +1,24 @@
+package suite
+
+import "testing"
+
+func TestMatrixRejectsMisspeltKeys(t *testing.T) {
+	matrix := Matrix{
+		Keys:   []string{"connections", "duration", "endpoint"},
+		Values: map[string][]string{"connections": {"10"}, "duration": {"10s"}, "endpoint": {"/a", "/b"}},
+	}
+
+	if _, err := matrix.Runs(); err == nil {
+		t.Error("Runs() error = nil, want endpoint rejected in favour of url")
+	}
+
+	matrix.Keys[2] = "url"
+	matrix.Values["url"] = matrix.Values["endpoint"]
+	runs, err := matrix.Runs()
+	if err != nil {
+		t.Fatalf("Runs() error = %v", err)
+	}
+	if len(runs) != 2 || runs[0].URL != "/a" || runs[1].URL != "/b" {
+		t.Errorf("Runs() = %+v, want a run for each url", runs)
+	}
+}
@@ -2,29 +2,125 @@ package suite
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/fireproofpenguin/loadship/internal/abort"
+	"github.com/fireproofpenguin/loadship/internal/baseline"
+	"github.com/fireproofpenguin/loadship/internal/capacity"
 	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/comparison"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/metrics"
+	"github.com/fireproofpenguin/loadship/internal/notify"
 	"github.com/fireproofpenguin/loadship/internal/orchestrator"
+	"github.com/fireproofpenguin/loadship/internal/process"
+	"github.com/fireproofpenguin/loadship/internal/profile"
 	"github.com/fireproofpenguin/loadship/internal/report"
-	"github.com/schollz/progressbar/v3"
+	"github.com/fireproofpenguin/loadship/internal/scrape"
+	"github.com/fireproofpenguin/loadship/internal/sink"
+	"github.com/fireproofpenguin/loadship/internal/telemetry"
+)
+
+// What a suite does once a run is aborted by its abort conditions
+const (
+	OnAbortContinue      = "continue"
+	OnAbortSkipRemaining = "skip_remaining"
 )
 
 type Run struct {
+	// Name labels the run in the output and names its result file, generated from the values of matrix runs
+	Name        string
 	Duration    time.Duration
 	Connections int
+	// Image replaces the managed container's image for this run, e.g. to compare two releases in one suite
+	Image string
+	// URL replaces the suite URL for this run, or is a path such as /api/orders on it
+	URL string
+	// Vars are matrix values that aren't settings of the run, recorded as its tags and passed to its hooks
+	Vars map[string]string
+	// Repeat runs the same config this many times, each saved with its number appended, along with an aggregate of
+	// them all
+	Repeat int
+
+	// aggregate names the aggregate a repeated run is part of, set once repeats are expanded
+	aggregate string
 }
 
 type Config struct {
 	Name      string
 	Url       string
 	Container string
-	Cooldown  time.Duration
-	Report    bool
-	Runs      []Run
+	// Containers, ComposeProject and Labels select more containers to monitor alongside Container
+	Containers     []string
+	ComposeProject string `yaml:"compose_project"`
+	Labels         map[string]string
+	// Processes are host processes or cgroups monitored without docker, each with one of pid, name or cgroup
+	Processes []process.Target
+	// Managed starts the target from an image for every run, so each run gets a fresh container
+	Managed *docker.ContainerSpec
+	// Docker is the daemon containers are monitored through, e.g. a remote host or podman's socket
+	Docker docker.Connection
+	// SampleInterval is how often containers and processes are sampled, every second by default
+	SampleInterval time.Duration `yaml:"sample_interval"`
+	// Logs saves the monitored containers' stdout and stderr during each run next to its results. LogPatterns are
+	// regular expressions whose matching lines are counted, e.g. ERROR, and imply Logs.
+	Logs        bool
+	LogPatterns []string `yaml:"log_patterns"`
+	// Scrape records series from the target's Prometheus metrics endpoints during each run
+	Scrape *scrape.Config
+	// Profile captures pprof profiles from the target during each run, saved next to its results
+	Profile *profile.Config
+	// Abort stops a run early once the target has fallen over, its partial results are still saved. OnAbort is
+	// continue to carry on with the next run, or skip_remaining to skip the rest of the suite.
+	Abort   *abort.Config
+	OnAbort string `yaml:"on_abort"`
+	// Hooks run shell commands, HTTP requests or docker actions before and after the suite and every run
+	Hooks    Hooks
+	Cooldown time.Duration
+	Report   bool
+	// Format is the result file extension used for each run, e.g. json, json.gz or ndjson.zst
+	Format string
+	Tags   map[string]string
+	// TUI shows a live dashboard during each run instead of a progress bar
+	TUI bool
+	// MetricsAddr serves live metrics for Prometheus on this address for the whole suite
+	MetricsAddr string `yaml:"metrics_addr"`
+	// Otel exports metrics, and optionally request spans, over OTLP when set
+	Otel *telemetry.Config
+	// Sinks stream per-second aggregates and docker samples during each run, e.g. influx=results.lp or statsd=localhost:8125
+	Sinks []string
+	// Webhooks are POSTed a summary of every run when the suite finishes, e.g. slack=https://hooks.slack.com/...
+	Webhooks []string
+	// Baseline each run is compared against, e.g. latest:env=staging. Matching results are searched for in ResultsDir.
+	Baseline   string
+	ResultsDir string `yaml:"results_dir"`
+	Runs       []Run
+	// Matrix adds a run for every combination of its values after Runs, it is expanded when the config is validated
+	Matrix *Matrix
+	// Capacity searches for the highest load the target sustains within an SLO once the runs are done
+	Capacity *capacity.Search
+}
+
+// expandMatrix appends the runs of the matrix to Runs
+func (c *Config) expandMatrix() error {
+	if c.Matrix == nil {
+		return nil
+	}
+
+	runs, err := c.Matrix.Runs()
+	if err != nil {
+		return fmt.Errorf("invalid matrix: %w", err)
+	}
+
+	c.Runs = append(c.Runs, runs...)
+	c.Matrix = nil
+	return nil
 }
 
 // validates the suite config
@@ -32,15 +128,95 @@ func (c *Config) Validate() error {
 	if c.Name == "" {
 		return fmt.Errorf("suite name cannot be empty")
 	}
-	if strings.TrimSpace(c.Url) == "" {
+	if strings.TrimSpace(c.Url) == "" && (c.Managed == nil || c.Managed.Port == "") {
 		return fmt.Errorf("suite URL cannot be empty")
 	}
+	if c.Managed != nil {
+		if err := c.Managed.Validate(); err != nil {
+			return err
+		}
+	}
 	if c.Cooldown < 0 {
 		return fmt.Errorf("cooldown duration cannot be negative")
 	}
-	if len(c.Runs) == 0 {
-		return fmt.Errorf("suite must have at least one run defined")
+	if c.Matrix != nil {
+		if err := c.expandMatrix(); err != nil {
+			return err
+		}
+	}
+	if len(c.Runs) == 0 && c.Capacity == nil {
+		return fmt.Errorf("suite must have at least one run or a capacity search defined")
+	}
+	if c.Capacity != nil {
+		if err := c.Capacity.Validate(); err != nil {
+			return err
+		}
 	}
+	for i, run := range c.Runs {
+		if run.Repeat < 0 {
+			return fmt.Errorf("run %d has invalid repeat: cannot be negative", i+1)
+		}
+	}
+	c.expandRepeats()
+	if c.Otel != nil {
+		if err := c.Otel.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.SampleInterval != 0 && c.SampleInterval < docker.MinSampleInterval {
+		return fmt.Errorf("sample interval must be at least %s", docker.MinSampleInterval)
+	}
+	if _, err := collector.CompileLogPatterns(c.LogPatterns); err != nil {
+		return err
+	}
+	if c.Scrape != nil {
+		if err := c.Scrape.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Profile != nil {
+		if err := c.Profile.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Abort != nil {
+		if err := c.Abort.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.OnAbort != "" && c.OnAbort != OnAbortContinue && c.OnAbort != OnAbortSkipRemaining {
+		return fmt.Errorf("unknown on_abort %q: must be %s or %s", c.OnAbort, OnAbortContinue, OnAbortSkipRemaining)
+	}
+	if err := c.validateHooks(); err != nil {
+		return err
+	}
+	for _, target := range c.Processes {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, spec := range c.Sinks {
+		if err := sink.Validate(spec); err != nil {
+			return err
+		}
+	}
+	if _, err := notify.ParseWebhooks(c.Webhooks); err != nil {
+		return err
+	}
+	if c.Baseline != "" {
+		if _, err := baseline.ParseSelector(c.Baseline); err != nil {
+			return fmt.Errorf("invalid baseline: %w", err)
+		}
+	}
+	if c.Format != "" && !collector.IsResultFile("."+c.Format) {
+		return fmt.Errorf("unsupported format %q: must be one of %s", c.Format, strings.Join(collector.ResultExtensions, ", "))
+	}
+	for key := range c.Tags {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("tag names cannot be empty")
+		}
+	}
+	names := make(map[string]bool)
 	for i, run := range c.Runs {
 		if run.Connections <= 0 {
 			return fmt.Errorf("run %d has invalid connections: must be greater than 0", i+1)
@@ -48,95 +224,401 @@ func (c *Config) Validate() error {
 		if run.Duration <= 0 {
 			return fmt.Errorf("run %d has invalid duration: must be greater than 0", i+1)
 		}
+		if run.Image != "" && c.Managed == nil {
+			return fmt.Errorf("run %d sets an image without a managed container", i+1)
+		}
+		if strings.HasPrefix(run.URL, "/") {
+			if strings.TrimSpace(c.Url) == "" && (c.Managed == nil || c.Managed.Port == "") {
+				return fmt.Errorf("run %d sets the path %s without a suite URL", i+1, run.URL)
+			}
+		} else if run.URL != "" {
+			if parsed, err := url.Parse(run.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				return fmt.Errorf("run %d has invalid URL %q: must be an http(s) URL or a path on the suite URL", i+1, run.URL)
+			}
+		}
+		if run.Name != "" {
+			if names[safeName(run.Name)] {
+				return fmt.Errorf("run %d has the same name as another run: %s", i+1, run.Name)
+			}
+			names[safeName(run.Name)] = true
+		}
 	}
 	return nil
 }
 
-func Start(config Config) error {
+// expandRepeats replaces every repeated run with a run per repeat, numbered after the repeated run's name
+func (c *Config) expandRepeats() {
+	var runs []Run
+	for i, run := range c.Runs {
+		if run.Repeat <= 1 {
+			runs = append(runs, run)
+			continue
+		}
+
+		name := run.Name
+		if name == "" {
+			name = fmt.Sprintf("run_%d_%dc_%.0fs", i+1, run.Connections, run.Duration.Seconds())
+		}
+
+		for repeat := range run.Repeat {
+			repeated := run
+			repeated.Name = fmt.Sprintf("%s_%d", safeName(name), repeat+1)
+			repeated.Repeat = 0
+			repeated.aggregate = safeName(name)
+			runs = append(runs, repeated)
+		}
+	}
+	c.Runs = runs
+}
+
+// resolveURL resolves the URL of a run against the suite URL. A path is returned as is without a suite URL, and
+// resolved against the managed container once it is started.
+func resolveURL(base, target string) string {
+	if target == "" {
+		return base
+	}
+	if !strings.HasPrefix(target, "/") {
+		return target
+	}
+	if base == "" {
+		return target
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	path, _ := url.Parse(target)
+	return baseURL.ResolveReference(path).String()
+}
+
+func Start(ctx context.Context, config Config) (suiteErr error) {
 	fmt.Println("Running test suite from config", config.Name)
 
 	totalRuns := len(config.Runs)
 	var failedRuns int
 	var lastErr error
 
+	format := "json"
+	if config.Format != "" {
+		format = strings.TrimPrefix(config.Format, ".")
+	}
+
 	directory := fmt.Sprintf("suite_%s_%s", config.Name, time.Now().Format("20060102_150405"))
 
 	if err := os.MkdirAll(directory, 0o755); err != nil {
 		return fmt.Errorf("error creating suite directory: %w", err)
 	}
 
+	// before_suite hooks run before the containers are resolved, so they can start them. after_suite hooks run
+	// however the suite ends.
+	hooks := &hookRunner{config: config, dir: directory}
+	defer func() {
+		failure := hooks.run(AfterSuite, config.Hooks.AfterSuite, 0, config.Url, nil)
+		if failure == nil {
+			return
+		}
+		if suiteErr != nil {
+			fmt.Println(failure.err)
+			return
+		}
+		suiteErr = failure.err
+	}()
+
+	if failure := hooks.run(BeforeSuite, config.Hooks.BeforeSuite, 0, config.Url, nil); failure != nil {
+		return failure.err
+	}
+
+	selector := docker.Selector{
+		Names:          config.Containers,
+		ComposeProject: config.ComposeProject,
+		Labels:         config.Labels,
+	}
+	if config.Container != "" {
+		selector.Names = append([]string{config.Container}, selector.Names...)
+	}
+
+	containers, err := docker.ResolveContainers(context.Background(), config.Docker, selector)
+	if err != nil {
+		return fmt.Errorf("error finding containers to monitor: %w", err)
+	}
+
+	var exporter *metrics.Exporter
+	if config.MetricsAddr != "" {
+		exporter = metrics.New()
+
+		if err := exporter.Serve(config.MetricsAddr); err != nil {
+			return fmt.Errorf("error starting metrics endpoint: %w", err)
+		}
+		defer exporter.Shutdown(context.Background())
+	}
+
+	var otel *telemetry.Telemetry
+	if config.Otel != nil {
+		var err error
+		otel, err = telemetry.New(context.Background(), *config.Otel)
+
+		if err != nil {
+			return fmt.Errorf("error setting up OpenTelemetry export: %w", err)
+		}
+
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := otel.Shutdown(ctx); err != nil {
+				fmt.Println("Error flushing OpenTelemetry data:", err)
+			}
+		}()
+	}
+
+	sinks, err := sink.OpenAll(config.Sinks)
+	if err != nil {
+		return fmt.Errorf("error opening results sink: %w", err)
+	}
+	defer sink.CloseAll(sinks)
+
+	// Already validated by Validate
+	webhooks, _ := notify.ParseWebhooks(config.Webhooks)
+
+	resultsDir := "."
+	if config.ResultsDir != "" {
+		resultsDir = config.ResultsDir
+	}
+
+	captureLogs := config.Logs || len(config.LogPatterns) > 0
+
+	var results []notify.RunResult
+	// written excludes results from this suite when resolving baselines
+	var written []string
+
+	// repeated holds the summaries of the runs of each aggregate, in the order the aggregates first ran
+	type repeatedRuns struct {
+		files   []string
+		outputs []*collector.JSONOutput
+	}
+	repeated := make(map[string]*repeatedRuns)
+	var aggregates []string
+
+	// aborted is the hook failure, interrupt, or with on_abort skip_remaining the aborted run, that stopped the suite
+	// early
+	var aborted error
+	// after_each hooks of a run are run before the next one starts, or once the loop is over, so they run however
+	// the run ended
+	var pendingAfterEach int
+	// pendingURL is the URL the pending run tested, which is only known once its managed container is started
+	var pendingURL string
+	afterEach := func(run int) *hookFailure {
+		return hooks.run(AfterEach, config.Hooks.AfterEach, run, pendingURL, config.Runs[run-1].Vars)
+	}
+
 	for currentRun, run := range config.Runs {
-		fmt.Printf("Run (%d/%d): %d connections for %s\n", currentRun+1, totalRuns, run.Connections, run.Duration.String())
+		if pendingAfterEach > 0 {
+			failure := afterEach(pendingAfterEach)
+			pendingAfterEach = 0
+
+			if failure != nil {
+				aborted = failure.err
+				break
+			}
+
+			orchestrator.Cooldown(ctx, config.Cooldown)
+		}
+
+		// Interrupted between runs, e.g. with Ctrl+C during the cooldown
+		if ctx.Err() != nil {
+			aborted = orchestrator.ErrInterrupted
+			break
+		}
 
-		testConfig := collector.TestConfig{
-			URL:           config.Url,
-			Timestamp:     time.Now(),
-			Duration:      run.Duration,
-			Connections:   run.Connections,
-			ContainerName: config.Container,
+		if run.Name != "" {
+			fmt.Printf("Run (%d/%d) %s: %d connections for %s\n", currentRun+1, totalRuns, run.Name, run.Connections, run.Duration.String())
+		} else {
+			fmt.Printf("Run (%d/%d): %d connections for %s\n", currentRun+1, totalRuns, run.Connections, run.Duration.String())
 		}
 
-		httpStats, dockerStats, err := orchestrator.Orchestrate(testConfig)
+		url := resolveURL(config.Url, run.URL)
+
+		tags := config.Tags
+		if len(run.Vars) > 0 {
+			tags = maps.Clone(config.Tags)
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			maps.Copy(tags, run.Vars)
+		}
+
+		pendingAfterEach = currentRun + 1
+		pendingURL = url
+		if failure := hooks.run(BeforeEach, config.Hooks.BeforeEach, currentRun+1, url, run.Vars); failure != nil {
+			fmt.Printf("Run %d failed: %v\n", currentRun+1, failure.err)
+			failedRuns++
+			lastErr = failure.err
+			results = append(results, notify.RunResult{Config: collector.TestConfig{URL: url, Duration: run.Duration, Connections: run.Connections, Image: run.Image, Tags: tags}, Error: failure.err.Error()})
+
+			if failure.policy == OnFailureAbort {
+				aborted = failure.err
+				break
+			}
+			continue
+		}
+
+		filename := fmt.Sprintf("%s/run_%d_%dc_%.0fs.%s", directory, currentRun+1, run.Connections, run.Duration.Seconds(), format)
+		if run.Name != "" {
+			filename = fmt.Sprintf("%s/%s.%s", directory, safeName(run.Name), format)
+		}
+
+		test := orchestrator.Test{
+			Config: collector.TestConfig{
+				URL:            url,
+				Duration:       run.Duration,
+				Connections:    run.Connections,
+				Containers:     containers,
+				Processes:      config.Processes,
+				SampleInterval: config.SampleInterval,
+				Logs:           captureLogs,
+				LogPatterns:    config.LogPatterns,
+				Abort:          config.Abort,
+				Tags:           tags,
+			},
+			ResultFile: filename,
+			Scrape:     config.Scrape,
+			Profile:    config.Profile,
+			Exporter:   exporter,
+			Run:        currentRun + 1,
+			Telemetry:  otel,
+			Sinks:      sinks,
+			Options:    orchestrator.Options{TUI: config.TUI, Docker: config.Docker},
+		}
+
+		// Every run gets a fresh container, removed once the run is over
+		if config.Managed != nil {
+			spec := *config.Managed
+			if run.Image != "" {
+				spec.Image = run.Image
+			}
+			test.Managed = &spec
+		}
+
+		testConfig, output, err := orchestrator.RunTest(ctx, test)
+		pendingURL = testConfig.URL
 
 		if err != nil {
 			fmt.Printf("Run %d failed: %v\n", currentRun+1, err)
 			failedRuns++
 			lastErr = err
+			results = append(results, notify.RunResult{Config: testConfig, Error: err.Error()})
+
+			if errors.Is(err, orchestrator.ErrInterrupted) {
+				aborted = err
+				break
+			}
 			continue
 		}
 
-		metrics := collector.Calculate(httpStats, dockerStats, run.Duration)
-		metricsOutput := collector.ToJSONOutput(httpStats, dockerStats, testConfig, *metrics)
-		filename := fmt.Sprintf("%s/run_%d_%dc_%.0fs.json", directory, currentRun+1, run.Connections, run.Duration.Seconds())
-		err = metricsOutput.SaveToFile(filename)
+		result := notify.RunResult{Config: testConfig, Metrics: &output.Summary, Aborted: output.Abort, ResultFile: filename}
+		written = append(written, filename)
 
-		if err != nil {
-			fmt.Println("Error saving JSON file:", err)
+		// An aborted run's partial results would drag down the statistics of the runs that completed
+		if run.aggregate != "" && output.Abort == nil {
+			if repeated[run.aggregate] == nil {
+				repeated[run.aggregate] = &repeatedRuns{}
+				aggregates = append(aggregates, run.aggregate)
+			}
+			// Aggregates only need the summary, so the samples of every run aren't held on to until the end
+			r := repeated[run.aggregate]
+			r.files = append(r.files, filename)
+			r.outputs = append(r.outputs, &collector.JSONOutput{Metadata: output.Metadata, Summary: output.Summary})
+		}
+
+		if config.Report {
+			reportName := collector.TrimResultExt(filename)
+
+			result.ReportFile = report.Write(output, reportName)
+		}
+
+		if config.Baseline != "" {
+			result.Comparison = notify.CompareToBaseline(config.Baseline, resultsDir, output, written...)
+		}
+
+		results = append(results, result)
+
+		if output.Abort != nil {
+			err := fmt.Errorf("run %d %s", currentRun+1, output.Abort)
+			fmt.Printf("Run %d %s\n", currentRun+1, output.Abort)
 			failedRuns++
 			lastErr = err
+
+			if config.OnAbort == OnAbortSkipRemaining {
+				aborted = err
+				break
+			}
 		}
+	}
 
-		if config.Report {
-			reportName := strings.TrimSuffix(filename, ".json")
+	if pendingAfterEach > 0 {
+		if failure := afterEach(pendingAfterEach); failure != nil && aborted == nil {
+			aborted = failure.err
+		}
+	}
 
-			report.Write(&metricsOutput, reportName)
+	for _, name := range aggregates {
+		r := repeated[name]
+		if len(r.outputs) < 2 {
+			fmt.Printf("Only %d run of %s succeeded, not enough for an aggregate\n", len(r.outputs), name)
+			continue
 		}
 
-		if currentRun < totalRuns-1 {
-			cooldown(config.Cooldown)
+		aggregate := comparison.NewAggregate(r.files, r.outputs)
+		aggregateFile := fmt.Sprintf("%s/%s%s", directory, name, collector.AggregateExt)
+		fmt.Printf("\n%s:", name)
+		aggregate.Print()
+
+		if err := aggregate.SaveToFile(aggregateFile); err != nil {
+			fmt.Println("Error saving aggregate:", err)
+			continue
 		}
+		fmt.Printf("✓ Aggregate of %d runs saved to %s\n", len(r.outputs), aggregateFile)
+	}
+
+	var capacityErr error
+	if config.Capacity != nil && aborted == nil {
+		fmt.Println("\nSearching for capacity")
+
+		var result *capacity.Result
+		result, capacityErr = capacity.Start(ctx, capacity.Config{
+			Search:         *config.Capacity,
+			URL:            config.Url,
+			Managed:        config.Managed,
+			Containers:     containers,
+			Processes:      config.Processes,
+			Docker:         config.Docker,
+			SampleInterval: config.SampleInterval,
+			Tags:           config.Tags,
+			TUI:            config.TUI,
+			Report:         config.Report,
+			Directory:      fmt.Sprintf("%s/capacity", directory),
+		})
+
+		if capacityErr == nil {
+			result.Print()
+		}
+	}
+
+	notify.Send(webhooks, notify.NewSuiteEvent(config.Name, results))
+
+	if aborted != nil {
+		return fmt.Errorf("suite aborted after %d/%d runs: %w", len(results), totalRuns, aborted)
 	}
 
 	if failedRuns > 0 {
 		return fmt.Errorf("%d/%d runs failed; last error: %w", failedRuns, totalRuns, lastErr)
 	}
 
+	if capacityErr != nil {
+		return fmt.Errorf("capacity search failed: %w", capacityErr)
+	}
+
 	fmt.Printf("Test suite complete. Results saved to %s/\n", directory)
 	return nil
 }
-
-func cooldown(duration time.Duration) {
-	ctx, cancel := context.WithTimeout(context.Background(), duration)
-	defer cancel()
-
-	bar := progressbar.NewOptions(int(duration.Seconds()),
-		progressbar.OptionSetDescription("Cooldown..."),
-		progressbar.OptionSetWidth(40),
-		progressbar.OptionShowElapsedTimeOnFinish(),
-		progressbar.OptionSetPredictTime(false),
-		progressbar.OptionClearOnFinish(),
-	)
-
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			bar.Add(1)
-		case <-ctx.Done():
-			bar.Finish()
-			return
-		}
-	}
-}
@@ -0,0 +1,26 @@
+package suite
+
+import "testing"
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		target string
+		want   string
+	}{
+		{name: "suite URL", base: "http://localhost:8080/", target: "", want: "http://localhost:8080/"},
+		{name: "path on the suite URL", base: "http://localhost:8080/", target: "/health", want: "http://localhost:8080/health"},
+		{name: "URL", base: "http://localhost:8080/", target: "http://localhost:9090/", want: "http://localhost:9090/"},
+		// The path is resolved against the managed container once it is started
+		{name: "path without a suite URL", base: "", target: "/health", want: "/health"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := resolveURL(test.base, test.target); got != test.want {
+				t.Errorf("resolveURL(%q, %q) = %q, want %q", test.base, test.target, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scope = "github.com/fireproofpenguin/loadship"
+
+// Config controls exporting metrics and traces over OTLP
+type Config struct {
+	// Endpoint is the host:port of the OTLP collector. The standard OTEL_EXPORTER_OTLP_* environment variables are used when empty.
+	Endpoint string
+	// Protocol is either grpc or http
+	Protocol string
+	// Insecure disables TLS when connecting to the collector
+	Insecure bool
+	// Traces emits a client span for every request and propagates its context to the target with a traceparent header
+	Traces bool
+}
+
+func (c Config) Validate() error {
+	switch c.Protocol {
+	case "", "grpc", "http":
+		return nil
+	}
+	return fmt.Errorf("unsupported OTLP protocol %q: must be grpc or http", c.Protocol)
+}
+
+// Telemetry pushes per-request metrics, docker samples and optionally request spans to an OTLP collector
+type Telemetry struct {
+	meterProvider  *sdkmetric.MeterProvider
+	tracerProvider *sdktrace.TracerProvider
+	tracer         trace.Tracer
+	propagator     propagation.TextMapPropagator
+
+	attributes []attribute.KeyValue
+
+	requests    metric.Int64Counter
+	duration    metric.Float64Histogram
+	inFlight    metric.Int64UpDownCounter
+	memory      metric.Float64Gauge
+	cpu         metric.Float64Gauge
+	pids        metric.Int64Gauge
+	connections metric.Int64Gauge
+}
+
+// New creates the OTLP exporters. Shutdown must be called to flush anything still buffered.
+func New(ctx context.Context, config Config) (*Telemetry, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName("loadship"),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	metricExporter, err := newMetricExporter(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+	}
+
+	t := &Telemetry{
+		meterProvider: sdkmetric.NewMeterProvider(
+			sdkmetric.WithResource(res),
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(5*time.Second))),
+		),
+		propagator: propagation.TraceContext{},
+	}
+
+	if config.Traces {
+		traceExporter, err := newTraceExporter(ctx, config)
+		if err != nil {
+			t.meterProvider.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+
+		t.tracerProvider = sdktrace.NewTracerProvider(
+			sdktrace.WithResource(res),
+			sdktrace.WithBatcher(traceExporter),
+		)
+		t.tracer = t.tracerProvider.Tracer(scope)
+	}
+
+	meter := t.meterProvider.Meter(scope)
+
+	t.requests, err = meter.Int64Counter("loadship.requests",
+		metric.WithDescription("Requests made by status code and error type"),
+		metric.WithUnit("{request}"))
+	if err == nil {
+		t.duration, err = meter.Float64Histogram("loadship.request.duration",
+			metric.WithDescription("Latency of requests that received a response"),
+			metric.WithUnit("s"),
+			metric.WithExplicitBucketBoundaries(.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30))
+	}
+	if err == nil {
+		t.inFlight, err = meter.Int64UpDownCounter("loadship.requests.in_flight",
+			metric.WithDescription("Requests currently waiting for a response"),
+			metric.WithUnit("{request}"))
+	}
+	if err == nil {
+		t.connections, err = meter.Int64Gauge("loadship.target.connections",
+			metric.WithDescription("Number of concurrent connections the current run is configured with"),
+			metric.WithUnit("{connection}"))
+	}
+	if err == nil {
+		t.memory, err = meter.Float64Gauge("loadship.container.memory.usage",
+			metric.WithDescription("Working set memory of the monitored container"),
+			metric.WithUnit("By"))
+	}
+	if err == nil {
+		t.cpu, err = meter.Float64Gauge("loadship.container.cpu.percent",
+			metric.WithDescription("CPU usage of the monitored container, where 100 is one full core"),
+			metric.WithUnit("%"))
+	}
+	if err == nil {
+		t.pids, err = meter.Int64Gauge("loadship.container.pids",
+			metric.WithDescription("Number of processes in the monitored container"),
+			metric.WithUnit("{process}"))
+	}
+
+	if err != nil {
+		t.Shutdown(ctx)
+		return nil, fmt.Errorf("failed to create instruments: %w", err)
+	}
+
+	return t, nil
+}
+
+func newMetricExporter(ctx context.Context, config Config) (sdkmetric.Exporter, error) {
+	if config.Protocol == "http" {
+		var options []otlpmetrichttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlpmetrichttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlpmetrichttp.WithInsecure())
+		}
+		return otlpmetrichttp.New(ctx, options...)
+	}
+
+	var options []otlpmetricgrpc.Option
+	if config.Endpoint != "" {
+		options = append(options, otlpmetricgrpc.WithEndpoint(config.Endpoint))
+	}
+	if config.Insecure {
+		options = append(options, otlpmetricgrpc.WithInsecure())
+	}
+	return otlpmetricgrpc.New(ctx, options...)
+}
+
+func newTraceExporter(ctx context.Context, config Config) (sdktrace.SpanExporter, error) {
+	if config.Protocol == "http" {
+		var options []otlptracehttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, options...)
+	}
+
+	var options []otlptracegrpc.Option
+	if config.Endpoint != "" {
+		options = append(options, otlptracegrpc.WithEndpoint(config.Endpoint))
+	}
+	if config.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	return otlptracegrpc.New(ctx, options...)
+}
+
+// StartRun sets the attributes recorded with every measurement of the run that is about to start
+func (t *Telemetry) StartRun(config collector.TestConfig) {
+	t.attributes = []attribute.KeyValue{
+		semconv.URLFull(config.URL),
+	}
+	for key, value := range config.Tags {
+		t.attributes = append(t.attributes, attribute.String("loadship.tag."+key, value))
+	}
+
+	t.connections.Record(context.Background(), int64(config.Connections), metric.WithAttributes(t.attributes...))
+}
+
+// Shutdown flushes and stops the exporters
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	var errs []error
+	if t.tracerProvider != nil {
+		errs = append(errs, t.tracerProvider.Shutdown(ctx))
+	}
+	errs = append(errs, t.meterProvider.Shutdown(ctx))
+	return errors.Join(errs...)
+}
+
+func (t *Telemetry) ObserveRequest() {
+	t.inFlight.Add(context.Background(), 1, metric.WithAttributes(t.attributes...))
+}
+
+func (t *Telemetry) ObserveHTTP(stat load.HTTPStats) {
+	ctx := context.Background()
+
+	t.inFlight.Add(ctx, -1, metric.WithAttributes(t.attributes...))
+
+	attributes := append([]attribute.KeyValue{}, t.attributes...)
+	if stat.ErrorType != "" {
+		attributes = append(attributes, semconv.ErrorTypeKey.String(stat.ErrorType))
+		t.requests.Add(ctx, 1, metric.WithAttributes(attributes...))
+		return
+	}
+
+	attributes = append(attributes, semconv.HTTPResponseStatusCode(stat.StatusCode))
+	t.requests.Add(ctx, 1, metric.WithAttributes(attributes...))
+	t.duration.Record(ctx, stat.Latency.Seconds(), metric.WithAttributes(attributes...))
+}
+
+func (t *Telemetry) ObserveDocker(stat docker.DockerStats) {
+	ctx := context.Background()
+	attributes := append([]attribute.KeyValue{}, t.attributes...)
+	options := metric.WithAttributes(append(attributes, semconv.ContainerName(stat.Container))...)
+
+	t.memory.Record(ctx, stat.MemoryUsageMB*1024*1024, options)
+	t.cpu.Record(ctx, stat.CPUPercent, options)
+	t.pids.Record(ctx, int64(stat.PIDs), options)
+}
+
+// TraceRequest starts a client span for req and injects its traceparent header.
+// The trace id is recorded on the result so slow samples can be matched with server-side traces.
+func (t *Telemetry) TraceRequest(req *http.Request) (*http.Request, func(*load.HTTPStats)) {
+	if t.tracer == nil {
+		return req, nil
+	}
+
+	ctx, span := t.tracer.Start(req.Context(), "GET",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodGet,
+			semconv.URLFull(req.URL.String()),
+			semconv.ServerAddress(req.URL.Hostname()),
+		),
+	)
+
+	req = req.WithContext(ctx)
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	return req, func(stat *load.HTTPStats) {
+		stat.TraceID = span.SpanContext().TraceID().String()
+
+		if stat.ErrorType != "" {
+			span.SetAttributes(semconv.ErrorTypeKey.String(stat.ErrorType))
+			span.SetStatus(codes.Error, stat.ErrorType)
+		} else {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(stat.StatusCode))
+			if stat.StatusCode >= 400 {
+				span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(stat.StatusCode)))
+				span.SetStatus(codes.Error, "")
+			}
+		}
+
+		span.End()
+	}
+}
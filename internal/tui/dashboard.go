@@ -0,0 +1,226 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/fireproofpenguin/loadship/internal/collector"
+	"github.com/fireproofpenguin/loadship/internal/docker"
+	"github.com/fireproofpenguin/loadship/internal/load"
+)
+
+// window is how many seconds of samples the rolling figures cover
+const window = 10
+
+type second struct {
+	requests int
+	errors   map[string]int
+	latency  *hdrhistogram.Histogram
+}
+
+func newSecond() *second {
+	return &second{
+		errors:  make(map[string]int),
+		latency: hdrhistogram.New(1, 60000, 3),
+	}
+}
+
+// Dashboard is a live terminal view of a running test, redrawn every second
+type Dashboard struct {
+	config collector.TestConfig
+	out    io.Writer
+
+	mu       sync.Mutex
+	start    time.Time
+	inFlight int
+	total    int
+	failed   int
+	current  *second
+	history  []*second
+	docker   map[string]docker.DockerStats
+	events   []docker.Event
+	lines    int
+}
+
+func New(config collector.TestConfig) *Dashboard {
+	return &Dashboard{
+		config:  config,
+		out:     os.Stdout,
+		start:   time.Now(),
+		current: newSecond(),
+		docker:  make(map[string]docker.DockerStats),
+	}
+}
+
+func (d *Dashboard) ObserveRequest() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inFlight++
+}
+
+func (d *Dashboard) ObserveHTTP(stat load.HTTPStats) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inFlight--
+	d.total++
+	d.current.requests++
+
+	// Matches how collector.Calculate decides a request failed
+	if errorType := classify(stat); errorType != "" {
+		d.failed++
+		d.current.errors[errorType]++
+		return
+	}
+
+	d.current.latency.RecordValue(stat.Latency.Milliseconds())
+}
+
+func (d *Dashboard) ObserveDocker(stat docker.DockerStats) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.docker[stat.Container] = stat
+}
+
+func (d *Dashboard) ObserveEvent(event docker.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.events = append(d.events, event)
+}
+
+func classify(stat load.HTTPStats) string {
+	if stat.ErrorType != "" {
+		return stat.ErrorType
+	}
+	if stat.StatusCode < 200 || stat.StatusCode >= 300 {
+		return fmt.Sprintf("http_%d", stat.StatusCode)
+	}
+	return ""
+}
+
+// Run redraws the dashboard every second until ctx is done
+func (d *Dashboard) Run(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	d.mu.Lock()
+	d.start = time.Now()
+	d.mu.Unlock()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.tick()
+		case <-ctx.Done():
+			// Draw the final state without closing the partial second, which would show a misleadingly low RPS
+			d.mu.Lock()
+			if len(d.history) > 0 {
+				d.draw()
+			}
+			d.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (d *Dashboard) drawResources(b *strings.Builder, label string, name string) {
+	stat, ok := d.docker[name]
+	if !ok {
+		fmt.Fprintf(b, "%s    waiting for stats...\n", label)
+		return
+	}
+	fmt.Fprintf(b, "%s    Memory: %.2f MB (%.1f %% of limit)    CPU: %.2f %%\n", label, stat.MemoryUsageMB, stat.MemoryPercent, stat.CPUPercent)
+}
+
+// tick closes the current second and redraws
+func (d *Dashboard) tick() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.history = append(d.history, d.current)
+	if len(d.history) > window {
+		d.history = d.history[1:]
+	}
+	d.current = newSecond()
+
+	d.draw()
+}
+
+func (d *Dashboard) draw() {
+	var b strings.Builder
+
+	elapsed := time.Since(d.start).Truncate(time.Second)
+	if elapsed > d.config.Duration {
+		elapsed = d.config.Duration
+	}
+
+	const barWidth = 30
+	filled := int(float64(barWidth) * elapsed.Seconds() / d.config.Duration.Seconds())
+	fmt.Fprintf(&b, "%s  [%s%s] %s/%s\n", d.config.URL, strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled), elapsed, d.config.Duration)
+
+	last := d.history[len(d.history)-1]
+
+	latency := hdrhistogram.New(1, 60000, 3)
+	errors := make(map[string]int)
+	var windowRequests, windowErrors int
+	for _, s := range d.history {
+		latency.Merge(s.latency)
+		windowRequests += s.requests
+		for errorType, count := range s.errors {
+			errors[errorType] += count
+			windowErrors += count
+		}
+	}
+
+	fmt.Fprintf(&b, "Connections: %d    In-flight: %d\n", d.config.Connections, d.inFlight)
+	fmt.Fprintf(&b, "RPS: %d    Requests: %d    Failed: %d\n", last.requests, d.total, d.failed)
+
+	if latency.TotalCount() > 0 {
+		fmt.Fprintf(&b, "Latency (last %ds) p50: %dms    p99: %dms\n", len(d.history), latency.ValueAtQuantile(50), latency.ValueAtQuantile(99))
+	} else {
+		fmt.Fprintf(&b, "Latency (last %ds) p50: -    p99: -\n", len(d.history))
+	}
+
+	if windowErrors > 0 {
+		var parts []string
+		for _, errorType := range slices.Sorted(maps.Keys(errors)) {
+			parts = append(parts, fmt.Sprintf("%s %.2f%%", errorType, 100*float64(errors[errorType])/float64(windowRequests)))
+		}
+		fmt.Fprintf(&b, "Error rate (last %ds): %s\n", len(d.history), strings.Join(parts, "    "))
+	} else {
+		fmt.Fprintf(&b, "Error rate (last %ds): 0.00%%\n", len(d.history))
+	}
+
+	for _, container := range d.config.Containers {
+		d.drawResources(&b, "Container "+container, container)
+	}
+	for _, target := range d.config.Processes {
+		d.drawResources(&b, "Process "+target.String(), target.String())
+	}
+
+	// Only the latest few events fit, the full timeline is in the results
+	for _, event := range d.events[max(0, len(d.events)-3):] {
+		fmt.Fprintf(&b, "! %s %s\n", event.Timestamp.Sub(d.start).Truncate(time.Second), event)
+	}
+
+	fmt.Fprintln(&b, "Press Ctrl+C to abort")
+
+	// Move back to the start of the previous frame and clear it before drawing the next
+	if d.lines > 0 {
+		fmt.Fprintf(d.out, "\033[%dA\033[J", d.lines)
+	}
+
+	fmt.Fprint(d.out, b.String())
+	d.lines = strings.Count(b.String(), "\n")
+}